@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sourceHealth reports how a source behaved during the last searches
+type sourceHealth struct {
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	// Enabled is false if the server was not configured to search the source
+	Enabled bool `json:"enabled"`
+	// Status is "unknown" until the source is searched, then "ok" or "failing"
+	// depending on the last search
+	Status      string     `json:"status"`
+	LastSearch  *time.Time `json:"lastSearch,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	Successes   int        `json:"successes"`
+	Failures    int        `json:"failures"`
+}
+
+// apiResult is a search result returned by the JSON API
+type apiResult struct {
+	record
+	// ResolveURL is the url to call in order to get the magnet or the torrent
+	// file. It is empty if the magnet is already known.
+	ResolveURL string `json:"resolveURL,omitempty"`
+}
+
+// apiSearchResponse is the response of the search endpoint
+type apiSearchResponse struct {
+	Query   string      `json:"query"`
+	Results []apiResult `json:"results"`
+	// Errors maps the sources that failed to their error
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// apiResolveResponse is the response of the resolve endpoint for sources
+// giving magnets
+type apiResolveResponse struct {
+	Magnet string `json:"magnet"`
+}
+
+// apiPushResponse is the response of the push endpoint
+type apiPushResponse struct {
+	// Resource is the magnet or the local path of the torrent file opened in
+	// the torrent client
+	Resource string `json:"resource"`
+}
+
+// apiError is returned by all endpoints in case of error
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// handleAPISearch searches the sources.
+// GET parameters:
+//
+// - q: the user search (mandatory)
+//
+// - sources: a comma separated list of sources (defaults to the server sources)
+//
+// - filter: words that must all appear in the torrent names
+//
+// - sort: a comma separated list of sort keys among relevance, seeders
+// (default), leechers, size, date, name and source. A "-" prefix reverses the
+// order of a key.
+//
+// - timeout: timeout of the search on each source in milliseconds, capped by
+// the server timeout
+func (srv *server) handleAPISearch(w http.ResponseWriter, r *http.Request) {
+	if !srv.authorized(r) {
+		writeAPIError(w, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+	params := r.URL.Query()
+
+	in := params.Get("q")
+	if in == "" {
+		writeAPIError(w, http.StatusBadRequest, "missing parameter q")
+		return
+	}
+	if _, err := parseQuery(in); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid search: "+err.Error())
+		return
+	}
+
+	sourcesToLookup := srv.sourcesToLookup
+	if usrSources := params.Get("sources"); usrSources != "" {
+		var err error
+		sourcesToLookup, err = parseSources(usrSources)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, source := range sourcesToLookup {
+			if !srv.health[source].Enabled {
+				writeAPIError(w, http.StatusBadRequest, "source "+source+" is disabled on this server")
+				return
+			}
+		}
+	}
+
+	timeout := srv.timeout
+	if timeoutStr := params.Get("timeout"); timeoutStr != "" {
+		timeoutInMillisec, err := strconv.Atoi(timeoutStr)
+		if err != nil || timeoutInMillisec <= 0 {
+			writeAPIError(w, http.StatusBadRequest, "timeout should be a positive number of milliseconds")
+			return
+		}
+		usrTimeout := time.Duration(timeoutInMillisec) * time.Millisecond
+		if srv.timeout == 0 || usrTimeout < srv.timeout {
+			timeout = usrTimeout
+		}
+	}
+
+	sortKey := params.Get("sort")
+	if sortKey == "" {
+		sortKey = "seeders"
+	}
+	so, err := newSorter(sortKey, in)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s, err := srv.search(in, sourcesToLookup, timeout)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"input": in,
+			"error": err,
+		}).Error("API search failed")
+		writeAPIError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	s.filterOut(params.Get("filter"))
+	so.sort(s.out)
+
+	resp := apiSearchResponse{
+		Query:   s.in,
+		Results: []apiResult{},
+	}
+	for _, t := range s.out {
+		result := apiResult{record: newRecord(t)}
+		if t.magnet == "" {
+			result.ResolveURL = srv.signedURL(r, "/api/v1/resolve", t, s.in)
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	if len(s.errs) > 0 {
+		resp.Errors = make(map[string]string)
+		for source, err := range s.errs {
+			resp.Errors[source] = err.Error()
+		}
+	}
+
+	writeAPIJSON(w, http.StatusOK, resp)
+}
+
+// handleAPIResolve resolves a result returned by the search endpoint.
+// 1337x magnets are returned as JSON, Archive.org and Ygg Torrent files are
+// sent as is.
+func (srv *server) handleAPIResolve(w http.ResponseWriter, r *http.Request) {
+	if !srv.authorized(r) {
+		writeAPIError(w, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+	t, in, ok := srv.verify(r.URL.Query())
+	if !ok {
+		writeAPIError(w, http.StatusForbidden, "invalid signature")
+		return
+	}
+
+	switch t.source {
+	case "otts":
+		if err := getMagnet(&t, srv.timeout); err != nil {
+			log.WithFields(log.Fields{
+				"descURL": t.descURL,
+				"error":   err,
+			}).Error("Could not retrieve magnet")
+			writeAPIError(w, http.StatusBadGateway, "could not retrieve magnet")
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, apiResolveResponse{Magnet: t.magnet})
+	case "arc", "ygg":
+		srv.sendTorrentFile(w, t, in)
+	default:
+		writeAPIError(w, http.StatusBadRequest, "nothing to resolve for source "+t.source)
+	}
+}
+
+// handleAPIPush opens a result in the torrent client configured on the server.
+// It expects a POST request with either a "magnet" parameter, or the
+// parameters of the resolveURL of the result.
+// Torrent files are kept on the server since the torrent client may read them
+// after the request.
+func (srv *server) handleAPIPush(w http.ResponseWriter, r *http.Request) {
+	if !srv.authorized(r) {
+		writeAPIError(w, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	if srv.torrentClient == "" {
+		writeAPIError(w, http.StatusNotImplemented, "no torrent client configured on this server")
+		return
+	}
+	params := r.URL.Query()
+
+	var resource string
+	if magnet := params.Get("magnet"); magnet != "" {
+		// Magnets are passed as a command argument so make sure they cannot
+		// be mistaken for an option
+		if !strings.HasPrefix(magnet, "magnet:?") {
+			writeAPIError(w, http.StatusBadRequest, "invalid magnet")
+			return
+		}
+		resource = magnet
+	} else {
+		t, in, ok := srv.verify(params)
+		if !ok {
+			writeAPIError(w, http.StatusForbidden, "invalid signature")
+			return
+		}
+		var err error
+		switch t.source {
+		case "otts":
+			err = getMagnet(&t, srv.timeout)
+			resource = t.magnet
+		case "arc", "ygg":
+			err = getTorrentFile(&t, srv.yggUserID, in, srv.yggUserPass, srv.timeout, srv.yggHTTPClient())
+			resource = t.filePath
+		default:
+			writeAPIError(w, http.StatusBadRequest, "nothing to resolve for source "+t.source)
+			return
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"descURL": t.descURL,
+				"error":   err,
+			}).Error("Could not resolve torrent")
+			writeAPIError(w, http.StatusBadGateway, "could not retrieve the magnet or the torrent file")
+			return
+		}
+	}
+
+	if err := openInClient(resource, srv.torrentClient); err != nil {
+		log.WithFields(log.Fields{
+			"resource": resource,
+			"client":   srv.torrentClient,
+			"error":    err,
+		}).Error("Could not open torrent in client")
+		writeAPIError(w, http.StatusInternalServerError, "could not open torrent in client")
+		return
+	}
+
+	writeAPIJSON(w, http.StatusOK, apiPushResponse{Resource: resource})
+}
+
+// handleAPISources lists the sources and their health
+func (srv *server) handleAPISources(w http.ResponseWriter, r *http.Request) {
+	if !srv.authorized(r) {
+		writeAPIError(w, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+
+	srv.mu.Lock()
+	var health []sourceHealth
+	for _, h := range srv.health {
+		health = append(health, *h)
+	}
+	srv.mu.Unlock()
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].Source < health[j].Source
+	})
+
+	writeAPIJSON(w, http.StatusOK, health)
+}
+
+// writeAPIJSON writes v as a JSON document with the given status code
+func writeAPIJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Could not encode API response")
+	}
+}
+
+// writeAPIError writes an API error with the given status code
+func writeAPIError(w http.ResponseWriter, code int, msg string) {
+	writeAPIJSON(w, code, apiError{Error: msg})
+}
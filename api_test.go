@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleAPISources(t *testing.T) {
+	srv, err := newServer([]string{"arc", "tpb"}, time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.updateHealth(search{
+		sourcesToLookup: []string{"arc", "tpb"},
+		errs:            map[string]error{"tpb": errTest},
+	})
+
+	w := httptest.NewRecorder()
+	srv.handleAPISources(w, httptest.NewRequest("GET", "/api/v1/sources", nil))
+	var health []sourceHealth
+	if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"arc": "ok", "otts": "unknown", "tpb": "failing", "ygg": "unknown"}
+	if len(health) != len(want) {
+		t.Fatalf("Got %v sources, want %v", len(health), len(want))
+	}
+	for _, h := range health {
+		if h.Status != want[h.Source] {
+			t.Fatalf("Got status %v for %v, want %v", h.Status, h.Source, want[h.Source])
+		}
+	}
+}
+
+func TestHandleAPISearchBadRequest(t *testing.T) {
+	srv, err := newServer([]string{"arc"}, time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{
+		"/api/v1/search",
+		"/api/v1/search?q=dumas&sources=foo",
+		"/api/v1/search?q=dumas&sources=tpb",
+		"/api/v1/search?q=dumas&timeout=abc",
+		"/api/v1/search?q=dumas&sort=foo",
+	} {
+		w := httptest.NewRecorder()
+		srv.handleAPISearch(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != 400 {
+			t.Fatalf("Got status %v for %v, want 400", w.Code, url)
+		}
+	}
+}
+
+func TestFilterAndSortOut(t *testing.T) {
+	s := search{out: []torrent{
+		{name: "Le Comte de Monte-Cristo", seeders: 3, leechers: 9},
+		{name: "Les Trois Mousquetaires", seeders: 5},
+		{name: "Monte Cristo (2002)", seeders: 1, leechers: 10},
+	}}
+
+	s.filterOut("monte CRISTO")
+	if len(s.out) != 2 {
+		t.Fatalf("Got %v torrents after filtering, want 2", len(s.out))
+	}
+
+	if err := s.sortOutBy("leechers"); err != nil {
+		t.Fatal(err)
+	}
+	if s.out[0].name != "Monte Cristo (2002)" {
+		t.Fatalf("Got %v first, want Monte Cristo (2002)", s.out[0].name)
+	}
+	if err := s.sortOutBy("foo"); err == nil {
+		t.Fatal("Unknown sort key should return an error")
+	}
+}
+
+var errTest = errors.New("test error")
+
+func TestHandleAPIPush(t *testing.T) {
+	srv, err := newServer([]string{"arc"}, time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.handleAPIPush(w, httptest.NewRequest("POST", "/api/v1/push?magnet=magnet:?xt=urn:btih:abc", nil))
+	if w.Code != 501 {
+		t.Fatalf("Got status %v without torrent client, want 501", w.Code)
+	}
+
+	srv.torrentClient = "true"
+	w = httptest.NewRecorder()
+	srv.handleAPIPush(w, httptest.NewRequest("POST", "/api/v1/push?magnet=--help", nil))
+	if w.Code != 400 {
+		t.Fatalf("Got status %v for an invalid magnet, want 400", w.Code)
+	}
+}
+
+func TestWebUIEmbedded(t *testing.T) {
+	index, err := webUI.ReadFile("web/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), "/api/v1/search") {
+		t.Fatal("Web UI does not use the search endpoint")
+	}
+}
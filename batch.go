@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxConcurrentDownloads is the maximum number of torrents resolved at the
+// same time in a batch, since each 1337x magnet extraction opens a browser tab
+const maxConcurrentDownloads = 4
+
+// batchResult is the outcome of the retrieval of one torrent of a batch
+type batchResult struct {
+	index int
+	// resource is the magnet or the local path of the torrent file
+	resource string
+	err      error
+}
+
+// parseIndexes converts a list of indexes and ranges like "1,4,7-9" into
+// sorted and deduplicated indexes.
+// nbTorrents is the number of torrents the user can choose from.
+func parseIndexes(usrIndexes string, nbTorrents int) ([]int, error) {
+	encountered := make(map[int]bool)
+	for _, part := range strings.Split(usrIndexes, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%v is not an index or a range", part)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err != nil || last < first {
+				return nil, fmt.Errorf("%v is not a valid range", part)
+			}
+		}
+		if first < 0 || last >= nbTorrents {
+			return nil, fmt.Errorf("%v is out of range, indexes are between 0 and %d", part, nbTorrents-1)
+		}
+
+		for i := first; i <= last; i++ {
+			encountered[i] = true
+		}
+	}
+	if len(encountered) == 0 {
+		return nil, fmt.Errorf("no index")
+	}
+
+	indexes := make([]int, 0, len(encountered))
+	for i := range encountered {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	return indexes, nil
+}
+
+// resolve retrieves the magnet or the torrent file of t, depending on what
+// its source provides, and returns it.
+// If isToFile is true, magnets are converted into torrent files, their
+// metadata being looked for during metadataTimeout.
+func resolve(t *torrent, userID, in, userPass string,
+	timeout, metadataTimeout time.Duration, httpClient *http.Client, isToFile bool) (string, error) {
+	switch t.source {
+	case "arc", "ygg":
+		if t.filePath == "" {
+			if err := getTorrentFile(t, userID, in, userPass, timeout, httpClient); err != nil {
+				return "", err
+			}
+		}
+		return t.filePath, nil
+	default:
+		if t.magnet == "" {
+			if err := getMagnet(t, timeout); err != nil {
+				return "", err
+			}
+		} else {
+			t.magnet = extraTrackers.addTo(t.source, t.magnet)
+		}
+		if isToFile {
+			if t.filePath == "" {
+				if err := fetchTorrentFile(t, in, metadataTimeout); err != nil {
+					return "", err
+				}
+			}
+			return t.filePath, nil
+		}
+		return t.magnet, nil
+	}
+}
+
+// resolveAll concurrently retrieves the magnets or the torrent files of the
+// torrents of s at the given indexes, and optionally opens them in
+// torrentClient. If isToFile is true, magnets are converted into torrent
+// files (see resolve).
+// Results are returned in the order of indexes.
+func resolveAll(s *search, indexes []int, userID, userPass string,
+	timeout, metadataTimeout time.Duration, isToFile bool, torrentClient string) []batchResult {
+	results := make([]batchResult, len(indexes))
+	sem := make(chan struct{}, maxConcurrentDownloads)
+	var wg sync.WaitGroup
+
+	for i, index := range indexes {
+		wg.Add(1)
+		go func(i, index int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// Ygg Torrent downloads modify their http client so each one
+			// gets its own copy, sharing the same cookies
+			var httpClient *http.Client
+			if s.httpClient != nil {
+				c := *s.httpClient
+				httpClient = &c
+			}
+
+			t := &s.out[index]
+			resource, err := resolve(t, userID, s.in, userPass, timeout, metadataTimeout, httpClient, isToFile)
+			if err == nil && torrentClient != "" {
+				err = openInClient(resource, torrentClient)
+			}
+			results[i] = batchResult{index: index, resource: resource, err: err}
+		}(i, index)
+	}
+	wg.Wait()
+
+	return results
+}
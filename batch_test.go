@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIndexes(t *testing.T) {
+	indexes, err := parseIndexes("7-9, 1,4,8", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 4, 7, 8, 9}; !reflect.DeepEqual(indexes, want) {
+		t.Fatalf("Got %v, want %v", indexes, want)
+	}
+
+	for _, usrIndexes := range []string{"", "a", "3-1", "1-", "-1", "10", "8-10"} {
+		if _, err := parseIndexes(usrIndexes, 10); err == nil {
+			t.Fatalf("Expected an error for %q", usrIndexes)
+		}
+	}
+}
+
+func TestResolveAll(t *testing.T) {
+	s := &search{in: "dumas", out: []torrent{
+		{name: "Le Comte de Monte-Cristo", source: "tpb", magnet: "magnet:?xt=urn:btih:a"},
+		{name: "Les Trois Mousquetaires", source: "tpb", magnet: "magnet:?xt=urn:btih:b"},
+		{name: "Vingt ans après", source: "arc", filePath: "/tmp/vingt_ans_apres.torrent"},
+	}}
+
+	results := resolveAll(s, []int{2, 0}, "", "", 0, 0, false, "")
+	want := []batchResult{
+		{index: 2, resource: "/tmp/vingt_ans_apres.torrent"},
+		{index: 0, resource: "magnet:?xt=urn:btih:a"},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Fatalf("Got %+v, want %+v", results, want)
+	}
+}
+
+func TestSetInfoHash(t *testing.T) {
+	tor := torrent{source: "tpb", magnet: "magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK&dn=x"}
+	setInfoHash(&tor)
+	if want := "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"; tor.infoHash != want {
+		t.Fatalf("Got infohash %q, want %q", tor.infoHash, want)
+	}
+
+	tor = torrent{source: "tpb", magnet: "not a magnet"}
+	setInfoHash(&tor)
+	if tor.infoHash != "" {
+		t.Fatalf("Got infohash %q for an invalid magnet", tor.infoHash)
+	}
+}
+
+func TestResolveAddsTrackers(t *testing.T) {
+	defer func() { extraTrackers = nil }()
+	extraTrackers = &trackerList{trackers: []string{"http://tracker.example/announce"}}
+
+	uri := "magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK&dn=x"
+	tor := torrent{source: "tpb", magnet: uri}
+	magnet, err := resolve(&tor, "", "dumas", "", 0, 0, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uri + "&tr=http%3A%2F%2Ftracker.example%2Fannounce"; magnet != want {
+		t.Fatalf("Got magnet %q, want %q", magnet, want)
+	}
+}
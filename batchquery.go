@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/juliensalinas/torrengo/core"
+)
+
+// batchQuery is a search read from a batch file
+type batchQuery struct {
+	// line is the line number of the query in the batch file
+	line            int
+	in              string
+	sourcesToLookup []string
+	filter          string
+	sortKeys        string
+	// err is set if the line could not be parsed
+	err error
+}
+
+// batchRecord is a result of a batch search, tagged with the query it comes
+// from.
+// record is nil and Error is set if the query failed or gave no result.
+type batchRecord struct {
+	Query string `json:"query"`
+	*record
+	Error string `json:"error,omitempty"`
+}
+
+// parseBatchLine parses a line of a batch file. A line contains the words to
+// search, optionally followed by overrides separated by "|":
+//
+//	Dumas Montecristo | sources=arc,tpb | filter=1080p | sort=relevance
+//
+// sourcesToLookup and sortKeys are used if the line does not override them.
+func parseBatchLine(line string, sourcesToLookup []string, sortKeys string) batchQuery {
+	parts := strings.Split(line, "|")
+	q := batchQuery{
+		in:              strings.TrimSpace(parts[0]),
+		sourcesToLookup: sourcesToLookup,
+		sortKeys:        sortKeys,
+	}
+	if q.in == "" {
+		q.err = fmt.Errorf("empty query")
+		return q
+	}
+
+	for _, override := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(override), "=", 2)
+		if len(kv) != 2 {
+			q.err = fmt.Errorf("override %q should be key=value", strings.TrimSpace(override))
+			return q
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "sources":
+			var err error
+			q.sourcesToLookup, err = parseSources(strings.Replace(value, " ", "", -1))
+			if err != nil {
+				q.err = err
+				return q
+			}
+		case "filter":
+			q.filter = value
+		case "sort":
+			if _, err := newSorter(value, ""); err != nil {
+				q.err = err
+				return q
+			}
+			q.sortKeys = value
+		default:
+			q.err = fmt.Errorf("unknown override %v", key)
+			return q
+		}
+	}
+
+	return q
+}
+
+// readBatchQueries reads one query per line from r. Empty lines and lines
+// starting with "#" are skipped.
+func readBatchQueries(r io.Reader, sourcesToLookup []string, sortKeys string) ([]batchQuery, error) {
+	var queries []batchQuery
+	scanner := bufio.NewScanner(r)
+	for lineNb := 1; scanner.Scan(); lineNb++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		q := parseBatchLine(line, sourcesToLookup, sortKeys)
+		q.line = lineNb
+		queries = append(queries, q)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read queries: %v", err)
+	}
+
+	return queries, nil
+}
+
+// searchBatchQuery searches the sources for q and returns the records to
+// write: the best result only, or all of them.
+// Results found on several sources are merged if isMerged is true.
+func searchBatchQuery(q batchQuery, timeout time.Duration, isAll, isMerged bool) []batchRecord {
+	if q.err != nil {
+		return []batchRecord{{Query: q.in, Error: fmt.Sprintf("line %d: %v", q.line, q.err)}}
+	}
+
+	s := search{
+		in:              q.in,
+		sourcesToLookup: q.sourcesToLookup,
+	}
+	err := s.lookup(timeout)
+	for source, err := range s.errs {
+		log.WithFields(log.Fields{
+			"input":  s.in,
+			"source": source,
+			"error":  err,
+		}).Error("Search failed on source")
+	}
+	if err != nil {
+		return []batchRecord{{Query: q.in, Error: err.Error()}}
+	}
+	if isMerged {
+		s.mergeOut()
+	}
+	s.filterOut(q.filter)
+	s.sortOutBy(q.sortKeys)
+
+	if len(s.out) == 0 {
+		return []batchRecord{{Query: q.in, Error: "no result found"}}
+	}
+	if !isAll {
+		s.out = s.out[:1]
+	}
+	records := make([]batchRecord, 0, len(s.out))
+	for _, t := range s.out {
+		r := newRecord(t)
+		records = append(records, batchRecord{Query: q.in, record: &r})
+	}
+
+	return records
+}
+
+// runBatch searches all queries, with at most concurrency searches at the
+// same time, and writes their records to w as NDJSON in the order of the
+// queries.
+// The number of queries which failed or gave no result is returned.
+func runBatch(w io.Writer, queries []batchQuery, timeout time.Duration,
+	concurrency int, isAll, isMerged bool) (int, error) {
+	results := make([]chan []batchRecord, len(queries))
+	for i := range results {
+		results[i] = make(chan []batchRecord, 1)
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func(i int, q batchQuery) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] <- searchBatchQuery(q, timeout, isAll, isMerged)
+		}(i, q)
+	}
+	defer wg.Wait()
+
+	// Records are written as soon as all previous queries are done
+	var nbFailures int
+	enc := json.NewEncoder(w)
+	for _, result := range results {
+		records := <-result
+		if records[0].record == nil {
+			nbFailures++
+		}
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return nbFailures, fmt.Errorf("could not write results: %v", err)
+			}
+		}
+	}
+
+	return nbFailures, nil
+}
+
+// batchCmd parses the batch subcommand flags and searches the queries of a
+// file, or of stdin
+func batchCmd(args []string) {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(
+			flags.Output(),
+			"Usage of %[1]s batch:%[2]s%[2]s\t%[1]s batch [-all] [-j concurrency] [-no-merge] [-s sources] [-sort keys] [-t timeout] [-v] [file]%[2]s%[2]s"+
+				"Searches one query per line of file, or of stdin if file is missing or -. "+
+				"A line can override sources and sort keys, and filter results:%[2]s%[2]s\tDumas Montecristo | sources=arc,tpb | filter=1080p | sort=relevance%[2]s%[2]s"+
+				"The best result of each query, or all of them with -all, are written as NDJSON tagged with their query.%[2]s%[2]s"+
+				"Options:%[2]s%[2]s",
+			os.Args[0], lineBreak,
+		)
+		flags.PrintDefaults()
+	}
+	isAll := flags.Bool("all", false, "Write all the results of each query instead of the best one.")
+	concurrency := flags.Int("j", 2, "Maximum number of queries searched at the same time.")
+	isNoMerge := flags.Bool("no-merge", false, "Do not merge the torrents found on several sources.")
+	usrSources := flags.String("s", "all", "A comma separated list of sources "+
+		"you want to search."+lineBreak+"Choices: arc (Archive.org) | tpb (ThePirateBay) | otts (1337x) | ygg (YggTorrent). ")
+	sortKeysPtr := flags.String("sort", "seeders", "Comma separated list of keys results are sorted by: "+
+		strings.Join(sortKeys, " | ")+". Prefix a key with - to reverse its order.")
+	timeoutInMillisec := flags.Int("t", 20000, "Timeout of HTTP requests in milliseconds. Set it to 0 to completely remove timeout.")
+	isVerbosePtr := flags.Bool("v", false, "Verbose mode. Use it to see more logs.")
+	flags.Parse(args)
+
+	isVerbose = *isVerbosePtr
+	setLogger(isVerbose)
+
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "-j should be at least 1 (-h for help).")
+		os.Exit(1)
+	}
+	if err := loadExtraTrackers(); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not use your trackers: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+	sourcesToLookup, err := parseSources(*usrSources)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "This website is not correct: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+	if _, err := newSorter(*sortKeysPtr, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not sort results: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+
+	in := os.Stdin
+	if path := flags.Arg(0); path != "" && path != "-" {
+		in, err = os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not open %v.%v", path, lineBreak)
+			log.WithFields(log.Fields{
+				"path":  path,
+				"error": err,
+			}).Fatal("Could not open batch file")
+		}
+		defer in.Close()
+	}
+	queries, err := readBatchQueries(in, sourcesToLookup, *sortKeysPtr)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("Could not read batch queries")
+	}
+
+	// Concurrent searches share the same browser. If it cannot be launched,
+	// sources needing a browser will report the error for each query.
+	closeBrowser := func() {}
+	if c, err := core.StartBrowser(); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Debug("Could not launch shared browser")
+	} else {
+		closeBrowser = c
+	}
+	defer closeBrowser()
+
+	timeout := time.Duration(*timeoutInMillisec) * time.Millisecond
+	nbFailures, err := runBatch(os.Stdout, queries, timeout, *concurrency, *isAll, !*isNoMerge)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("Batch broke")
+	}
+	if nbFailures > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d queries failed or gave no result.%v", nbFailures, len(queries), lineBreak)
+		closeBrowser()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadBatchQueries(t *testing.T) {
+	in := "# books\nDumas Montecristo | sources=arc,tpb | filter=epub | sort=relevance\n\n  Les Misérables  \nHugo | foo=bar\n| filter=x\n"
+	queries, err := readBatchQueries(strings.NewReader(in), []string{"otts"}, "seeders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 4 {
+		t.Fatalf("Got %d queries, want 4", len(queries))
+	}
+
+	q := queries[0]
+	if q.line != 2 || q.in != "Dumas Montecristo" || q.filter != "epub" || q.sortKeys != "relevance" || q.err != nil {
+		t.Fatalf("Got %+v for the first query", q)
+	}
+	if !reflect.DeepEqual(q.sourcesToLookup, []string{"arc", "tpb"}) {
+		t.Fatalf("Got sources %v, want [arc tpb]", q.sourcesToLookup)
+	}
+	if q := queries[1]; q.in != "Les Misérables" || !reflect.DeepEqual(q.sourcesToLookup, []string{"otts"}) {
+		t.Fatalf("Got %+v for the second query", q)
+	}
+	if queries[2].err == nil || queries[3].err == nil {
+		t.Fatal("Expected errors for an unknown override and an empty query")
+	}
+}
+
+func TestRunBatchWritesErrorsInOrder(t *testing.T) {
+	queries := []batchQuery{
+		parseBatchLine("Dumas | sources=foo", nil, "seeders"),
+		parseBatchLine("Hugo | bar", nil, "seeders"),
+	}
+	var buf bytes.Buffer
+	nbFailures, err := runBatch(&buf, queries, 0, 2, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nbFailures != 2 {
+		t.Fatalf("Got %d failures, want 2", nbFailures)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"query":"Dumas","error":`) ||
+		!strings.HasPrefix(lines[1], `{"query":"Hugo","error":`) {
+		t.Fatalf("Got unexpected output %q", buf.String())
+	}
+}
@@ -0,0 +1,286 @@
+// Package bencode encodes and decodes the bencoding format used by BitTorrent
+// (BEP 3).
+//
+// Decoded values are:
+//
+// - int64 for integers
+//
+// - string for byte strings (which may contain binary data)
+//
+// - []interface{} for lists
+//
+// - map[string]interface{} for dictionaries
+//
+// Encode accepts these types, plus other integer types, []byte, []string,
+// map[string]string and RawMessage for values which are already bencoded.
+package bencode
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// maxDepth is the maximum nesting of lists and dictionaries, so malicious
+// inputs cannot exhaust the stack
+const maxDepth = 256
+
+// RawMessage is a value which is already bencoded, written as is by Encode
+type RawMessage []byte
+
+// decoder decodes bencoded data
+type decoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+// Decode decodes a bencoded value. The whole data must be made up of this
+// value.
+func Decode(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("trailing data at offset %d", d.pos)
+	}
+
+	return v, nil
+}
+
+// DecodePrefix decodes the bencoded value at the beginning of data and
+// returns it, along with the number of bytes it takes.
+// It is useful when a bencoded value is followed by other data.
+func DecodePrefix(data []byte) (interface{}, int, error) {
+	d := decoder{data: data}
+	v, err := d.value()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return v, d.pos, nil
+}
+
+// DictRaw decodes a bencoded dictionary and returns the raw bencoded value of
+// each of its keys. It is used to hash values exactly as they were encoded,
+// like the info dictionary of torrent files.
+func DictRaw(data []byte) (map[string]RawMessage, error) {
+	d := decoder{data: data}
+	if d.pos >= len(d.data) || d.data[d.pos] != 'd' {
+		return nil, fmt.Errorf("not a dictionary")
+	}
+	d.pos++
+
+	raw := make(map[string]RawMessage)
+	for {
+		if d.pos >= len(d.data) {
+			return nil, fmt.Errorf("unterminated dictionary")
+		}
+		if d.data[d.pos] == 'e' {
+			d.pos++
+			break
+		}
+		key, err := d.string()
+		if err != nil {
+			return nil, fmt.Errorf("invalid dictionary key: %v", err)
+		}
+		start := d.pos
+		if _, err := d.value(); err != nil {
+			return nil, err
+		}
+		raw[key] = RawMessage(d.data[start:d.pos])
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("trailing data at offset %d", d.pos)
+	}
+
+	return raw, nil
+}
+
+// value decodes the value at the current position
+func (d *decoder) value() (interface{}, error) {
+	if d.pos >= len(d.data) {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		return d.integer()
+	case c >= '0' && c <= '9':
+		return d.string()
+	case c == 'l':
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		d.pos++
+		list := []interface{}{}
+		for {
+			if d.pos >= len(d.data) {
+				return nil, fmt.Errorf("unterminated list")
+			}
+			if d.data[d.pos] == 'e' {
+				d.pos++
+				d.depth--
+				return list, nil
+			}
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case c == 'd':
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		d.pos++
+		dict := make(map[string]interface{})
+		for {
+			if d.pos >= len(d.data) {
+				return nil, fmt.Errorf("unterminated dictionary")
+			}
+			if d.data[d.pos] == 'e' {
+				d.pos++
+				d.depth--
+				return dict, nil
+			}
+			key, err := d.string()
+			if err != nil {
+				return nil, fmt.Errorf("invalid dictionary key: %v", err)
+			}
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			dict[key] = v
+		}
+	default:
+		return nil, fmt.Errorf("unexpected character %q at offset %d", c, d.pos)
+	}
+}
+
+// enter checks the nesting depth before decoding a list or a dictionary
+func (d *decoder) enter() error {
+	d.depth++
+	if d.depth > maxDepth {
+		return fmt.Errorf("too many nested values")
+	}
+	return nil
+}
+
+// integer decodes an integer like i42e
+func (d *decoder) integer() (int64, error) {
+	end := bytes.IndexByte(d.data[d.pos:], 'e')
+	if end < 0 {
+		return 0, fmt.Errorf("unterminated integer at offset %d", d.pos)
+	}
+	s := string(d.data[d.pos+1 : d.pos+end])
+	if s == "" || s == "-0" || (len(s) > 1 && s[0] == '0') || (len(s) > 2 && s[:2] == "-0") {
+		return 0, fmt.Errorf("invalid integer %q at offset %d", s, d.pos)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %q at offset %d", s, d.pos)
+	}
+	d.pos += end + 1
+
+	return n, nil
+}
+
+// string decodes a byte string like 4:spam
+func (d *decoder) string() (string, error) {
+	colon := bytes.IndexByte(d.data[d.pos:], ':')
+	if colon <= 0 {
+		return "", fmt.Errorf("invalid string at offset %d", d.pos)
+	}
+	length, err := strconv.Atoi(string(d.data[d.pos : d.pos+colon]))
+	if err != nil || length < 0 {
+		return "", fmt.Errorf("invalid string length at offset %d", d.pos)
+	}
+	start := d.pos + colon + 1
+	if length > len(d.data)-start {
+		return "", fmt.Errorf("string at offset %d exceeds data", d.pos)
+	}
+	d.pos = start + length
+
+	return string(d.data[start:d.pos]), nil
+}
+
+// Encode bencodes v. Dictionary keys are sorted as required by the format.
+func Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encode writes the bencoded v to buf
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case int:
+		fmt.Fprintf(buf, "i%de", v)
+	case int64:
+		fmt.Fprintf(buf, "i%de", v)
+	case uint32:
+		fmt.Fprintf(buf, "i%de", v)
+	case uint16:
+		fmt.Fprintf(buf, "i%de", v)
+	case bool:
+		// Booleans are stored as integers, like the private flag of torrents
+		if v {
+			buf.WriteString("i1e")
+		} else {
+			buf.WriteString("i0e")
+		}
+	case string:
+		fmt.Fprintf(buf, "%d:%s", len(v), v)
+	case []byte:
+		fmt.Fprintf(buf, "%d:", len(v))
+		buf.Write(v)
+	case RawMessage:
+		buf.Write(v)
+	case []string:
+		buf.WriteByte('l')
+		for _, s := range v {
+			fmt.Fprintf(buf, "%d:%s", len(s), s)
+		}
+		buf.WriteByte('e')
+	case []interface{}:
+		buf.WriteByte('l')
+		for _, e := range v {
+			if err := encode(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	case map[string]string:
+		dict := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			dict[k] = s
+		}
+		return encode(buf, dict)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('d')
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%d:%s", len(k), k)
+			if err := encode(buf, v[k]); err != nil {
+				return fmt.Errorf("key %q: %v", k, err)
+			}
+		}
+		buf.WriteByte('e')
+	default:
+		return fmt.Errorf("cannot bencode %T", v)
+	}
+
+	return nil
+}
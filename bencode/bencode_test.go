@@ -0,0 +1,111 @@
+package bencode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := map[string]interface{}{
+		"i42e":                    int64(42),
+		"i-3e":                    int64(-3),
+		"i0e":                     int64(0),
+		"4:spam":                  "spam",
+		"0:":                      "",
+		"le":                      []interface{}{},
+		"l4:spami7ee":             []interface{}{"spam", int64(7)},
+		"d3:cow3:moo4:spaml1:aee": map[string]interface{}{"cow": "moo", "spam": []interface{}{"a"}},
+	}
+	for data, want := range tests {
+		got, err := Decode([]byte(data))
+		if err != nil {
+			t.Fatalf("Could not decode %q: %v", data, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Got %#v for %q, want %#v", got, data, want)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []string{"", "i42", "ie", "i-0e", "i03e", "5:spam", "l4:spam", "d3:cowe", "di1e3:mooe", "i1ei2e", "x", "<html>"}
+	for _, data := range tests {
+		if _, err := Decode([]byte(data)); err == nil {
+			t.Fatalf("No error for %q", data)
+		}
+	}
+
+	// Deeply nested lists must not exhaust the stack
+	deep := make([]byte, 0, 2*100000)
+	for i := 0; i < 100000; i++ {
+		deep = append(deep, 'l')
+	}
+	for i := 0; i < 100000; i++ {
+		deep = append(deep, 'e')
+	}
+	if _, err := Decode(deep); err == nil {
+		t.Fatal("No error for deeply nested lists")
+	}
+}
+
+func TestDecodePrefix(t *testing.T) {
+	v, n, err := DecodePrefix([]byte("d1:ai1eeRAW DATA"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 8 || !reflect.DeepEqual(v, map[string]interface{}{"a": int64(1)}) {
+		t.Fatalf("Got %#v and %d", v, n)
+	}
+}
+
+func TestDictRaw(t *testing.T) {
+	raw, err := DictRaw([]byte("d8:announce3:url4:infod4:name1:x6:lengthi5eee"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw["info"]) != "d4:name1:x6:lengthi5ee" {
+		t.Fatalf("Got raw info %q", raw["info"])
+	}
+	if string(raw["announce"]) != "3:url" {
+		t.Fatalf("Got raw announce %q", raw["announce"])
+	}
+	if _, err := DictRaw([]byte("l1:ae")); err == nil {
+		t.Fatal("No error for a list")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	v := map[string]interface{}{
+		"spam":    []interface{}{"a", int64(-2), true},
+		"cow":     []byte("moo"),
+		"raw":     RawMessage("i1e"),
+		"strings": []string{"x", "yz"},
+	}
+	got, err := Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "d3:cow3:moo3:rawi1e4:spaml1:ai-2ei1ee7:stringsl1:x2:yzee"
+	if string(got) != want {
+		t.Fatalf("Got %q, want %q", got, want)
+	}
+
+	if _, err := Encode(3.14); err == nil {
+		t.Fatal("No error for a float")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := "d4:infod6:lengthi1024e4:name8:file.txt12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaaee"
+	v, err := Decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Fatalf("Got %q, want %q", got, data)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// config contains the user settings read from the configuration file.
+// The configuration file is a JSON document located at
+// <user config dir>/torrengo/config.json (e.g. ~/.config/torrengo/config.json
+// on Linux), unless the TORRENGO_CONFIG environment variable says otherwise.
+type config struct {
+	// Templates maps template names to Go text/template definitions used
+	// to render results
+	Templates map[string]string `json:"templates"`
+	// Filters are applied to the results of one-shot searches only (not the
+	// shell, batch or server modes), unless overridden by command line flags
+	Filters resultFilters `json:"filters"`
+	// Download are the settings of the built-in download engine
+	Download downloadConfig `json:"download"`
+	// Trackers are added to the magnets of the sources
+	Trackers trackersConfig `json:"trackers"`
+}
+
+// configPath returns the path of the configuration file
+func configPath() (string, error) {
+	if path := os.Getenv("TORRENGO_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find user config directory: %v", err)
+	}
+
+	return filepath.Join(dir, "torrengo", "config.json"), nil
+}
+
+// loadConfig reads the configuration file.
+// An empty configuration is returned if the file does not exist.
+func loadConfig() (config, error) {
+	var cfg config
+
+	path, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("could not read config file %v: %v", path, err)
+	}
+
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("could not parse config file %v: %v", path, err)
+	}
+
+	return cfg, nil
+}
@@ -6,40 +6,94 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/cdproto/dom"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 	"github.com/chromedp/chromedp/device"
+
+	"github.com/juliensalinas/torrengo/metainfo"
 )
 
 // UserAgent is a customer browser user agent used in every HTTP connections
 const UserAgent string = "Mozilla/5.0 (Windows NT 6.1; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/62.0.3202.62 Safari/537.36"
 
+// maxTorrentFileSize is the maximum size of the torrent files downloaded
+const maxTorrentFileSize = 10 << 20
+
 var cookieExpiry = time.Now().Add(10 * time.Minute)
 
+// browserCtx is the context of the browser shared by all fetches, if any.
+// See StartBrowser.
+var (
+	browserMu  sync.Mutex
+	browserCtx context.Context
+)
+
+// StartBrowser launches a Chrome browser which is then reused by all
+// subsequent calls to Fetch, each fetch opening a new tab.
+// This saves the Chrome startup time on each fetch and keeps cookies between
+// fetches, which is useful for long running programs.
+// The returned function closes the browser.
+func StartBrowser() (func(), error) {
+	ctx, cancel := chromedp.NewContext(context.Background())
+
+	// Running an empty list of actions launches the browser
+	err := chromedp.Run(ctx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("could not launch browser: %w", err)
+	}
+
+	browserMu.Lock()
+	browserCtx = ctx
+	browserMu.Unlock()
+
+	return func() {
+		browserMu.Lock()
+		browserCtx = nil
+		browserMu.Unlock()
+		cancel()
+	}, nil
+}
+
+// newTab returns a chromedp context to fetch a page with.
+// It is a new tab in the shared browser if StartBrowser was called, otherwise
+// a new browser. In both cases it is closed once ctx is done or cancel is
+// called.
+func newTab(ctx context.Context) (context.Context, context.CancelFunc) {
+	browserMu.Lock()
+	b := browserCtx
+	browserMu.Unlock()
+
+	if b == nil {
+		return chromedp.NewContext(ctx)
+	}
+
+	tabCtx, cancel := chromedp.NewContext(b)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-tabCtx.Done():
+		}
+	}()
+
+	return tabCtx, cancel
+}
+
 // DlFileWithoutChrome downloads the torrent with a custom client created by user and returns the path of
 // downloaded file.
 // The name of the downloaded file is made up of the search arguments + the
 // Unix timestamp to avoid collision. Ex: comte_de_montecristo_1581064034469619222.torrent
 func DlFileWithoutChrome(fileURL string, in string, client *http.Client) (string, error) {
-	// Get torrent file name from url
-	fileName := strings.Replace(in, " ", "_", -1)
-	fileName += "_" + strconv.Itoa(int(time.Now().UnixNano())) + ".torrent"
-
-	// Create local torrent file
-	out, err := os.Create(fileName)
-	if err != nil {
-		return "", fmt.Errorf("could not create the torrent file named %s: %v", fileName, err)
-	}
-	defer out.Close()
-
 	// Download torrent
 	req, err := http.NewRequest("GET", fileURL, nil)
 	if err != nil {
@@ -54,19 +108,49 @@ func DlFileWithoutChrome(fileURL string, in string, client *http.Client) (string
 		resp.Body.Close()
 		return "", fmt.Errorf("status code error: %d %s", resp.StatusCode, resp.Status)
 	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTorrentFileSize+1))
+	if err != nil {
+		return "", fmt.Errorf("could not download the torrent file: %v", err)
+	}
+	if len(data) > maxTorrentFileSize {
+		return "", fmt.Errorf("the downloaded file is too big to be a torrent file")
+	}
+
+	// Make sure this is a torrent and not, for example, an HTML login page
+	if _, err := metainfo.Parse(data); err != nil {
+		return "", fmt.Errorf("the downloaded file is not a valid torrent file: %v", err)
+	}
+
+	return SaveTorrentFile(data, in)
+}
+
+// SaveTorrentFile saves the content of a torrent file in the current working
+// directory, in a file named after in (usually the search arguments), and
+// returns the absolute path of the file.
+func SaveTorrentFile(data []byte, in string) (string, error) {
+	// Get torrent file name from the search arguments. Characters which are
+	// not allowed in file names on some OS, like the quotes and operators of
+	// the search syntax, are replaced too.
+	fileName := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, in)
+	fileName += "_" + strconv.Itoa(int(time.Now().UnixNano())) + ".torrent"
 
 	// Save torrent to disk
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
+	if err := ioutil.WriteFile(fileName, data, 0644); err != nil {
 		return "", fmt.Errorf("could not save the torrent file to disk: %v", err)
 	}
 
-	// Get absolute file path of torrent
-	dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
+	// Get absolute file path of torrent.
+	// The file was created in the current working directory.
+	filePath, err := filepath.Abs(fileName)
 	if err != nil {
-		return "", fmt.Errorf("could not retrieve current directory of saved filed: %v", err)
+		return "", fmt.Errorf("could not retrieve absolute path of saved file: %v", err)
 	}
-	filePath := dir + "/" + fileName
 
 	return filePath, nil
 }
@@ -107,7 +191,7 @@ func Fetch(ctx context.Context, url string, cookies []*http.Cookie) (string, []*
 	var newCDPCookies []*network.Cookie
 	var newCookies []*http.Cookie
 
-	ctx, cancel := chromedp.NewContext(ctx)
+	ctx, cancel := newTab(ctx)
 	defer cancel()
 
 	// TODO(juliensalinas): check status code of the response
@@ -186,11 +270,13 @@ func setCookies(ctx context.Context, cookies []*http.Cookie) chromedp.Action {
 		}
 
 		// Check that cookies were properly set.
+		// The browser may hold more cookies than the ones set here if it is
+		// shared with other fetches.
 		cookiesInBrowser, err := network.GetAllCookies().Do(ctx)
 		if err != nil {
 			return err
 		}
-		if len(cookiesInBrowser) != len(cookies) {
+		if len(cookiesInBrowser) < len(cookies) {
 			return fmt.Errorf("cookies not properly set")
 		}
 
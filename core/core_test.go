@@ -2,6 +2,11 @@ package core
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 )
@@ -17,3 +22,43 @@ func TestFetch(t *testing.T) {
 		t.Fatal("Website triggered a Cloudflare challenge while it shouldn't have.")
 	}
 }
+
+func TestDlFileWithoutChrome(t *testing.T) {
+	torrent := "d4:infod6:lengthi10e4:name5:x.txt12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaaee"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			fmt.Fprint(w, "<html><body>Please log in</body></html>")
+			return
+		}
+		fmt.Fprint(w, torrent)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "torrengo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	filePath, err := DlFileWithoutChrome(ts.URL+"/file.torrent", "x", ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filePath); err != nil || string(b) != torrent {
+		t.Fatalf("Wrong file content %q: %v", b, err)
+	}
+
+	if _, err := DlFileWithoutChrome(ts.URL+"/login", "y", ts.Client()); err == nil {
+		t.Fatal("No error for an HTML page")
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("Got %d files, an invalid torrent must not be saved", len(files))
+	}
+}
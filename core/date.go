@@ -0,0 +1,185 @@
+package core
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DatePrecision tells how precise a date parsed by ParseDate is
+type DatePrecision int
+
+// Date precisions, from the least to the most precise
+const (
+	// PrecisionUnknown means the date could not be parsed
+	PrecisionUnknown DatePrecision = iota
+	PrecisionDay
+	PrecisionHour
+	PrecisionMinute
+	PrecisionSecond
+)
+
+// String returns the name of the precision, used in machine-readable
+// outputs
+func (p DatePrecision) String() string {
+	switch p {
+	case PrecisionDay:
+		return "day"
+	case PrecisionHour:
+		return "hour"
+	case PrecisionMinute:
+		return "minute"
+	case PrecisionSecond:
+		return "second"
+	}
+	return "unknown"
+}
+
+// dateLayout is a layout of the dates displayed by the sources
+type dateLayout struct {
+	layout    string
+	precision DatePrecision
+	// isYearless is true if dates do not contain the year, which means the
+	// date is in the last 12 months
+	isYearless bool
+}
+
+// dateLayouts are the layouts of the absolute dates found on the sources
+var dateLayouts = []dateLayout{
+	// ygg
+	{"2006/01/02 15:04", PrecisionMinute, false},
+	// tpb
+	{"2006-01-02 15:04:05", PrecisionSecond, false},
+	{"2006-01-02 15:04", PrecisionMinute, false},
+	{"2006-01-02", PrecisionDay, false},
+	{"01-02 2006", PrecisionDay, false},
+	{"01-02 15:04", PrecisionMinute, true},
+	// otts
+	{"Jan. 2 '06", PrecisionDay, false},
+	{"Jan 2 '06", PrecisionDay, false},
+	{"Jan. 2 2006", PrecisionDay, false},
+	{"Jan 2 2006", PrecisionDay, false},
+	{"Jan. 2", PrecisionDay, true},
+	{"Jan 2", PrecisionDay, true},
+}
+
+// timeLayouts are the layouts of the times displayed by the sources for the
+// torrents uploaded today
+var timeLayouts = []dateLayout{
+	{"15:04", PrecisionMinute, true},
+	{"3:04pm", PrecisionMinute, true},
+	{"3pm", PrecisionHour, true},
+}
+
+// ordinalSuffix matches the ordinal suffixes of days like "3rd"
+var ordinalSuffix = regexp.MustCompile(`(\d)(st|nd|rd|th)\b`)
+
+// relativeDate matches relative dates like "3 hours ago" or "a day ago"
+var relativeDate = regexp.MustCompile(`^(\d+|an?|one)\s*(sec|second|min|minute|mins|hour|hr|day|week|month|year)s?\.?\s+ago$`)
+
+// relativeUnits maps the units of relative dates to their duration and the
+// precision of dates using them
+var relativeUnits = map[string]struct {
+	duration  time.Duration
+	precision DatePrecision
+}{
+	"sec":    {time.Second, PrecisionSecond},
+	"second": {time.Second, PrecisionSecond},
+	"min":    {time.Minute, PrecisionMinute},
+	"mins":   {time.Minute, PrecisionMinute},
+	"minute": {time.Minute, PrecisionMinute},
+	"hr":     {time.Hour, PrecisionHour},
+	"hour":   {time.Hour, PrecisionHour},
+	"day":    {24 * time.Hour, PrecisionDay},
+	"week":   {7 * 24 * time.Hour, PrecisionDay},
+	"month":  {30 * 24 * time.Hour, PrecisionDay},
+	"year":   {365 * 24 * time.Hour, PrecisionDay},
+}
+
+// ParseDate converts an upload date as displayed by the sources into a time,
+// in the local time zone.
+// Absolute dates like "2019-12-03 15:04" or "Dec. 3rd '19", dates without
+// year like "12-03 15:04" (then in the last 12 months), times of today like
+// "3pm", and relative dates like "3 hours ago", "Today 15:04" or
+// "Y-day 15:04" are supported.
+// now is the time relative dates are computed from.
+// PrecisionUnknown is returned if the date cannot be converted.
+func ParseDate(date string, now time.Time) (time.Time, DatePrecision) {
+	date = strings.Join(strings.Fields(date), " ")
+	date = ordinalSuffix.ReplaceAllString(date, "$1")
+	lowerDate := strings.ToLower(date)
+	now = now.In(time.Local)
+
+	// Relative dates
+	if m := relativeDate.FindStringSubmatch(lowerDate); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			// "a", "an" or "one"
+			n = 1
+		}
+		unit := relativeUnits[m[2]]
+		return now.Add(-time.Duration(n) * unit.duration), unit.precision
+	}
+
+	// Today and yesterday, with an optional time
+	for prefix, daysAgo := range map[string]int{"today": 0, "y-day": 1, "yesterday": 1} {
+		if !strings.HasPrefix(lowerDate, prefix) {
+			continue
+		}
+		day := now.AddDate(0, 0, -daysAgo)
+		rest := strings.TrimSpace(lowerDate[len(prefix):])
+		if rest == "" {
+			return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local), PrecisionDay
+		}
+		for _, l := range timeLayouts {
+			if t, err := time.Parse(l.layout, rest); err == nil {
+				return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, time.Local), l.precision
+			}
+		}
+		return time.Time{}, PrecisionUnknown
+	}
+
+	// Absolute dates
+	for _, l := range dateLayouts {
+		t, err := time.ParseInLocation(l.layout, date, time.Local)
+		if err != nil {
+			continue
+		}
+		if l.isYearless {
+			t = t.AddDate(now.Year()-t.Year(), 0, 0)
+			if t.After(now.AddDate(0, 0, 1)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+		return t, l.precision
+	}
+
+	// Times of today
+	for _, l := range timeLayouts {
+		t, err := time.Parse(l.layout, lowerDate)
+		if err != nil {
+			continue
+		}
+		t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+		if t.After(now) {
+			t = t.AddDate(0, 0, -1)
+		}
+		return t, l.precision
+	}
+
+	return time.Time{}, PrecisionUnknown
+}
+
+// FormatDate formats a date according to its precision, like "2019-12-03" or
+// "2019-12-03 15:04".
+// An empty string is returned for unknown dates.
+func FormatDate(t time.Time, precision DatePrecision) string {
+	switch precision {
+	case PrecisionDay:
+		return t.Format("2006-01-02")
+	case PrecisionHour, PrecisionMinute, PrecisionSecond:
+		return t.Format("2006-01-02 15:04")
+	}
+	return ""
+}
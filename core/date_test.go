@@ -0,0 +1,54 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2020, 3, 15, 12, 30, 0, 0, time.Local)
+	tests := []struct {
+		date      string
+		want      time.Time
+		precision DatePrecision
+	}{
+		{"2019/12/03 15:04", time.Date(2019, 12, 3, 15, 4, 0, 0, time.Local), PrecisionMinute},
+		{"2019-12-03", time.Date(2019, 12, 3, 0, 0, 0, 0, time.Local), PrecisionDay},
+		{"12-03 2019", time.Date(2019, 12, 3, 0, 0, 0, 0, time.Local), PrecisionDay},
+		{"Dec. 3rd '19", time.Date(2019, 12, 3, 0, 0, 0, 0, time.Local), PrecisionDay},
+		{"Mar. 1st", time.Date(2020, 3, 1, 0, 0, 0, 0, time.Local), PrecisionDay},
+		// Dates without year are in the past
+		{"Dec. 3rd", time.Date(2019, 12, 3, 0, 0, 0, 0, time.Local), PrecisionDay},
+		{"12-03 15:04", time.Date(2019, 12, 3, 15, 4, 0, 0, time.Local), PrecisionMinute},
+		{"12-03\u00a015:04", time.Date(2019, 12, 3, 15, 4, 0, 0, time.Local), PrecisionMinute},
+		{"3 hours ago", time.Date(2020, 3, 15, 9, 30, 0, 0, time.Local), PrecisionHour},
+		{"a day ago", time.Date(2020, 3, 14, 12, 30, 0, 0, time.Local), PrecisionDay},
+		{"5 mins ago", time.Date(2020, 3, 15, 12, 25, 0, 0, time.Local), PrecisionMinute},
+		{"Today 10:15", time.Date(2020, 3, 15, 10, 15, 0, 0, time.Local), PrecisionMinute},
+		{"Y-day 23:59", time.Date(2020, 3, 14, 23, 59, 0, 0, time.Local), PrecisionMinute},
+		{"9am", time.Date(2020, 3, 15, 9, 0, 0, 0, time.Local), PrecisionHour},
+		// Times later than now are yesterday's
+		{"10:45pm", time.Date(2020, 3, 14, 22, 45, 0, 0, time.Local), PrecisionMinute},
+		{"", time.Time{}, PrecisionUnknown},
+		{"Unknown", time.Time{}, PrecisionUnknown},
+	}
+	for _, test := range tests {
+		got, precision := ParseDate(test.date, now)
+		if !got.Equal(test.want) || precision != test.precision {
+			t.Fatalf("Got %v (%v) for %q, want %v (%v)", got, precision, test.date, test.want, test.precision)
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2019, 12, 3, 15, 4, 5, 0, time.Local)
+	if got := FormatDate(date, PrecisionDay); got != "2019-12-03" {
+		t.Fatalf("Got %q, want 2019-12-03", got)
+	}
+	if got := FormatDate(date, PrecisionSecond); got != "2019-12-03 15:04" {
+		t.Fatalf("Got %q, want 2019-12-03 15:04", got)
+	}
+	if got := FormatDate(date, PrecisionUnknown); got != "" {
+		t.Fatalf("Got %q for an unknown date, want an empty string", got)
+	}
+}
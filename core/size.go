@@ -0,0 +1,86 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// sizeUnits maps the size units found on the sources to their multiplier in
+// bytes. French units (octets) are supported too.
+var sizeUnits = map[string]float64{
+	"b":   1,
+	"o":   1,
+	"kb":  1e3,
+	"ko":  1e3,
+	"mb":  1e6,
+	"mo":  1e6,
+	"gb":  1e9,
+	"go":  1e9,
+	"tb":  1e12,
+	"to":  1e12,
+	"kib": 1 << 10,
+	"kio": 1 << 10,
+	"mib": 1 << 20,
+	"mio": 1 << 20,
+	"gib": 1 << 30,
+	"gio": 1 << 30,
+	"tib": 1 << 40,
+	"tio": 1 << 40,
+}
+
+// binaryUnits are the units used to format sizes
+var binaryUnits = []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+// ParseSize converts a human readable size like "1.4 GiB", "700 MB" or
+// "1,2Go" into a number of bytes.
+// Anything following the unit is ignored.
+// -1 is returned if the size cannot be converted.
+func ParseSize(size string) int64 {
+	size = strings.ToLower(strings.TrimSpace(strings.Replace(size, " ", " ", -1)))
+
+	// Split the number from the unit
+	i := strings.IndexFunc(size, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.' && r != ','
+	})
+	if i <= 0 {
+		return -1
+	}
+	number := strings.Replace(size[:i], ",", ".", 1)
+	unit := strings.TrimLeft(size[i:], " ")
+	if j := strings.IndexFunc(unit, func(r rune) bool { return !unicode.IsLetter(r) }); j >= 0 {
+		unit = unit[:j]
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return -1
+	}
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return -1
+	}
+
+	return int64(value * multiplier)
+}
+
+// FormatSize formats a number of bytes with binary units, like "1.4 GiB".
+// "Unknown" is returned for negative sizes.
+func FormatSize(bytes int64) string {
+	if bytes < 0 {
+		return "Unknown"
+	}
+
+	value := float64(bytes)
+	i := 0
+	for value >= 1024 && i < len(binaryUnits)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	return fmt.Sprintf("%.1f %s", value, binaryUnits[i])
+}
@@ -0,0 +1,40 @@
+package core
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"700 MB":     700e6,
+		"1.4 GiB":    1503238553,
+		"1,2Go":      1.2e9,
+		"350 Mo":     350e6,
+		"2 KiB":      2048,
+		"512 o":      512,
+		" 1.5 TB ":   1.5e12,
+		"1.4 GB1234": 1.4e9,
+		"Unknown":    -1,
+		"":           -1,
+		"12 parsecs": -1,
+		"1.2.3 GB":   -1,
+	}
+	for size, want := range tests {
+		if got := ParseSize(size); got != want {
+			t.Fatalf("Got %d for %q, want %d", got, size, want)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		-1:         "Unknown",
+		512:        "512 B",
+		1536:       "1.5 KiB",
+		1503238553: "1.4 GiB",
+		700e6:      "667.6 MiB",
+	}
+	for bytes, want := range tests {
+		if got := FormatSize(bytes); got != want {
+			t.Fatalf("Got %q for %d, want %q", got, bytes, want)
+		}
+	}
+}
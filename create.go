@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/juliensalinas/torrengo/core"
+	"github.com/juliensalinas/torrengo/magnet"
+	"github.com/juliensalinas/torrengo/metainfo"
+)
+
+// createdBy is the creator written in the torrent files built by torrengo
+const createdBy = "torrengo"
+
+// splitList splits a comma separated list, ignoring empty elements
+func splitList(list string) []string {
+	var elems []string
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			elems = append(elems, e)
+		}
+	}
+	return elems
+}
+
+// createCmd runs the create subcommand, which builds a torrent file from a
+// local file or directory and prints its magnet
+func createCmd(args []string) {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(
+			flags.Output(),
+			"Usage of %[1]s create:%[2]s%[2]s\t%[1]s create [-o file.torrent] [-piece-size size] [-trackers urls] [-web-seeds urls] "+
+				"[-private] [-comment comment] [-hybrid] [-v] path%[2]s%[2]s"+
+				"Builds a torrent file from a file or a directory, and prints its magnet. "+
+				"The torrent is named after the file or the directory.%[2]s%[2]s"+
+				"Options:%[2]s%[2]s",
+			os.Args[0], lineBreak,
+		)
+		flags.PrintDefaults()
+	}
+	output := flags.String("o", "", "Path of the torrent file. <name>.torrent in the current directory by default. Existing files are not overwritten.")
+	usrPieceSize := flags.String("piece-size", "", "Piece size, a power of two of at least 16KiB (e.g. 256KiB, 4MiB). "+
+		"Chosen from the size of the content by default.")
+	usrTrackers := flags.String("trackers", "", "Comma separated list of announce URLs, each one in its own tier.")
+	usrWebSeeds := flags.String("web-seeds", "", "Comma separated list of web seed URLs (BEP 19).")
+	isPrivate := flags.Bool("private", false, "Mark the torrent as private, so that peers are only found with its trackers.")
+	comment := flags.String("comment", "", "Comment of the torrent.")
+	isHybrid := flags.Bool("hybrid", false, "Build a hybrid torrent, which can be shared on both BitTorrent v1 and v2 swarms (BEP 52).")
+	isVerbosePtr := flags.Bool("v", false, "Verbose mode. Use it to see more logs.")
+	flags.Parse(args)
+
+	isVerbose = *isVerbosePtr
+	setLogger(isVerbose)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	opts := metainfo.CreateOptions{
+		WebSeeds:  splitList(*usrWebSeeds),
+		Private:   *isPrivate,
+		Comment:   *comment,
+		CreatedBy: createdBy,
+		IsHybrid:  *isHybrid,
+	}
+	if *usrPieceSize != "" {
+		if opts.PieceLength = core.ParseSize(*usrPieceSize); opts.PieceLength < 0 {
+			fmt.Fprintf(os.Stderr, "%v is not a valid piece size.%v", *usrPieceSize, lineBreak)
+			os.Exit(1)
+		}
+	}
+	for _, tr := range splitList(*usrTrackers) {
+		opts.Trackers = append(opts.Trackers, []string{tr})
+	}
+
+	path := flags.Arg(0)
+	log.WithFields(log.Fields{
+		"path":   path,
+		"hybrid": opts.IsHybrid,
+	}).Debug("Create torrent")
+	mi, err := metainfo.Create(path, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not create the torrent of %v: %v%v", path, err, lineBreak)
+		os.Exit(1)
+	}
+	data, err := mi.Bytes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not build the torrent file: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+
+	filePath := *output
+	if filePath == "" {
+		filePath = mi.Name + ".torrent"
+	}
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not save the torrent file: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Saved %v (%d pieces of %s)%v", filePath, len(mi.Pieces), core.FormatSize(mi.PieceLength), lineBreak)
+	fmt.Println(magnet.FromMetaInfo(mi).String())
+}
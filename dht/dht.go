@@ -0,0 +1,246 @@
+// Package dht finds the peers of torrents in the BitTorrent distributed hash
+// table (BEP 5).
+package dht
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+	"github.com/juliensalinas/torrengo/tracker"
+)
+
+// DefaultBootstrapNodes are well-known nodes searches start from
+var DefaultBootstrapNodes = []string{
+	"router.bittorrent.com:6881",
+	"dht.transmissionbt.com:6881",
+	"router.utorrent.com:6881",
+	"dht.libtorrent.org:25401",
+}
+
+// alpha is the number of nodes queried at each step of a search
+const alpha = 8
+
+// stepInterval is the time between two steps of a search
+const stepInterval = 100 * time.Millisecond
+
+// maxQueries is the maximum number of nodes queried by a search
+const maxQueries = 1000
+
+// idleTimeout is how long a search waits for answers when no node is left
+// to query
+const idleTimeout = 3 * time.Second
+
+// compactNodeLen is the length of a node in compact format: its ID, IPv4
+// address and port
+const compactNodeLen = 20 + net.IPv4len + 2
+
+// node is a DHT node
+type node struct {
+	id   [20]byte
+	addr *net.UDPAddr
+}
+
+// response is the answer of a node to a get_peers query
+type response struct {
+	nodes []node
+	peers []string
+}
+
+// GetPeers searches the DHT for the peers of the torrent with the given v1
+// infohash, starting from the given bootstrap nodes.
+// The addresses of peers, like "192.168.1.2:6881", are sent to peers as soon
+// as they are found, each one once.
+// The search goes on until ctx is done or no node is left to query. An error
+// is returned only if the search could not start.
+func GetPeers(ctx context.Context, infoHash [20]byte, bootstrapNodes []string, peers chan<- string) error {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return fmt.Errorf("could not open DHT connection: %v", err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		conn.Close()
+	}()
+
+	var nodeID [20]byte
+	if _, err := rand.Read(nodeID[:]); err != nil {
+		return fmt.Errorf("could not generate DHT node ID: %v", err)
+	}
+	var tid uint16
+	query := func(addr *net.UDPAddr) {
+		tid++
+		t := make([]byte, 2)
+		binary.BigEndian.PutUint16(t, tid)
+		msg, _ := bencode.Encode(map[string]interface{}{
+			"t": t,
+			"y": "q",
+			"q": "get_peers",
+			"a": map[string]interface{}{
+				"id":        nodeID[:],
+				"info_hash": infoHash[:],
+			},
+		})
+		conn.WriteTo(msg, addr)
+	}
+
+	queried := make(map[string]bool)
+	for _, n := range bootstrapNodes {
+		addr, err := net.ResolveUDPAddr("udp4", n)
+		if err != nil {
+			continue
+		}
+		queried[addr.String()] = true
+		query(addr)
+	}
+	if len(queried) == 0 {
+		return fmt.Errorf("could not reach any DHT bootstrap node")
+	}
+
+	responses := make(chan response)
+	go readResponses(conn, responses, stop)
+
+	candidates := make(map[string]node)
+	seenPeers := make(map[string]bool)
+	lastAnswer := time.Now()
+	ticker := time.NewTicker(stepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case r, ok := <-responses:
+			if !ok {
+				return nil
+			}
+			lastAnswer = time.Now()
+			for _, p := range r.peers {
+				if seenPeers[p] {
+					continue
+				}
+				seenPeers[p] = true
+				select {
+				case peers <- p:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+			for _, n := range r.nodes {
+				if key := n.addr.String(); !queried[key] {
+					candidates[key] = n
+				}
+			}
+		case <-ticker.C:
+			closest := closestNodes(candidates, infoHash, alpha)
+			if len(closest) == 0 || len(queried) >= maxQueries {
+				if time.Since(lastAnswer) > idleTimeout {
+					return nil
+				}
+				continue
+			}
+			for _, n := range closest {
+				key := n.addr.String()
+				delete(candidates, key)
+				queried[key] = true
+				query(n.addr)
+			}
+		}
+	}
+}
+
+// readResponses sends the answers received on conn to responses, until conn
+// is closed
+func readResponses(conn net.PacketConn, responses chan<- response, stop <-chan struct{}) {
+	defer close(responses)
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		r, err := parseResponse(buf[:n])
+		if err != nil {
+			continue
+		}
+		select {
+		case responses <- r:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// parseResponse parses the answer to a get_peers query
+func parseResponse(msg []byte) (response, error) {
+	v, err := bencode.Decode(msg)
+	if err != nil {
+		return response{}, err
+	}
+	dict, ok := v.(map[string]interface{})
+	if !ok || dict["y"] != "r" {
+		return response{}, fmt.Errorf("not a DHT response")
+	}
+	r, ok := dict["r"].(map[string]interface{})
+	if !ok {
+		return response{}, fmt.Errorf("invalid DHT response")
+	}
+
+	var resp response
+	if nodes, ok := r["nodes"].(string); ok {
+		for b := []byte(nodes); len(b) >= compactNodeLen; b = b[compactNodeLen:] {
+			var n node
+			copy(n.id[:], b)
+			n.addr = &net.UDPAddr{
+				IP:   net.IP(append([]byte(nil), b[20:20+net.IPv4len]...)),
+				Port: int(binary.BigEndian.Uint16(b[20+net.IPv4len:])),
+			}
+			if n.addr.Port != 0 {
+				resp.nodes = append(resp.nodes, n)
+			}
+		}
+	}
+	values, _ := r["values"].([]interface{})
+	for _, value := range values {
+		if peer, ok := value.(string); ok {
+			resp.peers = append(resp.peers, tracker.CompactPeers([]byte(peer), net.IPv4len)...)
+		}
+	}
+
+	return resp, nil
+}
+
+// closestNodes returns at most n nodes among candidates, the closest to
+// target first
+func closestNodes(candidates map[string]node, target [20]byte, n int) []node {
+	nodes := make([]node, 0, len(candidates))
+	for _, c := range candidates {
+		nodes = append(nodes, c)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return bytes.Compare(distance(nodes[i].id, target), distance(nodes[j].id, target)) < 0
+	})
+	if len(nodes) > n {
+		nodes = nodes[:n]
+	}
+	return nodes
+}
+
+// distance returns the XOR distance between two IDs
+func distance(a, b [20]byte) []byte {
+	d := make([]byte, len(a))
+	for i := range a {
+		d[i] = a[i] ^ b[i]
+	}
+	return d
+}
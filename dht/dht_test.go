@@ -0,0 +1,101 @@
+package dht
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+)
+
+var infoHash = [20]byte{1, 2, 3}
+
+// serveNode runs a stand-in DHT node which answers get_peers queries for
+// infoHash with the given response values
+func serveNode(t *testing.T, answer map[string]interface{}) *net.UDPAddr {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			v, err := bencode.Decode(buf[:n])
+			if err != nil {
+				continue
+			}
+			query, _ := v.(map[string]interface{})
+			args, _ := query["a"].(map[string]interface{})
+			if query["q"] != "get_peers" || args["info_hash"] != string(infoHash[:]) {
+				continue
+			}
+			resp, _ := bencode.Encode(map[string]interface{}{
+				"t": query["t"],
+				"y": "r",
+				"r": answer,
+			})
+			conn.WriteTo(resp, addr)
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr)
+}
+
+// compactNode returns the node with the given ID and address in compact
+// format
+func compactNode(id [20]byte, addr *net.UDPAddr) string {
+	port := make([]byte, 2)
+	binary.BigEndian.PutUint16(port, uint16(addr.Port))
+	return string(id[:]) + string(addr.IP.To4()) + string(port)
+}
+
+func TestGetPeers(t *testing.T) {
+	// The bootstrap node only knows a node close to infoHash, which knows
+	// the peers
+	closeNode := serveNode(t, map[string]interface{}{
+		"id":     string(make([]byte, 20)),
+		"token":  "x",
+		"values": []interface{}{string([]byte{10, 0, 0, 1, 0x1A, 0xE1}), string([]byte{10, 0, 0, 2, 0x1A, 0xE1})},
+	})
+	bootstrap := serveNode(t, map[string]interface{}{
+		"id":    string(make([]byte, 20)),
+		"nodes": compactNode([20]byte{1, 2}, closeNode),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	peers := make(chan string)
+	errs := make(chan error, 1)
+	go func() { errs <- GetPeers(ctx, infoHash, []string{bootstrap.String()}, peers) }()
+
+	found := make(map[string]bool)
+	for len(found) < 2 {
+		select {
+		case p := <-peers:
+			found[p] = true
+		case <-ctx.Done():
+			t.Fatalf("Found only peers %v", found)
+		}
+	}
+	if !found["10.0.0.1:6881"] || !found["10.0.0.2:6881"] {
+		t.Fatalf("Found peers %v", found)
+	}
+	cancel()
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetPeersNoBootstrapNode(t *testing.T) {
+	if err := GetPeers(context.Background(), infoHash, nil, make(chan string)); err == nil {
+		t.Fatal("No error without bootstrap nodes")
+	}
+}
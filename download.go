@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/juliensalinas/torrengo/core"
+	"github.com/juliensalinas/torrengo/dht"
+	"github.com/juliensalinas/torrengo/engine"
+	"github.com/juliensalinas/torrengo/magnet"
+	"github.com/juliensalinas/torrengo/metadata"
+	"github.com/juliensalinas/torrengo/metainfo"
+)
+
+// downloadConfig are the settings of the built-in download engine, read
+// from the config file
+type downloadConfig struct {
+	// Dir is the directory content is downloaded to
+	Dir string `json:"dir"`
+	// MaxDownloadRate and MaxUploadRate are sizes per second, like "2MB",
+	// unlimited if empty
+	MaxDownloadRate string `json:"maxDownloadRate"`
+	MaxUploadRate   string `json:"maxUploadRate"`
+	// SeedRatio is the ratio of uploaded bytes to the downloaded size after
+	// which seeding stops, no seeding if 0
+	SeedRatio float64 `json:"seedRatio"`
+	// SeedTime is the maximum duration of seeding, like "1h30m", unlimited
+	// if empty
+	SeedTime string `json:"seedTime"`
+	// Port is the port other peers connect to, random if 0
+	Port int `json:"port"`
+}
+
+// engineConfig converts the download settings into the configuration of
+// the engine
+func (c downloadConfig) engineConfig() (engine.Config, error) {
+	cfg := engine.Config{
+		Dir:            c.Dir,
+		SeedRatio:      c.SeedRatio,
+		Port:           c.Port,
+		BootstrapNodes: dht.DefaultBootstrapNodes,
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = "."
+	}
+	if c.MaxDownloadRate != "" {
+		if cfg.MaxDownloadRate = core.ParseSize(c.MaxDownloadRate); cfg.MaxDownloadRate < 0 {
+			return cfg, fmt.Errorf("%v is not a valid download rate", c.MaxDownloadRate)
+		}
+	}
+	if c.MaxUploadRate != "" {
+		if cfg.MaxUploadRate = core.ParseSize(c.MaxUploadRate); cfg.MaxUploadRate < 0 {
+			return cfg, fmt.Errorf("%v is not a valid upload rate", c.MaxUploadRate)
+		}
+	}
+	if c.SeedRatio < 0 {
+		return cfg, fmt.Errorf("%v is not a valid seed ratio", c.SeedRatio)
+	}
+	if c.SeedTime != "" {
+		d, err := time.ParseDuration(c.SeedTime)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("%v is not a valid seed time", c.SeedTime)
+		}
+		cfg.SeedTime = d
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return cfg, fmt.Errorf("%d is not a valid port", c.Port)
+	}
+
+	return cfg, nil
+}
+
+// downloadCmd runs the download subcommand, which downloads the content of a
+// torrent file or of a magnet link with the built-in engine
+func downloadCmd(args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Println("Could not load your config file (see logs for more details).")
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("Could not load config")
+	}
+	dc := cfg.Download
+
+	flags := flag.NewFlagSet("download", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(
+			flags.Output(),
+			"Usage of %[1]s download:%[2]s%[2]s\t%[1]s download [-d dir] [-files indexes | -list] [-max-down rate] [-max-up rate] "+
+				"[-ratio ratio] [-seed-time duration] [-port port] [-no-dht] [-t timeout] [-v] file.torrent|magnet%[2]s%[2]s"+
+				"Downloads the content of a torrent file or of a magnet link without an external torrent client, "+
+				"then seeds it until the upload ratio or the seed time is reached. "+
+				"Interrupted downloads are resumed from the data already in the directory.%[2]s%[2]s"+
+				"Options:%[2]s%[2]s",
+			os.Args[0], lineBreak,
+		)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&dc.Dir, "d", dc.Dir, "Directory the content is downloaded to (the current directory by default).")
+	usrFiles := flags.String("files", "", "Indexes of the files to download, like 0,2-4 (see -list). All files by default.")
+	isList := flags.Bool("list", false, "List the files of the torrent with their indexes, without downloading.")
+	flags.StringVar(&dc.MaxDownloadRate, "max-down", dc.MaxDownloadRate, "Maximum download rate per second (e.g. 2MB). Unlimited by default.")
+	flags.StringVar(&dc.MaxUploadRate, "max-up", dc.MaxUploadRate, "Maximum upload rate per second (e.g. 500KB). Unlimited by default.")
+	flags.Float64Var(&dc.SeedRatio, "ratio", dc.SeedRatio, "Seed until this ratio of uploaded bytes to the downloaded size is reached. "+
+		"Set it to 0 to stop once the download completes.")
+	flags.StringVar(&dc.SeedTime, "seed-time", dc.SeedTime, "Maximum seeding duration (e.g. 30m, 2h). Unlimited by default.")
+	flags.IntVar(&dc.Port, "port", dc.Port, "Port other peers connect to. Random by default.")
+	isNoDHT := flags.Bool("no-dht", false, "Only look for peers with the trackers of the torrent.")
+	timeoutInMillisec := flags.Int("t", int(defaultMetadataTimeout/time.Millisecond),
+		"Timeout of the metadata fetching of magnets in milliseconds. Set it to 0 to completely remove timeout.")
+	isVerbosePtr := flags.Bool("v", false, "Verbose mode. Use it to see more logs.")
+	flags.Parse(args)
+
+	isVerbose = *isVerbosePtr
+	setLogger(isVerbose)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	engineCfg, err := dc.engineConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not use your download settings: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+	if *isNoDHT {
+		engineCfg.BootstrapNodes = nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	arg := flags.Arg(0)
+	mi, err := loadTorrent(arg, &engineCfg, time.Duration(*timeoutInMillisec)*time.Millisecond)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read %v: %v%v", arg, err, lineBreak)
+		os.Exit(1)
+	}
+
+	if *isList {
+		for i, f := range mi.Files {
+			if !f.IsPadding {
+				fmt.Printf("%d\t%s\t%s%s", i, core.FormatSize(f.Length), path.Join(f.Path...), lineBreak)
+			}
+		}
+		return
+	}
+	if *usrFiles != "" {
+		engineCfg.Files, err = parseIndexes(*usrFiles, len(mi.Files))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not use -files: %v%v", err, lineBreak)
+			os.Exit(1)
+		}
+	}
+
+	if err := downloadTorrent(ctx, mi, engineCfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not download %v: %v%v", mi.Name, err, lineBreak)
+		log.WithFields(log.Fields{
+			"arg":   arg,
+			"error": err,
+		}).Debug("Could not download torrent")
+		os.Exit(1)
+	}
+}
+
+// loadTorrent reads a local torrent file, or fetches the metadata of a magnet
+// link from peers. The peers of magnets are added to cfg.Peers. The DHT is
+// used from cfg.BootstrapNodes.
+func loadTorrent(arg string, cfg *engine.Config, timeout time.Duration) (*metainfo.MetaInfo, error) {
+	if !strings.HasPrefix(strings.ToLower(arg), "magnet:") {
+		return metainfo.Load(arg)
+	}
+
+	m, err := magnet.Parse(arg)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse magnet: %v", err)
+	}
+	fmt.Fprintln(os.Stderr, "Fetching torrent metadata from peers, this can take a while...")
+	mi, err := metadata.Resolve(m, cfg.BootstrapNodes, timeout)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Peers = append(cfg.Peers, m.Peers...)
+
+	return mi, nil
+}
+
+// downloadTorrent downloads the content of mi with the built-in engine,
+// displaying its progress on stderr
+func downloadTorrent(ctx context.Context, mi *metainfo.MetaInfo, cfg engine.Config) error {
+	log.WithFields(log.Fields{
+		"name":     mi.Name,
+		"infoHash": mi.InfoHashHex(),
+		"dir":      cfg.Dir,
+	}).Debug("Download torrent")
+	cfg.Progress = func(p engine.Progress) {
+		fmt.Fprintf(os.Stderr, "\r\033[K%s", formatProgress(mi.Name, p))
+	}
+	err := engine.Download(ctx, mi, cfg)
+	fmt.Fprint(os.Stderr, lineBreak)
+
+	return err
+}
+
+// formatProgress returns the state of the download of the torrent name on
+// one line
+func formatProgress(name string, p engine.Progress) string {
+	percent := 100.0
+	if p.Total > 0 {
+		percent = float64(p.Completed) * 100 / float64(p.Total)
+	}
+	state := fmt.Sprintf("%.1f%% of %s", percent, core.FormatSize(p.Total))
+	if p.IsSeeding {
+		state = fmt.Sprintf("seeding, %s uploaded", core.FormatSize(p.Uploaded))
+	}
+
+	return fmt.Sprintf("%s: %s, %s/s down, %s/s up, %d peers",
+		name, state, core.FormatSize(p.DownloadRate), core.FormatSize(p.UploadRate), p.Peers)
+}
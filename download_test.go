@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juliensalinas/torrengo/engine"
+)
+
+func TestEngineConfig(t *testing.T) {
+	cfg, err := downloadConfig{
+		MaxDownloadRate: "2MB",
+		MaxUploadRate:   "512 KiB",
+		SeedRatio:       1.5,
+		SeedTime:        "1h30m",
+		Port:            6881,
+	}.engineConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Dir != "." || cfg.MaxDownloadRate != 2000000 || cfg.MaxUploadRate != 512*1024 ||
+		cfg.SeedRatio != 1.5 || cfg.SeedTime != 90*time.Minute || cfg.Port != 6881 {
+		t.Fatalf("Got config %+v", cfg)
+	}
+
+	for _, dc := range []downloadConfig{
+		{MaxDownloadRate: "fast"},
+		{MaxUploadRate: "-1MB"},
+		{SeedRatio: -1},
+		{SeedTime: "2 days"},
+		{Port: 70000},
+	} {
+		if _, err := dc.engineConfig(); err == nil {
+			t.Fatalf("No error for %+v", dc)
+		}
+	}
+}
+
+func TestFormatProgress(t *testing.T) {
+	p := engine.Progress{Total: 2048, Completed: 512, DownloadRate: 1536, Peers: 3}
+	if got, want := formatProgress("Dumas", p), "Dumas: 25.0% of 2.0 KiB, 1.5 KiB/s down, 0 B/s up, 3 peers"; got != want {
+		t.Fatalf("Got %q, want %q", got, want)
+	}
+	p.IsSeeding = true
+	p.Uploaded = 4096
+	if got, want := formatProgress("Dumas", p), "Dumas: seeding, 4.0 KiB uploaded, 1.5 KiB/s down, 0 B/s up, 3 peers"; got != want {
+		t.Fatalf("Got %q, want %q", got, want)
+	}
+}
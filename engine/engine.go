@@ -0,0 +1,470 @@
+// Package engine downloads and seeds torrents, so that content can be
+// downloaded without an external torrent client.
+// Only torrents with v1 pieces, including hybrid torrents, are supported.
+package engine
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/juliensalinas/torrengo/metainfo"
+	"github.com/juliensalinas/torrengo/storage"
+	"github.com/juliensalinas/torrengo/swarm"
+)
+
+// maxPeers is the maximum number of peers connected at the same time
+const maxPeers = 40
+
+// reannounceInterval is the time between two lookups of peers
+const reannounceInterval = 2 * time.Minute
+
+// progressInterval is the time between two progress reports
+const progressInterval = time.Second
+
+// Config are the settings of a download
+type Config struct {
+	// Dir is the directory the content is downloaded to
+	Dir string
+	// Files are the indexes of the files of the torrent to download, all of
+	// them if empty
+	Files []int
+	// MaxDownloadRate and MaxUploadRate are in bytes per second, unlimited
+	// if 0
+	MaxDownloadRate int64
+	MaxUploadRate   int64
+	// SeedRatio is the ratio of uploaded bytes to the size of the
+	// downloaded files after which seeding stops. Downloads stop as soon
+	// as they complete if 0.
+	SeedRatio float64
+	// SeedTime is the maximum duration of seeding, unlimited if 0
+	SeedTime time.Duration
+	// Port is the TCP port other peers connect to, random if 0
+	Port int
+	// Peers are the addresses of peers known beforehand, like the ones of
+	// magnets
+	Peers []string
+	// BootstrapNodes are the DHT nodes the search of peers starts from. The
+	// DHT is not used if empty.
+	BootstrapNodes []string
+	// Progress, if set, is called every second with the state of the
+	// download
+	Progress func(Progress)
+}
+
+// Progress is the state of a download
+type Progress struct {
+	// Total is the size of the downloaded files
+	Total int64
+	// Completed is the number of bytes of the downloaded files which were
+	// received and checked
+	Completed int64
+	// Downloaded and Uploaded are the numbers of bytes exchanged with peers
+	Downloaded int64
+	Uploaded   int64
+	// DownloadRate and UploadRate are in bytes per second
+	DownloadRate int64
+	UploadRate   int64
+	// Peers is the number of connected peers
+	Peers     int
+	IsSeeding bool
+}
+
+// Download downloads the files of the torrent mi into cfg.Dir, and then
+// seeds them according to cfg.SeedRatio and cfg.SeedTime.
+// Data already in cfg.Dir are checked and kept, so that interrupted downloads
+// can be resumed.
+// Download returns when seeding ends. An error is returned if ctx is done
+// before the download completes.
+func Download(ctx context.Context, mi *metainfo.MetaInfo, cfg Config) error {
+	if !mi.HasV1() {
+		return fmt.Errorf("only torrents with v1 pieces can be downloaded")
+	}
+	selected, err := selectFiles(mi, cfg.Files)
+	if err != nil {
+		return err
+	}
+	peerID, err := swarm.NewPeerID()
+	if err != nil {
+		return err
+	}
+	store := storage.New(mi, cfg.Dir, selected)
+	defer store.Close()
+
+	t := newTorrent(mi, store, peerID, cfg)
+	t.checkPieces()
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+	if err != nil {
+		return fmt.Errorf("could not listen for peers: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		l.Close()
+		wg.Wait()
+	}()
+
+	// Accept the connections of other peers
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			addr := conn.RemoteAddr().String()
+			if !t.addPeer(addr) {
+				conn.Close()
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				t.runPeer(ctx, conn, addr)
+			}()
+		}
+	}()
+
+	// Look for peers and connect to them, regularly as they come and go
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			peers := swarm.FindPeers(ctx, t.infoHash, peerID, uint16(port), cfg.Peers, mi.AnnounceURLs(), cfg.BootstrapNodes)
+			for addr := range peers {
+				if !t.addPeer(addr) {
+					continue
+				}
+				wg.Add(1)
+				go func(addr string) {
+					defer wg.Done()
+					t.connect(ctx, addr)
+				}(addr)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(reannounceInterval):
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	complete := t.complete
+	var seedStart time.Time
+	var last Progress
+	lastTime := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			if !seedStart.IsZero() {
+				return nil
+			}
+			return fmt.Errorf("download interrupted")
+		case <-complete:
+			complete = nil
+			if err := store.CreateEmptyFiles(); err != nil {
+				return fmt.Errorf("could not create empty files: %v", err)
+			}
+			if cfg.SeedRatio <= 0 {
+				t.report(&last, time.Since(lastTime))
+				return nil
+			}
+			seedStart = time.Now()
+			t.setSeeding()
+		case <-ticker.C:
+			p := t.report(&last, time.Since(lastTime))
+			lastTime = time.Now()
+			if seedStart.IsZero() {
+				continue
+			}
+			if float64(p.Uploaded) >= cfg.SeedRatio*float64(p.Total) ||
+				(cfg.SeedTime > 0 && time.Since(seedStart) >= cfg.SeedTime) {
+				return nil
+			}
+		}
+	}
+}
+
+// selectFiles converts the indexes of the files to download into the
+// selection of storage.New
+func selectFiles(mi *metainfo.MetaInfo, files []int) ([]bool, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	selected := make([]bool, len(mi.Files))
+	for _, i := range files {
+		if i < 0 || i >= len(mi.Files) || mi.Files[i].IsPadding {
+			return nil, fmt.Errorf("no file %d in torrent", i)
+		}
+		selected[i] = true
+	}
+	return selected, nil
+}
+
+// torrent is the shared state of a download
+type torrent struct {
+	infoHash [20]byte
+	peerID   [20]byte
+	pieces   [][20]byte
+	store    *storage.Storage
+	down     *limiter
+	up       *limiter
+	progress func(Progress)
+	// wanted pieces hold data of the selected files
+	wanted []bool
+	// stored pieces are fully written to disk, so they can be uploaded
+	stored []bool
+	total  int64
+	// complete is closed once all wanted pieces are received
+	complete chan struct{}
+
+	mu sync.Mutex
+	// have are the received and checked pieces
+	have []bool
+	// haves are the stored pieces in the order they were received, to tell
+	// peers about them
+	haves []int
+	// inProgress is the number of peers downloading each piece
+	inProgress []int
+	remaining  int
+	completed  int64
+	downloaded int64
+	uploaded   int64
+	peers      map[string]bool
+	connected  int
+	isSeeding  bool
+}
+
+// newTorrent returns the state of the download of mi
+func newTorrent(mi *metainfo.MetaInfo, store *storage.Storage, peerID [20]byte, cfg Config) *torrent {
+	n := store.NumPieces()
+	t := &torrent{
+		infoHash:   mi.InfoHash,
+		peerID:     peerID,
+		pieces:     mi.Pieces,
+		store:      store,
+		down:       &limiter{rate: cfg.MaxDownloadRate},
+		up:         &limiter{rate: cfg.MaxUploadRate},
+		progress:   cfg.Progress,
+		wanted:     make([]bool, n),
+		stored:     make([]bool, n),
+		complete:   make(chan struct{}),
+		have:       make([]bool, n),
+		inProgress: make([]int, n),
+		peers:      make(map[string]bool),
+	}
+	for i := 0; i < n; i++ {
+		if length := store.SelectedLength(i); length > 0 {
+			t.wanted[i] = true
+			t.total += length
+			t.remaining++
+		}
+		t.stored[i] = t.wanted[i] && store.IsStored(i)
+	}
+	if t.remaining == 0 {
+		close(t.complete)
+	}
+
+	return t
+}
+
+// checkPieces looks for the stored pieces already on disk, from a previous
+// download
+func (t *torrent) checkPieces() {
+	for i := range t.pieces {
+		if !t.stored[i] {
+			continue
+		}
+		if ok, err := t.store.CheckPiece(i, t.pieces[i]); err == nil && ok {
+			t.setHave(i)
+		}
+	}
+}
+
+// pieceDone checks the data of piece i received from a peer and writes them
+// to disk
+func (t *torrent) pieceDone(i int, data []byte) error {
+	if sha1.Sum(data) != t.pieces[i] {
+		return fmt.Errorf("piece %d does not match its hash", i)
+	}
+	off, _ := t.store.PieceBounds(i)
+	if err := t.store.WriteAt(data, off); err != nil {
+		return fmt.Errorf("could not write piece %d: %v", i, err)
+	}
+	t.setHave(i)
+	return nil
+}
+
+// setHave marks piece i as received
+func (t *torrent) setHave(i int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.have[i] || !t.wanted[i] {
+		return
+	}
+	t.have[i] = true
+	if t.stored[i] {
+		t.haves = append(t.haves, i)
+	}
+	t.completed += t.store.SelectedLength(i)
+	t.remaining--
+	if t.remaining == 0 {
+		close(t.complete)
+	}
+}
+
+// pickPiece chooses a piece to download among the ones a peer has, marks it
+// as in progress and returns it, or returns -1 if there is none.
+// Pieces nobody downloads are preferred. Once they are all in progress, the
+// last pieces are downloaded from several peers at the same time, so that
+// slow peers do not delay the end of the download.
+func (t *torrent) pickPiece(has []bool) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	best := -1
+	for i := range t.pieces {
+		if !t.wanted[i] || t.have[i] || !has[i] {
+			continue
+		}
+		if best < 0 || t.inProgress[i] < t.inProgress[best] {
+			best = i
+		}
+		if t.inProgress[i] == 0 {
+			break
+		}
+	}
+	if best >= 0 {
+		t.inProgress[best]++
+	}
+	return best
+}
+
+// releasePiece marks piece i as no longer downloaded by a peer
+func (t *torrent) releasePiece(i int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inProgress[i]--
+}
+
+// isInterestedIn reports whether a peer which has the given pieces has
+// pieces we want
+func (t *torrent) isInterestedIn(has []bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.pieces {
+		if t.wanted[i] && !t.have[i] && has[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPiece reports whether piece i was received
+func (t *torrent) hasPiece(i int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.have[i]
+}
+
+// canUpload reports whether piece i can be sent to peers
+func (t *torrent) canUpload(i int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return i >= 0 && i < len(t.have) && t.have[i] && t.stored[i]
+}
+
+// havesSince returns the pieces which can be sent to peers, received since
+// the n first ones, and the total number of such pieces
+func (t *torrent) havesSince(n int) ([]int, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]int(nil), t.haves[n:]...), len(t.haves)
+}
+
+// isComplete reports whether all wanted pieces were received
+func (t *torrent) isComplete() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.remaining == 0
+}
+
+// addTransferred counts bytes received from and sent to peers
+func (t *torrent) addTransferred(downloaded, uploaded int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.downloaded += int64(downloaded)
+	t.uploaded += int64(uploaded)
+}
+
+// addPeer registers a peer before connecting to it. It returns false if the
+// peer is already connected or if there are too many peers.
+func (t *torrent) addPeer(addr string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.peers[addr] || len(t.peers) >= maxPeers {
+		return false
+	}
+	t.peers[addr] = true
+	return true
+}
+
+// removePeer unregisters a peer
+func (t *torrent) removePeer(addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.peers, addr)
+}
+
+// setConnected counts peers which completed their handshake
+func (t *torrent) setConnected(delta int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connected += delta
+}
+
+// setSeeding marks the download as complete and seeding
+func (t *torrent) setSeeding() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.isSeeding = true
+}
+
+// report calls the progress function with the current state of the
+// download. Rates are computed from last, the previous report, which is then
+// updated.
+func (t *torrent) report(last *Progress, elapsed time.Duration) Progress {
+	t.mu.Lock()
+	p := Progress{
+		Total:      t.total,
+		Completed:  t.completed,
+		Downloaded: t.downloaded,
+		Uploaded:   t.uploaded,
+		Peers:      t.connected,
+		IsSeeding:  t.isSeeding,
+	}
+	t.mu.Unlock()
+
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		p.DownloadRate = int64(float64(p.Downloaded-last.Downloaded) / seconds)
+		p.UploadRate = int64(float64(p.Uploaded-last.Uploaded) / seconds)
+	}
+	*last = p
+	if t.progress != nil {
+		t.progress(p)
+	}
+	return p
+}
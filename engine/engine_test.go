@@ -0,0 +1,197 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/juliensalinas/torrengo/metainfo"
+	"github.com/juliensalinas/torrengo/storage"
+)
+
+// testPieceLength is the piece length of the test torrent
+const testPieceLength = 32 * 1024
+
+// testTorrent writes the content of a multi-file torrent of about 300KB in
+// dir and returns its metainfo
+func testTorrent(t *testing.T, dir string) *metainfo.MetaInfo {
+	mi := &metainfo.MetaInfo{
+		Name:  "data",
+		IsDir: true,
+		Files: []metainfo.File{
+			{Path: []string{"a.bin"}, Length: 100000},
+			{Path: []string{"b", "c.bin"}, Length: 150001},
+			{Path: []string{"d.bin"}, Length: 50000},
+		},
+		PieceLength: testPieceLength,
+		InfoHash:    sha1.Sum([]byte("test torrent")),
+	}
+	content := make([]byte, 0, 300001)
+	for i := 0; len(content) < cap(content); i++ {
+		content = append(content, byte(i*7+i/251))
+	}
+	mi.TotalLength = int64(len(content))
+	for off := 0; off < len(content); off += testPieceLength {
+		end := off + testPieceLength
+		if end > len(content) {
+			end = len(content)
+		}
+		mi.Pieces = append(mi.Pieces, sha1.Sum(content[off:end]))
+	}
+
+	s := storage.New(mi, dir, nil)
+	defer s.Close()
+	if err := s.WriteAt(content, 0); err != nil {
+		t.Fatal(err)
+	}
+	return mi
+}
+
+// freePort returns a TCP port nobody listens on
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// sameFile fails if the file at path in the directories a and b differ
+func sameFile(t *testing.T, a, b string, path ...string) {
+	want, err := os.ReadFile(filepath.Join(append([]string{a}, path...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(append([]string{b}, path...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%v differs", path)
+	}
+}
+
+// seed seeds the content of mi in dir until its size was uploaded once. It
+// returns once the seeder accepts connections.
+func seed(t *testing.T, ctx context.Context, mi *metainfo.MetaInfo, dir string) (int, <-chan error) {
+	port := freePort(t)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- Download(ctx, mi, Config{Dir: dir, Port: port, SeedRatio: 1})
+	}()
+	for {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			conn.Close()
+			return port, errs
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal(err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	seedDir := t.TempDir()
+	mi := testTorrent(t, seedDir)
+	port, seedErrs := seed(t, ctx, mi, seedDir)
+
+	dir := t.TempDir()
+	var last Progress
+	err := Download(ctx, mi, Config{
+		Dir:      dir,
+		Peers:    []string{fmt.Sprintf("127.0.0.1:%d", port)},
+		Progress: func(p Progress) { last = p },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameFile(t, seedDir, dir, "data", "a.bin")
+	sameFile(t, seedDir, dir, "data", "b", "c.bin")
+	sameFile(t, seedDir, dir, "data", "d.bin")
+	if last.Completed != mi.TotalLength || last.Total != mi.TotalLength || last.Downloaded < mi.TotalLength {
+		t.Fatalf("Got progress %+v", last)
+	}
+
+	// The seeder stops once it uploaded the whole content
+	if err := <-seedErrs; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadSelectedFiles(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	seedDir := t.TempDir()
+	mi := testTorrent(t, seedDir)
+	port, seedErrs := seed(t, ctx, mi, seedDir)
+	defer func() {
+		cancel()
+		<-seedErrs
+	}()
+
+	dir := t.TempDir()
+	err := Download(ctx, mi, Config{
+		Dir:   dir,
+		Files: []int{2},
+		Peers: []string{fmt.Sprintf("127.0.0.1:%d", port)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameFile(t, seedDir, dir, "data", "d.bin")
+	if _, err := os.Stat(filepath.Join(dir, "data", "a.bin")); !os.IsNotExist(err) {
+		t.Fatal("Unselected file was downloaded")
+	}
+
+	if err := Download(ctx, mi, Config{Dir: dir, Files: []int{3}}); err == nil {
+		t.Fatal("No error for a missing file")
+	}
+}
+
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	mi := testTorrent(t, dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var last Progress
+	err := Download(ctx, mi, Config{Dir: dir, Progress: func(p Progress) { last = p }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Completed != mi.TotalLength || last.Downloaded != 0 {
+		t.Fatalf("Got progress %+v", last)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := &limiter{rate: 1 << 20}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.wait(context.Background(), 256*1024); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first transfer starts at once and the next ones wait 250ms each
+	if elapsed := time.Since(start); elapsed < 450*time.Millisecond {
+		t.Fatalf("3 transfers took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx, 1<<20); err == nil {
+		t.Fatal("No error when the context is done")
+	}
+}
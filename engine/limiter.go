@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter limits a transfer rate. Transfers are scheduled one after the
+// other, so that unused bandwidth is not saved up for bursts.
+type limiter struct {
+	// rate is in bytes per second, unlimited if 0
+	rate int64
+
+	mu sync.Mutex
+	// next is when the next transfer may start
+	next time.Time
+}
+
+// wait waits until n bytes may be transferred, or until ctx is done
+func (l *limiter) wait(ctx context.Context, n int) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	start := l.next
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	l.mu.Unlock()
+
+	d := time.Until(start)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
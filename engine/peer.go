@@ -0,0 +1,407 @@
+package engine
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/juliensalinas/torrengo/swarm"
+)
+
+// dialTimeout is the maximum time to connect to a peer and exchange
+// handshakes
+const dialTimeout = 10 * time.Second
+
+// writeTimeout is the maximum time to send a message to a peer
+const writeTimeout = 30 * time.Second
+
+// tickInterval is the time between two checks of the state of a peer
+const tickInterval = time.Second
+
+// keepAliveInterval is the time after which a keep-alive is sent to peers
+// nothing was sent to
+const keepAliveInterval = 2 * time.Minute
+
+// snubTimeout is the time after which peers which do not send the requested
+// blocks are dropped
+const snubTimeout = time.Minute
+
+// maxOutstanding is the maximum number of blocks requested from a peer and
+// not received yet
+const maxOutstanding = 10
+
+// maxRequestLen is the maximum length of the blocks peers may request
+const maxRequestLen = 128 * 1024
+
+// message is a message received from a peer
+type message struct {
+	id      byte
+	payload []byte
+}
+
+// peer is a connection to a peer
+type peer struct {
+	ctx  context.Context
+	t    *torrent
+	conn net.Conn
+	// has are the pieces the peer has
+	has []bool
+	// isChoked and isInterested are our state towards the peer, while
+	// isPeerChoked and isPeerInterested are the one of the peer
+	isChoked         bool
+	isInterested     bool
+	isPeerChoked     bool
+	isPeerInterested bool
+	// piece is the piece downloaded from the peer, -1 if none
+	piece       int
+	data        []byte
+	requested   []bool
+	received    []bool
+	outstanding int
+	lastBlock   time.Time
+	lastWrite   time.Time
+	// sentHaves is the number of our pieces the peer was told about
+	sentHaves int
+}
+
+// connect connects to the peer at addr and exchanges messages with it until
+// the connection ends
+func (t *torrent) connect(ctx context.Context, addr string) {
+	d := net.Dialer{Timeout: dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		t.removePeer(addr)
+		return
+	}
+	t.runPeer(ctx, conn, addr)
+}
+
+// runPeer exchanges messages with the peer at addr on conn until the
+// connection ends or ctx is done
+func (t *torrent) runPeer(ctx context.Context, conn net.Conn, addr string) {
+	defer t.removePeer(addr)
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	remoteID, _, err := swarm.Handshake(conn, conn, t.infoHash, t.peerID)
+	if err != nil || remoteID == t.peerID {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	t.setConnected(1)
+	defer t.setConnected(-1)
+
+	p := &peer{
+		ctx:          ctx,
+		t:            t,
+		conn:         conn,
+		has:          make([]bool, len(t.pieces)),
+		isChoked:     true,
+		isPeerChoked: true,
+		piece:        -1,
+	}
+	defer p.abandonPiece()
+	p.run(done)
+}
+
+// run reads the messages of the peer and answers them
+func (p *peer) run(done <-chan struct{}) {
+	msgs := make(chan message)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			id, payload, err := swarm.ReadMessage(p.conn)
+			if err == nil && id == swarm.MsgPiece {
+				err = p.t.down.wait(p.ctx, len(payload))
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case msgs <- message{id, payload}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if err := p.sendBitfield(); err != nil {
+		return
+	}
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-errs:
+			return
+		case m := <-msgs:
+			err = p.handle(m)
+		case <-ticker.C:
+			err = p.tick()
+		}
+		if err == nil {
+			err = p.update()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle handles a message of the peer
+func (p *peer) handle(m message) error {
+	switch m.id {
+	case swarm.MsgChoke:
+		p.isChoked = true
+		// Pending requests are discarded by the peer
+		for b := range p.requested {
+			p.requested[b] = p.received[b]
+		}
+		p.outstanding = 0
+	case swarm.MsgUnchoke:
+		p.isChoked = false
+	case swarm.MsgInterested:
+		p.isPeerInterested = true
+		if p.isPeerChoked {
+			p.isPeerChoked = false
+			return p.send(swarm.MsgUnchoke, nil)
+		}
+	case swarm.MsgNotInterested:
+		p.isPeerInterested = false
+	case swarm.MsgHave:
+		if len(m.payload) != 4 {
+			return fmt.Errorf("invalid have message")
+		}
+		i := int(binary.BigEndian.Uint32(m.payload))
+		if i >= len(p.has) {
+			return fmt.Errorf("invalid piece %d", i)
+		}
+		p.has[i] = true
+	case swarm.MsgBitfield:
+		if len(m.payload) < (len(p.has)+7)/8 {
+			return fmt.Errorf("invalid bitfield message")
+		}
+		for i := range p.has {
+			p.has[i] = m.payload[i/8]&(0x80>>(i%8)) != 0
+		}
+	case swarm.MsgRequest:
+		return p.upload(m.payload)
+	case swarm.MsgPiece:
+		return p.receive(m.payload)
+	}
+	return nil
+}
+
+// upload sends the block requested by the peer
+func (p *peer) upload(payload []byte) error {
+	if len(payload) != 12 {
+		return fmt.Errorf("invalid request message")
+	}
+	i := int(binary.BigEndian.Uint32(payload))
+	begin := int64(binary.BigEndian.Uint32(payload[4:]))
+	length := int64(binary.BigEndian.Uint32(payload[8:]))
+	if p.isPeerChoked || !p.t.canUpload(i) {
+		return nil
+	}
+	off, pieceLen := p.t.store.PieceBounds(i)
+	if length > maxRequestLen || begin+length > pieceLen {
+		return fmt.Errorf("invalid request of piece %d", i)
+	}
+
+	block := make([]byte, 8+length)
+	copy(block, swarm.Uint32s(i, int(begin)))
+	if err := p.t.store.ReadAt(block[8:], off+begin); err != nil {
+		return err
+	}
+	if err := p.t.up.wait(p.ctx, len(block)); err != nil {
+		return err
+	}
+	if err := p.send(swarm.MsgPiece, block); err != nil {
+		return err
+	}
+	p.t.addTransferred(0, int(length))
+	return nil
+}
+
+// receive stores a block of the downloaded piece, and checks and writes the
+// piece once complete
+func (p *peer) receive(payload []byte) error {
+	if len(payload) < 8 {
+		return fmt.Errorf("invalid piece message")
+	}
+	p.t.addTransferred(len(payload)-8, 0)
+	i := int(binary.BigEndian.Uint32(payload))
+	begin := int(binary.BigEndian.Uint32(payload[4:]))
+	block := payload[8:]
+	// Blocks of other pieces may be late answers to cancelled requests
+	if i != p.piece || begin%swarm.BlockLen != 0 || begin+len(block) > len(p.data) {
+		return nil
+	}
+	b := begin / swarm.BlockLen
+	if p.received[b] || !p.requested[b] || len(block) != p.blockLen(b) {
+		return nil
+	}
+	copy(p.data[begin:], block)
+	p.received[b] = true
+	p.outstanding--
+	p.lastBlock = time.Now()
+
+	for _, isReceived := range p.received {
+		if !isReceived {
+			return nil
+		}
+	}
+	if !p.t.hasPiece(i) {
+		if err := p.t.pieceDone(i, p.data); err != nil {
+			return err
+		}
+	}
+	p.abandonPiece()
+	return nil
+}
+
+// tick tells the peer about our new pieces, drops it if it is useless and
+// keeps the connection alive
+func (p *peer) tick() error {
+	haves, n := p.t.havesSince(p.sentHaves)
+	for _, i := range haves {
+		if err := p.send(swarm.MsgHave, swarm.Uint32s(i)); err != nil {
+			return err
+		}
+	}
+	p.sentHaves = n
+
+	if p.outstanding > 0 && time.Since(p.lastBlock) > snubTimeout {
+		return fmt.Errorf("peer stopped sending blocks")
+	}
+	if p.t.isComplete() && p.isSeed() {
+		return fmt.Errorf("both peers are complete")
+	}
+	if time.Since(p.lastWrite) > keepAliveInterval {
+		p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := swarm.WriteKeepAlive(p.conn); err != nil {
+			return err
+		}
+		p.lastWrite = time.Now()
+	}
+	return nil
+}
+
+// update tells the peer whether we are interested in its pieces and requests
+// blocks from it
+func (p *peer) update() error {
+	if p.piece >= 0 && p.t.hasPiece(p.piece) {
+		// The piece was received from another peer during the endgame
+		p.abandonPiece()
+	}
+	isInterested := p.piece >= 0 || p.t.isInterestedIn(p.has)
+	if isInterested != p.isInterested {
+		p.isInterested = isInterested
+		id := byte(swarm.MsgNotInterested)
+		if isInterested {
+			id = swarm.MsgInterested
+		}
+		if err := p.send(id, nil); err != nil {
+			return err
+		}
+	}
+	if p.isChoked || !p.isInterested {
+		return nil
+	}
+
+	if p.piece < 0 {
+		i := p.t.pickPiece(p.has)
+		if i < 0 {
+			return nil
+		}
+		_, length := p.t.store.PieceBounds(i)
+		numBlocks := int((length + swarm.BlockLen - 1) / swarm.BlockLen)
+		p.piece = i
+		p.data = make([]byte, length)
+		p.requested = make([]bool, numBlocks)
+		p.received = make([]bool, numBlocks)
+		p.outstanding = 0
+	}
+	for b := range p.requested {
+		if p.outstanding >= maxOutstanding {
+			break
+		}
+		if p.requested[b] {
+			continue
+		}
+		if p.outstanding == 0 {
+			p.lastBlock = time.Now()
+		}
+		if err := p.send(swarm.MsgRequest, swarm.Uint32s(p.piece, b*swarm.BlockLen, p.blockLen(b))); err != nil {
+			return err
+		}
+		p.requested[b] = true
+		p.outstanding++
+	}
+	return nil
+}
+
+// abandonPiece stops the download of the current piece
+func (p *peer) abandonPiece() {
+	if p.piece < 0 {
+		return
+	}
+	p.t.releasePiece(p.piece)
+	p.piece = -1
+	p.data, p.requested, p.received = nil, nil, nil
+	p.outstanding = 0
+}
+
+// blockLen returns the length of block b of the downloaded piece
+func (p *peer) blockLen(b int) int {
+	if end := (b + 1) * swarm.BlockLen; end > len(p.data) {
+		return len(p.data) - b*swarm.BlockLen
+	}
+	return swarm.BlockLen
+}
+
+// isSeed reports whether the peer has all pieces
+func (p *peer) isSeed() bool {
+	for _, has := range p.has {
+		if !has {
+			return false
+		}
+	}
+	return true
+}
+
+// sendBitfield tells the peer which pieces we have, if any
+func (p *peer) sendBitfield() error {
+	haves, n := p.t.havesSince(0)
+	p.sentHaves = n
+	if n == 0 {
+		return nil
+	}
+	bitfield := make([]byte, (len(p.has)+7)/8)
+	for _, i := range haves {
+		bitfield[i/8] |= 0x80 >> (i % 8)
+	}
+	return p.send(swarm.MsgBitfield, bitfield)
+}
+
+// send sends a message to the peer
+func (p *peer) send(id byte, payload []byte) error {
+	p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	p.lastWrite = time.Now()
+	return swarm.WriteMessage(p.conn, id, payload)
+}
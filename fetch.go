@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/juliensalinas/torrengo/core"
+	"github.com/juliensalinas/torrengo/dht"
+	"github.com/juliensalinas/torrengo/magnet"
+	"github.com/juliensalinas/torrengo/metadata"
+)
+
+// fetchCmd runs the fetch subcommand, which converts magnet links into
+// torrent files and prints their paths
+func fetchCmd(args []string) {
+	flags := flag.NewFlagSet("fetch", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(
+			flags.Output(),
+			"Usage of %[1]s fetch:%[2]s%[2]s\t%[1]s fetch [-no-dht] [-t timeout] [-v] magnet ...%[2]s%[2]s"+
+				"Converts magnet links into torrent files, by fetching their metadata from the peers of the torrents, "+
+				"found with the DHT and the trackers of the magnets. Torrent files are saved in the current directory "+
+				"and their paths are printed.%[2]s%[2]s"+
+				"Options:%[2]s%[2]s",
+			os.Args[0], lineBreak,
+		)
+		flags.PrintDefaults()
+	}
+	isNoDHT := flags.Bool("no-dht", false, "Only look for peers with the trackers of the magnets.")
+	timeoutInMillisec := flags.Int("t", int(defaultMetadataTimeout/time.Millisecond),
+		"Timeout of the metadata fetching of each magnet in milliseconds. Set it to 0 to completely remove timeout.")
+	isVerbosePtr := flags.Bool("v", false, "Verbose mode. Use it to see more logs.")
+	flags.Parse(args)
+
+	isVerbose = *isVerbosePtr
+	setLogger(isVerbose)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	bootstrapNodes := dht.DefaultBootstrapNodes
+	if *isNoDHT {
+		bootstrapNodes = nil
+	}
+
+	isFailed := false
+	for _, arg := range flags.Args() {
+		filePath, err := fetchMagnet(arg, bootstrapNodes, time.Duration(*timeoutInMillisec)*time.Millisecond)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not fetch %v: %v%v", arg, err, lineBreak)
+			log.WithFields(log.Fields{
+				"arg":   arg,
+				"error": err,
+			}).Debug("Could not fetch torrent metadata")
+			isFailed = true
+			continue
+		}
+		fmt.Println(filePath)
+	}
+
+	if isFailed {
+		os.Exit(1)
+	}
+}
+
+// fetchMagnet converts a magnet link into a torrent file, named after the
+// torrent, and returns the path of the file
+func fetchMagnet(uri string, bootstrapNodes []string, timeout time.Duration) (string, error) {
+	m, err := magnet.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	mi, err := metadata.Resolve(m, bootstrapNodes, timeout)
+	if err != nil {
+		return "", err
+	}
+	data, err := mi.Bytes()
+	if err != nil {
+		return "", fmt.Errorf("could not build the torrent file: %v", err)
+	}
+
+	return core.SaveTorrentFile(data, mi.Name)
+}
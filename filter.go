@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// resultFilters are the filters applied to the results of one-shot searches,
+// set in the configuration file or with command line flags.
+// Zero values disable the filters.
+type resultFilters struct {
+	MinSeeders int `json:"minSeeders"`
+	// MinSize and MaxSize are sizes like "100MB" or "4GiB"
+	MinSize string `json:"minSize"`
+	MaxSize string `json:"maxSize"`
+	// MaxAge is a relative date like "30d", "2w", "6m" or "1y"
+	MaxAge string `json:"maxAge"`
+	// Include and Exclude are regular expressions matched against the
+	// torrent names
+	Include string `json:"include"`
+	Exclude string `json:"exclude"`
+	// MaxPerSource is the maximum number of results kept per source
+	MaxPerSource int `json:"maxPerSource"`
+}
+
+// resultFilter is the compiled version of resultFilters
+type resultFilter struct {
+	predicates   []predicate
+	include      *regexp.Regexp
+	exclude      *regexp.Regexp
+	maxPerSource int
+}
+
+// newResultFilter checks and compiles filters.
+// Filters on seeders, size and age are converted into search predicates, so
+// they behave like seeders:>=, size:>=, size:<= and date:< in the search,
+// except that torrents whose field is unknown are kept.
+func newResultFilter(filters resultFilters) (resultFilter, error) {
+	var f resultFilter
+
+	var conditions [][2]string
+	if filters.MinSeeders < 0 || filters.MaxPerSource < 0 {
+		return f, fmt.Errorf("minimum seeders and maximum results per source should be positive")
+	}
+	if filters.MinSeeders > 0 {
+		conditions = append(conditions, [2]string{"seeders", fmt.Sprintf(">=%d", filters.MinSeeders)})
+	}
+	if filters.MinSize != "" {
+		conditions = append(conditions, [2]string{"size", ">=" + filters.MinSize})
+	}
+	if filters.MaxSize != "" {
+		conditions = append(conditions, [2]string{"size", "<=" + filters.MaxSize})
+	}
+	if filters.MaxAge != "" {
+		if !relativeDate.MatchString(filters.MaxAge) {
+			return f, fmt.Errorf("invalid maximum age %v, should be like 30d", filters.MaxAge)
+		}
+		conditions = append(conditions, [2]string{"date", "<=" + filters.MaxAge})
+	}
+	for _, c := range conditions {
+		p, err := parsePredicate(c[0], c[1])
+		if err != nil {
+			return f, err
+		}
+		f.predicates = append(f.predicates, p)
+	}
+
+	var err error
+	if filters.Include != "" {
+		if f.include, err = regexp.Compile(filters.Include); err != nil {
+			return f, fmt.Errorf("invalid include regexp: %v", err)
+		}
+	}
+	if filters.Exclude != "" {
+		if f.exclude, err = regexp.Compile(filters.Exclude); err != nil {
+			return f, fmt.Errorf("invalid exclude regexp: %v", err)
+		}
+	}
+	f.maxPerSource = filters.MaxPerSource
+
+	return f, nil
+}
+
+// filterOutWith only keeps the torrents satisfying f.
+// Per source caps keep the first results of each source, in the order the
+// source returned them, so it should be applied before sorting.
+func (s *search) filterOutWith(f resultFilter) {
+	var filtered []torrent
+	perSource := make(map[string]int)
+	for _, t := range s.out {
+		if f.include != nil && !f.include.MatchString(t.name) {
+			continue
+		}
+		if f.exclude != nil && f.exclude.MatchString(t.name) {
+			continue
+		}
+		keep := true
+		for _, p := range f.predicates {
+			// Sources like Archive.org give neither seeders nor dates, so
+			// their torrents would otherwise never be kept
+			if p.isKnown(t) && !p.match(t) {
+				keep = false
+				break
+			}
+		}
+		if !keep {
+			continue
+		}
+		if f.maxPerSource > 0 && perSource[t.source] >= f.maxPerSource {
+			continue
+		}
+		perSource[t.source]++
+		filtered = append(filtered, t)
+	}
+	s.out = filtered
+}
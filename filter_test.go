@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFilterOutWith(t *testing.T) {
+	f, err := newResultFilter(resultFilters{
+		MinSeeders:   2,
+		MinSize:      "500MB",
+		MaxSize:      "4GB",
+		MaxAge:       "1y",
+		Exclude:      `(?i)\bcam\b`,
+		MaxPerSource: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recent := time.Now().Add(-24 * time.Hour)
+	old := time.Now().Add(-2 * 365 * 24 * time.Hour)
+	s := &search{out: []torrent{
+		{name: "dead", source: "tpb", sizeBytes: 1e9, seeders: 1, uplTime: recent},
+		{name: "Monte Cristo CAM", source: "tpb", sizeBytes: 1e9, seeders: 5, uplTime: recent},
+		{name: "too big", source: "tpb", sizeBytes: 5e9, seeders: 5, uplTime: recent},
+		{name: "too old", source: "tpb", sizeBytes: 1e9, seeders: 5, uplTime: old},
+		{name: "kept", source: "tpb", sizeBytes: 1e9, seeders: 5, uplTime: recent},
+		{name: "capped", source: "tpb", sizeBytes: 1e9, seeders: 50, uplTime: recent},
+		{name: "kept too", source: "otts", sizeBytes: 600e6, seeders: 2, uplTime: recent},
+		{name: "unknown", source: "arc", sizeBytes: -1, seeders: -1},
+	}}
+	s.filterOutWith(f)
+
+	var names []string
+	for _, t := range s.out {
+		names = append(names, t.name)
+	}
+	if want := []string{"kept", "kept too", "unknown"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("Got %q, want %q", names, want)
+	}
+
+	for _, filters := range []resultFilters{
+		{MinSize: "big"},
+		{MaxAge: "2020-01-01"},
+		{Include: "("},
+		{MinSeeders: -1},
+	} {
+		if _, err := newResultFilter(filters); err == nil {
+			t.Fatalf("Expected an error for %+v", filters)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// outputFormats are the formats results can be written in, on top of the
+// default table
+var outputFormats = []string{"json", "ndjson", "csv", "tsv"}
+
+// recordColumns are the column names of csv and tsv outputs
+var recordColumns = []string{
+	"name", "size", "sizeBytes", "seeders", "leechers", "trackerVerified",
+	"uplDate", "uplDateISO", "uplDatePrecision", "source", "descURL", "magnet",
+	"infoHash", "sources",
+}
+
+// columns returns the fields of r in the order of recordColumns
+func (r record) columns() []string {
+	return []string{
+		r.Name,
+		r.Size,
+		strconv.FormatInt(r.SizeBytes, 10),
+		strconv.Itoa(r.Seeders),
+		strconv.Itoa(r.Leechers),
+		strconv.FormatBool(r.TrackerVerified),
+		r.UplDate,
+		r.UplDateISO,
+		r.UplDatePrecision,
+		r.Source,
+		r.DescURL,
+		r.Magnet,
+		r.InfoHash,
+		strings.Join(r.Sources, ","),
+	}
+}
+
+// writeRecords writes torrents to w in a machine-readable format: json (an
+// array of records), ndjson (one record per line), csv, or tsv
+func writeRecords(w io.Writer, format string, torrents []torrent) error {
+	records := make([]record, 0, len(torrents))
+	for _, t := range torrents {
+		records = append(records, newRecord(t))
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		csvWriter := csv.NewWriter(w)
+		csvWriter.Write(recordColumns)
+		for _, r := range records {
+			csvWriter.Write(r.columns())
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	case "tsv":
+		// TSV has no quoting so tabs and line breaks are replaced by spaces
+		cleaner := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+		lines := []string{strings.Join(recordColumns, "\t")}
+		for _, r := range records {
+			columns := r.columns()
+			for i := range columns {
+				columns[i] = cleaner.Replace(columns[i])
+			}
+			lines = append(lines, strings.Join(columns, "\t"))
+		}
+		_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+		return err
+	}
+
+	return fmt.Errorf("unknown format %v", format)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliensalinas/torrengo/core"
+)
+
+var formatTestTorrents = []torrent{
+	{
+		magnet:           "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567",
+		name:             "Le Comte de Monte-Cristo",
+		size:             "700 MiB",
+		sizeBytes:        700 << 20,
+		seeders:          12,
+		leechers:         3,
+		uplDate:          "2019-12-03",
+		uplTime:          time.Date(2019, 12, 3, 0, 0, 0, 0, time.Local),
+		uplDatePrecision: core.PrecisionDay,
+		source:           "tpb",
+	},
+	{
+		descURL:   "https://archive.org/details/dumas",
+		name:      "Dumas\tcomplete",
+		size:      "Unknown",
+		sizeBytes: -1,
+		seeders:   -1,
+		leechers:  -1,
+		source:    "arc",
+	},
+}
+
+func TestWriteRecordsNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeRecords(&buf, "ndjson", formatTestTorrents); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Got %v lines, want 2", len(lines))
+	}
+	var r record
+	if err := json.Unmarshal([]byte(lines[0]), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.SizeBytes != 700*1024*1024 {
+		t.Fatalf("Got %v bytes, want %v", r.SizeBytes, 700*1024*1024)
+	}
+	if !strings.HasPrefix(r.UplDateISO, "2019-12-03T00:00:00") {
+		t.Fatalf("Got ISO date %v, want 2019-12-03T00:00:00", r.UplDateISO)
+	}
+	if r.UplDatePrecision != "day" {
+		t.Fatalf("Got date precision %v, want day", r.UplDatePrecision)
+	}
+	if r.Magnet == "" {
+		t.Fatal("Known magnet should be written")
+	}
+}
+
+func TestWriteRecordsTSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeRecords(&buf, "tsv", formatTestTorrents); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Got %v lines, want 3", len(lines))
+	}
+	for _, line := range lines {
+		if n := len(strings.Split(line, "\t")); n != len(recordColumns) {
+			t.Fatalf("Got %v columns in %q, want %v", n, line, len(recordColumns))
+		}
+	}
+}
+
+func TestWriteRecordsUnknownFormat(t *testing.T) {
+	if err := writeRecords(&bytes.Buffer{}, "xml", formatTestTorrents); err == nil {
+		t.Fatal("Unknown format should return an error")
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/juliensalinas/torrengo/core"
+	"github.com/juliensalinas/torrengo/magnet"
+	"github.com/juliensalinas/torrengo/metainfo"
+)
+
+// torrentInfo is what the info subcommand shows about a torrent file or a
+// magnet link. Fields which are unknown for magnets are left empty.
+type torrentInfo struct {
+	Name       string `json:"name"`
+	InfoHash   string `json:"infoHash,omitempty"`
+	InfoHashV2 string `json:"infoHashV2,omitempty"`
+	// TotalSize is the size in bytes of the files, without padding files
+	// (-1 if unknown)
+	TotalSize    int64      `json:"totalSize"`
+	Files        []fileInfo `json:"files,omitempty"`
+	PieceLength  int64      `json:"pieceLength,omitempty"`
+	Pieces       int        `json:"pieces,omitempty"`
+	MetaVersion  int        `json:"metaVersion,omitempty"`
+	Trackers     []string   `json:"trackers,omitempty"`
+	WebSeeds     []string   `json:"webSeeds,omitempty"`
+	Private      bool       `json:"private"`
+	Comment      string     `json:"comment,omitempty"`
+	CreatedBy    string     `json:"createdBy,omitempty"`
+	CreationDate string     `json:"creationDate,omitempty"`
+	Magnet       string     `json:"magnet"`
+	// Swarm are the figures given by the trackers, with -scrape
+	Swarm *swarmInfo `json:"swarm,omitempty"`
+}
+
+// swarmInfo are the figures of a torrent given by its trackers
+type swarmInfo struct {
+	Seeders   int `json:"seeders"`
+	Leechers  int `json:"leechers"`
+	Completed int `json:"completed"`
+}
+
+// fileInfo is a file of a torrent. Path elements are separated by "/" and
+// are relative to the torrent directory for multi-file torrents.
+type fileInfo struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// loadTorrentInfo reads a magnet link or a local torrent file
+func loadTorrentInfo(arg string) (torrentInfo, error) {
+	if strings.HasPrefix(strings.ToLower(arg), "magnet:") {
+		m, err := magnet.Parse(arg)
+		if err != nil {
+			return torrentInfo{}, fmt.Errorf("could not parse magnet: %v", err)
+		}
+		return newMagnetInfo(m), nil
+	}
+
+	mi, err := metainfo.Load(arg)
+	if err != nil {
+		return torrentInfo{}, err
+	}
+	return newTorrentInfo(mi), nil
+}
+
+// newTorrentInfo converts the content of a torrent file
+func newTorrentInfo(mi *metainfo.MetaInfo) torrentInfo {
+	info := torrentInfo{
+		Name:        mi.Name,
+		PieceLength: mi.PieceLength,
+		Pieces:      len(mi.Pieces),
+		MetaVersion: mi.MetaVersion,
+		Trackers:    mi.AnnounceURLs(),
+		WebSeeds:    mi.WebSeeds,
+		Private:     mi.Private,
+		Comment:     mi.Comment,
+		CreatedBy:   mi.CreatedBy,
+		Magnet:      magnet.FromMetaInfo(mi).String(),
+	}
+	if mi.HasV1() {
+		info.InfoHash = hex.EncodeToString(mi.InfoHash[:])
+	}
+	if mi.HasV2() {
+		info.InfoHashV2 = hex.EncodeToString(mi.InfoHashV2[:])
+	}
+	if !mi.CreationDate.IsZero() {
+		info.CreationDate = mi.CreationDate.Format(time.RFC3339)
+	}
+	for _, f := range mi.Files {
+		if f.IsPadding {
+			continue
+		}
+		info.Files = append(info.Files, fileInfo{Path: strings.Join(f.Path, "/"), Size: f.Length})
+		info.TotalSize += f.Length
+		if !mi.HasV1() {
+			// v2 pieces are per file
+			info.Pieces += int((f.Length + mi.PieceLength - 1) / mi.PieceLength)
+		}
+	}
+	if mi.IsDir {
+		for i := range info.Files {
+			info.Files[i].Path = mi.Name + "/" + info.Files[i].Path
+		}
+	}
+
+	return info
+}
+
+// newMagnetInfo converts a magnet link
+func newMagnetInfo(m *magnet.Magnet) torrentInfo {
+	return torrentInfo{
+		Name:       m.Name,
+		InfoHash:   m.InfoHash,
+		InfoHashV2: m.InfoHashV2,
+		TotalSize:  m.Length,
+		Trackers:   m.Trackers,
+		WebSeeds:   m.WebSeeds,
+		Magnet:     m.String(),
+	}
+}
+
+// writeInfoTable writes info in a user-friendly way: a table of its fields
+// followed by its file tree
+func writeInfoTable(w io.Writer, info torrentInfo) {
+	name := info.Name
+	if name == "" {
+		name = "Unknown"
+	}
+	rows := [][]string{
+		{"Name", name},
+		{"Size", core.FormatSize(info.TotalSize)},
+	}
+	if info.InfoHash != "" {
+		rows = append(rows, []string{"Infohash", info.InfoHash})
+	}
+	if info.InfoHashV2 != "" {
+		rows = append(rows, []string{"Infohash v2", info.InfoHashV2})
+	}
+	// Magnets do not tell the pieces, the meta version or whether torrents
+	// are private
+	if info.PieceLength > 0 {
+		rows = append(rows,
+			[]string{"Pieces", fmt.Sprintf("%d x %s", info.Pieces, core.FormatSize(info.PieceLength))},
+			[]string{"Meta version", strconv.Itoa(info.MetaVersion)},
+			[]string{"Private", strconv.FormatBool(info.Private)},
+		)
+	}
+	if len(info.Trackers) > 0 {
+		rows = append(rows, []string{"Trackers", strings.Join(info.Trackers, "\n")})
+	}
+	if len(info.WebSeeds) > 0 {
+		rows = append(rows, []string{"Web seeds", strings.Join(info.WebSeeds, "\n")})
+	}
+	if info.Swarm != nil {
+		rows = append(rows,
+			[]string{"Seeders", strconv.Itoa(info.Swarm.Seeders)},
+			[]string{"Leechers", strconv.Itoa(info.Swarm.Leechers)},
+			[]string{"Completed", strconv.Itoa(info.Swarm.Completed)},
+		)
+	}
+	for _, row := range [][]string{
+		{"Comment", info.Comment},
+		{"Created by", info.CreatedBy},
+		{"Creation date", info.CreationDate},
+	} {
+		if row[1] != "" {
+			rows = append(rows, row)
+		}
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetAutoWrapText(false)
+	table.SetRowLine(true)
+	table.AppendBulk(rows)
+	table.Render()
+
+	if len(info.Files) > 0 {
+		fmt.Fprintln(w)
+		writeFileTree(w, info.Files)
+	}
+}
+
+// writeFileTree writes files as an indented tree, directories being written
+// once before their first file
+func writeFileTree(w io.Writer, files []fileInfo) {
+	var prevDirs []string
+	for _, f := range files {
+		elems := strings.Split(f.Path, "/")
+		dirs := elems[:len(elems)-1]
+		common := 0
+		for common < len(dirs) && common < len(prevDirs) && dirs[common] == prevDirs[common] {
+			common++
+		}
+		for i := common; i < len(dirs); i++ {
+			fmt.Fprintf(w, "%s%s/%s", strings.Repeat("  ", i), dirs[i], lineBreak)
+		}
+		fmt.Fprintf(w, "%s%s (%s)%s", strings.Repeat("  ", len(dirs)), elems[len(elems)-1], core.FormatSize(f.Size), lineBreak)
+		prevDirs = dirs
+	}
+}
+
+// scrapeInfo asks the trackers of info for the figures of its swarm.
+// info.Swarm is left nil if no tracker answered.
+func scrapeInfo(info *torrentInfo, timeout time.Duration) {
+	t := torrent{infoHash: info.InfoHash, trackers: info.Trackers}
+	if st, ok := scrapeTorrents([]torrent{t}, timeout)[info.InfoHash]; ok {
+		info.Swarm = &swarmInfo{Seeders: st.Seeders, Leechers: st.Leechers, Completed: st.Completed}
+	}
+}
+
+// infoCmd runs the info subcommand, which shows the content of torrent files
+// and magnet links
+func infoCmd(args []string) {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(
+			flags.Output(),
+			"Usage of %[1]s info:%[2]s%[2]s\t%[1]s info [-format table|json] [-scrape] [-t timeout] [-v] file.torrent|magnet ...%[2]s%[2]s"+
+				"Shows the name, size, files, pieces, trackers, infohash and other details of torrent files and magnet links.%[2]s%[2]s"+
+				"Options:%[2]s%[2]s",
+			os.Args[0], lineBreak,
+		)
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "table", "Output format: table or json.")
+	isScrape := flags.Bool("scrape", false, "Ask the trackers for the number of seeders and leechers.")
+	timeoutInMillisec := flags.Int("t", 20000, "Timeout of tracker requests in milliseconds with -scrape. Set it to 0 to completely remove timeout.")
+	isVerbosePtr := flags.Bool("v", false, "Verbose mode. Use it to see more logs.")
+	flags.Parse(args)
+
+	isVerbose = *isVerbosePtr
+	setLogger(isVerbose)
+
+	if *format != "table" && *format != "json" {
+		fmt.Fprintln(os.Stderr, "-format should be either table or json (-h for help).")
+		os.Exit(1)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	infos := []torrentInfo{}
+	isFailed := false
+	for _, arg := range flags.Args() {
+		info, err := loadTorrentInfo(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read %v: %v%v", arg, err, lineBreak)
+			log.WithFields(log.Fields{
+				"arg":   arg,
+				"error": err,
+			}).Debug("Could not read torrent info")
+			isFailed = true
+			continue
+		}
+		if *isScrape {
+			scrapeInfo(&info, time.Duration(*timeoutInMillisec)*time.Millisecond)
+		}
+		infos = append(infos, info)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		var err error
+		if flags.NArg() == 1 && len(infos) == 1 {
+			err = enc.Encode(infos[0])
+		} else {
+			err = enc.Encode(infos)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Fatal("Could not write torrent info")
+		}
+	} else {
+		for i, info := range infos {
+			if i > 0 {
+				fmt.Println()
+			}
+			writeInfoTable(os.Stdout, info)
+		}
+	}
+
+	if isFailed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juliensalinas/torrengo/bencode"
+)
+
+func TestLoadTorrentInfo(t *testing.T) {
+	data, err := bencode.Encode(map[string]interface{}{
+		"announce":   "http://tracker.example/announce",
+		"comment":    "Dumas",
+		"created by": "mktorrent",
+		"info": map[string]interface{}{
+			"name": "Dumas",
+			"files": []interface{}{
+				map[string]interface{}{"length": 20000, "path": []string{"Monte-Cristo", "tome1.epub"}},
+				map[string]interface{}{"length": 12384, "path": []string{".pad", "12384"}, "attr": "p"},
+				map[string]interface{}{"length": 100, "path": []string{"cover.jpg"}},
+			},
+			"piece length": 16384,
+			"pieces":       strings.Repeat("a", 2*20),
+			"private":      1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "torrengo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "dumas.torrent")
+	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := loadTorrentInfo(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "Dumas" || info.TotalSize != 20100 || info.Pieces != 2 || !info.Private || len(info.InfoHash) != 40 {
+		t.Fatalf("Wrong info: %+v", info)
+	}
+	if len(info.Files) != 2 || info.Files[0].Path != "Dumas/Monte-Cristo/tome1.epub" {
+		t.Fatalf("Wrong files: %+v", info.Files)
+	}
+	if !strings.HasPrefix(info.Magnet, "magnet:?xt=urn:btih:"+info.InfoHash) {
+		t.Fatalf("Wrong magnet: %v", info.Magnet)
+	}
+
+	var buf bytes.Buffer
+	writeInfoTable(&buf, info)
+	for _, want := range []string{"Dumas/\n  Monte-Cristo/\n    tome1.epub (19.5 KiB)\n  cover.jpg (100 B)\n", "mktorrent", "2 x 16.0 KiB"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("%q not found in:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestLoadTorrentInfoMagnet(t *testing.T) {
+	info, err := loadTorrentInfo("magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK&dn=Dumas&tr=udp%3A%2F%2Ftracker.example%3A1337")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "Dumas" || info.InfoHash != "c12fe1c06bba254a9dc9f519b335aa7c1367a88a" || info.TotalSize != -1 || len(info.Trackers) != 1 {
+		t.Fatalf("Wrong info: %+v", info)
+	}
+
+	if _, err := loadTorrentInfo("magnet:?dn=Dumas"); err == nil {
+		t.Fatal("No error for a magnet without infohash")
+	}
+}
@@ -0,0 +1,205 @@
+// Package magnet parses and builds magnet links (BEP 9 and BEP 52).
+package magnet
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/juliensalinas/torrengo/metainfo"
+)
+
+// sha256Multihash is the multihash prefix of v2 infohashes: SHA2-256 (0x12)
+// digests of 32 bytes (0x20)
+const sha256Multihash = "1220"
+
+// Magnet is a parsed magnet link
+type Magnet struct {
+	// InfoHash is the v1 infohash in lowercase hexadecimal, empty for v2
+	// only magnets
+	InfoHash string
+	// InfoHashV2 is the v2 infohash in lowercase hexadecimal, empty for v1
+	// only magnets
+	InfoHashV2 string
+	// Name is the display name (dn)
+	Name string
+	// Length is the exact length in bytes (xl), -1 if unknown
+	Length int64
+	// Trackers are the tracker URLs (tr)
+	Trackers []string
+	// WebSeeds are the web seed URLs (ws)
+	WebSeeds []string
+	// Peers are the addresses of peers to connect to directly, like
+	// "192.168.1.2:6881" (x.pe)
+	Peers []string
+}
+
+// Parse parses a magnet link.
+// v1 infohashes may be in hexadecimal or base32, and are normalized to
+// lowercase hexadecimal. Numbered parameters like "tr.1" are supported.
+// Other parameters are ignored.
+// At least one btih or btmh exact topic (xt) is required.
+func Parse(uri string) (*Magnet, error) {
+	if !strings.HasPrefix(strings.ToLower(uri), "magnet:?") {
+		return nil, fmt.Errorf("not a magnet link")
+	}
+
+	m := &Magnet{Length: -1}
+	for _, param := range strings.Split(uri[len("magnet:?"):], "&") {
+		if param == "" {
+			continue
+		}
+		key, value := param, ""
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			key, value = param[:i], param[i+1:]
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		if strings.ToLower(key) == "x.pe" {
+			if value != "" && !contains(m.Peers, value) {
+				m.Peers = append(m.Peers, value)
+			}
+			continue
+		}
+		// Numbered parameters like tr.1 are the same as tr
+		if i := strings.IndexByte(key, '.'); i >= 0 {
+			key = key[:i]
+		}
+
+		switch strings.ToLower(key) {
+		case "xt":
+			if err := m.parseExactTopic(value); err != nil {
+				return nil, err
+			}
+		case "dn":
+			m.Name = value
+		case "xl":
+			if l, err := strconv.ParseInt(value, 10, 64); err == nil && l >= 0 {
+				m.Length = l
+			}
+		case "tr":
+			if value != "" && !contains(m.Trackers, value) {
+				m.Trackers = append(m.Trackers, value)
+			}
+		case "ws":
+			if value != "" && !contains(m.WebSeeds, value) {
+				m.WebSeeds = append(m.WebSeeds, value)
+			}
+		}
+	}
+	if m.InfoHash == "" && m.InfoHashV2 == "" {
+		return nil, fmt.Errorf("no BitTorrent infohash in magnet link")
+	}
+
+	return m, nil
+}
+
+// parseExactTopic parses the value of a xt parameter. Topics other than
+// BitTorrent ones are ignored.
+func (m *Magnet) parseExactTopic(xt string) error {
+	lowerXt := strings.ToLower(xt)
+	switch {
+	case strings.HasPrefix(lowerXt, "urn:btih:"):
+		infoHash, err := NormalizeInfoHash(xt[len("urn:btih:"):])
+		if err != nil {
+			return err
+		}
+		m.InfoHash = infoHash
+	case strings.HasPrefix(lowerXt, "urn:btmh:"):
+		multihash := lowerXt[len("urn:btmh:"):]
+		if !strings.HasPrefix(multihash, sha256Multihash) || len(multihash) != len(sha256Multihash)+64 {
+			return fmt.Errorf("unsupported multihash %v", multihash)
+		}
+		if _, err := hex.DecodeString(multihash); err != nil {
+			return fmt.Errorf("invalid multihash %v", multihash)
+		}
+		m.InfoHashV2 = multihash[len(sha256Multihash):]
+	}
+
+	return nil
+}
+
+// NormalizeInfoHash converts a v1 infohash in hexadecimal (40 characters)
+// or base32 (32 characters) to lowercase hexadecimal
+func NormalizeInfoHash(infoHash string) (string, error) {
+	switch len(infoHash) {
+	case 40:
+		b, err := hex.DecodeString(infoHash)
+		if err != nil {
+			return "", fmt.Errorf("invalid hexadecimal infohash %v", infoHash)
+		}
+		return hex.EncodeToString(b), nil
+	case 32:
+		b, err := base32.StdEncoding.DecodeString(strings.ToUpper(infoHash))
+		if err != nil {
+			return "", fmt.Errorf("invalid base32 infohash %v", infoHash)
+		}
+		return hex.EncodeToString(b), nil
+	}
+	return "", fmt.Errorf("invalid infohash %v", infoHash)
+}
+
+// FromMetaInfo builds the magnet link of a torrent file
+func FromMetaInfo(mi *metainfo.MetaInfo) *Magnet {
+	m := &Magnet{
+		Name:     mi.Name,
+		Trackers: mi.AnnounceURLs(),
+		WebSeeds: mi.WebSeeds,
+	}
+	// The padding files of hybrid torrents are not part of the content
+	for _, f := range mi.Files {
+		if !f.IsPadding {
+			m.Length += f.Length
+		}
+	}
+	if mi.HasV1() {
+		m.InfoHash = hex.EncodeToString(mi.InfoHash[:])
+	}
+	if mi.HasV2() {
+		m.InfoHashV2 = hex.EncodeToString(mi.InfoHashV2[:])
+	}
+
+	return m
+}
+
+// String returns the magnet link
+func (m *Magnet) String() string {
+	var params []string
+	if m.InfoHash != "" {
+		params = append(params, "xt=urn:btih:"+m.InfoHash)
+	}
+	if m.InfoHashV2 != "" {
+		params = append(params, "xt=urn:btmh:"+sha256Multihash+m.InfoHashV2)
+	}
+	if m.Name != "" {
+		params = append(params, "dn="+url.QueryEscape(m.Name))
+	}
+	if m.Length >= 0 {
+		params = append(params, "xl="+strconv.FormatInt(m.Length, 10))
+	}
+	for _, tr := range m.Trackers {
+		params = append(params, "tr="+url.QueryEscape(tr))
+	}
+	for _, ws := range m.WebSeeds {
+		params = append(params, "ws="+url.QueryEscape(ws))
+	}
+	for _, pe := range m.Peers {
+		params = append(params, "x.pe="+url.QueryEscape(pe))
+	}
+
+	return "magnet:?" + strings.Join(params, "&")
+}
+
+// contains reports whether s is in list
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package magnet
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/juliensalinas/torrengo/metainfo"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse("magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A&dn=Le+Comte+de+Monte-Cristo&xl=1024" +
+		"&tr=udp%3A%2F%2Ftracker.example%3A1337&tr.1=http%3A%2F%2Fb.example%2Fannounce&tr=udp%3A%2F%2Ftracker.example%3A1337" +
+		"&ws=http%3A%2F%2Fseed.example%2F&x.pe=10.0.0.1%3A6881")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Magnet{
+		InfoHash: "c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+		Name:     "Le Comte de Monte-Cristo",
+		Length:   1024,
+		Trackers: []string{"udp://tracker.example:1337", "http://b.example/announce"},
+		WebSeeds: []string{"http://seed.example/"},
+		Peers:    []string{"10.0.0.1:6881"},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("Got %+v, want %+v", m, want)
+	}
+}
+
+func TestParseBase32AndV2(t *testing.T) {
+	m, err := Parse("magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.InfoHash != "c12fe1c06bba254a9dc9f519b335aa7c1367a88a" || m.Length != -1 {
+		t.Fatalf("Wrong magnet: %+v", m)
+	}
+
+	v2 := strings.Repeat("ab", 32)
+	m, err = Parse("magnet:?xt=urn:btmh:1220" + strings.ToUpper(v2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.InfoHashV2 != v2 || m.InfoHash != "" {
+		t.Fatalf("Wrong v2 magnet: %+v", m)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"http://example.com",
+		"magnet:?dn=name",
+		"magnet:?xt=urn:btih:1234",
+		"magnet:?xt=urn:btih:ZZ2FE1C06BBA254A9DC9F519B335AA7C1367A88A",
+		"magnet:?xt=urn:btmh:1114" + strings.Repeat("ab", 20),
+	}
+	for _, uri := range tests {
+		if _, err := Parse(uri); err == nil {
+			t.Fatalf("No error for %q", uri)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	m := &Magnet{
+		InfoHash:   "c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+		InfoHashV2: strings.Repeat("ab", 32),
+		Name:       "Monte Cristo & co",
+		Length:     -1,
+		Trackers:   []string{"udp://tracker.example:1337"},
+	}
+	uri := m.String()
+	want := "magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&xt=urn:btmh:1220" + strings.Repeat("ab", 32) +
+		"&dn=Monte+Cristo+%26+co&tr=udp%3A%2F%2Ftracker.example%3A1337"
+	if uri != want {
+		t.Fatalf("Got %v, want %v", uri, want)
+	}
+
+	parsed, err := Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, m) {
+		t.Fatalf("Got %+v after a round trip, want %+v", parsed, m)
+	}
+}
+
+func TestFromMetaInfo(t *testing.T) {
+	mi, err := metainfo.Parse([]byte("d8:announce22:http://t.example/annce4:infod6:lengthi10e4:name5:x.txt12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaaee"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := FromMetaInfo(mi)
+	if m.InfoHash != mi.InfoHashHex() || m.Name != "x.txt" || m.Length != 10 || !reflect.DeepEqual(m.Trackers, []string{"http://t.example/annce"}) {
+		t.Fatalf("Wrong magnet: %+v", m)
+	}
+
+	// Padding files are not counted in the length
+	mi.Files = []metainfo.File{{Length: 10}, {Length: 16374, IsPadding: true}, {Length: 5}}
+	if m := FromMetaInfo(mi); m.Length != 15 {
+		t.Fatalf("Got length %d", m.Length)
+	}
+}
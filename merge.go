@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// maxSizeDiff is the maximum relative size difference of torrents merged on
+// their name, so that different encodes of the same release are not merged
+const maxSizeDiff = 0.02
+
+// mergeOut merges the torrents of s found on several sources.
+// Torrents are merged when they have the same infohash, or, when the
+// infohash is not known yet, when they come from different sources and have
+// the same normalized name and a similar known size.
+// The most seeded torrent of a group is kept, with the combined seeders and
+// leechers of the group, and the torrents of each source in mergedFrom.
+// The order of results is kept.
+func (s *search) mergeOut() {
+	var merged []torrent
+	for _, t := range s.out {
+		isMerged := false
+		for i := range merged {
+			if isDuplicate(merged[i], t) {
+				merged[i] = mergeTorrents(merged[i], t)
+				isMerged = true
+				break
+			}
+		}
+		if !isMerged {
+			merged = append(merged, t)
+		}
+	}
+	s.out = merged
+}
+
+// entries returns the torrents merged into t, or t alone if it was not
+// merged
+func entries(t torrent) []torrent {
+	if t.mergedFrom == nil {
+		return []torrent{t}
+	}
+	return t.mergedFrom
+}
+
+// isDuplicate reports whether t is the same torrent as the (possibly merged)
+// torrent m
+func isDuplicate(m torrent, t torrent) bool {
+	name := normalizeName(t.name)
+	isNameMatch := name != ""
+	for _, e := range entries(m) {
+		if t.infoHash != "" && e.infoHash != "" {
+			if e.infoHash == t.infoHash {
+				return true
+			}
+			// Known and different infohashes are different torrents
+			isNameMatch = false
+		}
+		if e.source == t.source || normalizeName(e.name) != name || !isSimilarSize(e.sizeBytes, t.sizeBytes) {
+			isNameMatch = false
+		}
+	}
+
+	return isNameMatch
+}
+
+// isSimilarSize reports whether two sizes in bytes may be the size of the
+// same torrent. Unknown sizes are not similar to any size, since sources like
+// Archive.org never give sizes and generic names would then be merged.
+func isSimilarSize(a, b int64) bool {
+	if a < 0 || b < 0 {
+		return false
+	}
+	return math.Abs(float64(a-b)) <= maxSizeDiff*math.Max(float64(a), float64(b))
+}
+
+// normalizeName normalizes a release name so that the names given by
+// different sources to the same release are equal: case, punctuation and
+// separators are ignored
+func normalizeName(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// mergeTorrents merges t into the (possibly merged) torrent m
+func mergeTorrents(m torrent, t torrent) torrent {
+	t.mergedFrom = nil
+	group := append(append([]torrent{}, entries(m)...), t)
+
+	primary := group[0]
+	for _, e := range group[1:] {
+		if e.seeders > primary.seeders {
+			primary = e
+		}
+	}
+	primary.seeders, primary.leechers = combinedPeers(group)
+	primary.mergedFrom = group
+
+	return primary
+}
+
+// combinedPeers returns the seeders and leechers of a group of merged
+// torrents.
+// Torrents sharing an infohash are the same swarm seen by several sources, so
+// only their highest figures are kept, while figures of different swarms are
+// added. -1 is returned if no figure is known.
+func combinedPeers(group []torrent) (int, int) {
+	type peers struct{ seeders, leechers int }
+	swarms := make(map[string]*peers)
+	var others []peers
+	for _, e := range group {
+		if e.infoHash == "" {
+			others = append(others, peers{e.seeders, e.leechers})
+			continue
+		}
+		p, ok := swarms[e.infoHash]
+		if !ok {
+			swarms[e.infoHash] = &peers{e.seeders, e.leechers}
+			continue
+		}
+		if e.seeders > p.seeders {
+			p.seeders = e.seeders
+		}
+		if e.leechers > p.leechers {
+			p.leechers = e.leechers
+		}
+	}
+	for _, p := range swarms {
+		others = append(others, *p)
+	}
+
+	seeders, leechers := -1, -1
+	for _, p := range others {
+		seeders = addPeers(seeders, p.seeders)
+		leechers = addPeers(leechers, p.leechers)
+	}
+
+	return seeders, leechers
+}
+
+// addPeers adds n peers to total, ignoring unknown (negative) numbers
+func addPeers(total, n int) int {
+	switch {
+	case n < 0:
+		return total
+	case total < 0:
+		return n
+	}
+	return total + n
+}
+
+// preferSource makes the torrent of the given source the one retrieved for
+// the merged torrent t. Combined seeders and leechers are kept.
+func (t *torrent) preferSource(source string) error {
+	if t.source == source {
+		return nil
+	}
+	for _, e := range t.mergedFrom {
+		if e.source == source {
+			seeders, leechers, mergedFrom := t.seeders, t.leechers, t.mergedFrom
+			*t = e
+			t.seeders, t.leechers, t.mergedFrom = seeders, leechers, mergedFrom
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%v is not available on %v", t.name, sources[source])
+}
+
+// parseSelection converts a list of indexes and ranges like "1,4,7-9" into
+// indexes of torrents (see parseIndexes).
+// Indexes can be followed by a source, like "4@otts" or "7-9@tpb", to choose
+// the source of merged torrents. Torrents are only changed if the whole
+// selection is valid.
+func parseSelection(usrIndexes string, torrents []torrent) ([]int, error) {
+	var parts []string
+	// chosen contains the torrents whose source was chosen, by index
+	chosen := make(map[int]torrent)
+	for _, part := range strings.Split(usrIndexes, ",") {
+		i := strings.Index(part, "@")
+		if i < 0 {
+			parts = append(parts, part)
+			continue
+		}
+		partIndexes, source := part[:i], strings.TrimSpace(part[i+1:])
+		if _, ok := sources[source]; !ok {
+			return nil, fmt.Errorf("unknown source %v", source)
+		}
+		indexes, err := parseIndexes(partIndexes, len(torrents))
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range indexes {
+			t, ok := chosen[index]
+			if !ok {
+				t = torrents[index]
+			}
+			if err := t.preferSource(source); err != nil {
+				return nil, err
+			}
+			chosen[index] = t
+		}
+		parts = append(parts, partIndexes)
+	}
+
+	indexes, err := parseIndexes(strings.Join(parts, ","), len(torrents))
+	if err != nil {
+		return nil, err
+	}
+	for index, t := range chosen {
+		torrents[index] = t
+	}
+
+	return indexes, nil
+}
+
+// displaySources returns the names of the sources of t, the one retrieved
+// first
+func displaySources(t torrent) string {
+	names := []string{sources[t.source]}
+	for _, e := range t.mergedFrom {
+		if name := sources[e.source]; !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// contains reports whether s is in list
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeOut(t *testing.T) {
+	s := &search{out: []torrent{
+		{name: "Monte.Cristo.2002.1080p", source: "tpb", infoHash: "aa", seeders: 10, leechers: 2, sizeBytes: 1000},
+		{name: "Les Trois Mousquetaires", source: "tpb", seeders: 3, leechers: 1, sizeBytes: 500},
+		{name: "Monte Cristo (2002) [1080p]", source: "otts", seeders: 30, leechers: 5, sizeBytes: 1010},
+		{name: "Monte Cristo 2002 1080p", source: "ygg", seeders: 4, leechers: -1, sizeBytes: 2000},
+		{name: "Monte.Cristo.2002.1080p", source: "tpb", infoHash: "aa", seeders: 12, leechers: 1, sizeBytes: 1000},
+		{name: "Les Trois Mousquetaires", source: "otts", infoHash: "bb", seeders: 1, leechers: 1, sizeBytes: 500},
+		{name: "Les trois mousquetaires", source: "arc", seeders: -1, leechers: -1, sizeBytes: -1},
+	}}
+	s.mergeOut()
+
+	if len(s.out) != 4 {
+		t.Fatalf("Got %d results, want 4: %+v", len(s.out), s.out)
+	}
+	m := s.out[0]
+	// tpb torrents are the same swarm, otts is another one
+	if m.source != "otts" || m.seeders != 42 || m.leechers != 7 || len(m.mergedFrom) != 3 {
+		t.Fatalf("Wrong merged torrent: %+v", m)
+	}
+	if got := displaySources(m); got != "1337x, The Pirate Bay" {
+		t.Fatalf("Got sources %q", got)
+	}
+	if r := newRecord(m); !reflect.DeepEqual(r.Sources, []string{"otts", "tpb"}) {
+		t.Fatalf("Got record sources %v", r.Sources)
+	}
+	// Too different sizes
+	if s.out[2].source != "ygg" || s.out[2].mergedFrom != nil {
+		t.Fatalf("ygg torrent should not be merged: %+v", s.out[2])
+	}
+	if s.out[1].mergedFrom == nil || s.out[1].seeders != 4 {
+		t.Fatalf("Trois Mousquetaires should be merged on their name: %+v", s.out[1])
+	}
+	// Unknown size
+	if s.out[3].source != "arc" || s.out[3].mergedFrom != nil {
+		t.Fatalf("arc torrent should not be merged: %+v", s.out[3])
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	s := &search{out: []torrent{
+		{name: "Monte Cristo", source: "tpb", magnet: "magnet:?xt=urn:btih:a", seeders: 10},
+		{name: "Monte Cristo", source: "ygg", descURL: "https://ygg/1", seeders: 3},
+		{name: "Vingt ans après", source: "arc"},
+	}}
+	s.mergeOut()
+
+	indexes, err := parseSelection("0@ygg,1", s.out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(indexes, []int{0, 1}) {
+		t.Fatalf("Got indexes %v", indexes)
+	}
+	if tor := s.out[0]; tor.source != "ygg" || tor.descURL != "https://ygg/1" || tor.seeders != 13 || len(tor.mergedFrom) != 2 {
+		t.Fatalf("Wrong selected source: %+v", tor)
+	}
+
+	for _, usrIndexes := range []string{"1@tpb", "0@foo", "5@tpb", "0@tpb,9", "0@tpb,1@tpb"} {
+		if _, err := parseSelection(usrIndexes, s.out); err == nil {
+			t.Fatalf("Expected an error for %q", usrIndexes)
+		}
+	}
+	// Invalid selections do not change the sources
+	if s.out[0].source != "ygg" {
+		t.Fatalf("Source changed to %v by an invalid selection", s.out[0].source)
+	}
+}
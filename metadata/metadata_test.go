@@ -0,0 +1,223 @@
+package metadata
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+	"github.com/juliensalinas/torrengo/magnet"
+	"github.com/juliensalinas/torrengo/swarm"
+)
+
+// peerUtMetadataID is the ID of ut_metadata messages sent to test peers
+const peerUtMetadataID = 3
+
+// testInfo returns an info dictionary of more than one metadata piece
+func testInfo(t *testing.T) []byte {
+	info, err := bencode.Encode(map[string]interface{}{
+		"name":         "ubuntu.iso",
+		"length":       1000 * 16384,
+		"piece length": 16384,
+		"pieces":       strings.Repeat("a", 1000*20),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+// servePeer runs a stand-in peer seeding the given info dictionary with the
+// ut_metadata extension. If isRejecting is true, metadata requests are
+// rejected.
+func servePeer(t *testing.T, info []byte, isRejecting bool) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				seed(conn, info, isRejecting)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// seed answers the metadata requests of a peer connection
+func seed(conn net.Conn, info []byte, isRejecting bool) {
+	r := bufio.NewReader(conn)
+	req := make([]byte, 68)
+	if _, err := io.ReadFull(r, req); err != nil {
+		return
+	}
+	infoHash := sha1.Sum(info)
+	if string(req[28:48]) != string(infoHash[:]) {
+		return
+	}
+	resp := append([]byte(nil), req[:48]...)
+	resp = append(resp, "-XX0001-000000000000"...)
+	conn.Write(resp)
+
+	ext, _ := bencode.Encode(map[string]interface{}{
+		"m":             map[string]interface{}{"ut_metadata": peerUtMetadataID, "ut_pex": 2},
+		"metadata_size": len(info),
+	})
+	swarm.WriteMessage(conn, swarm.MsgExtended, append([]byte{extHandshake}, ext...))
+	// Peers also send their pieces, which must be ignored
+	swarm.WriteMessage(conn, swarm.MsgBitfield, []byte{0xFF})
+
+	var clientUtMetadataID int
+	for {
+		id, payload, err := swarm.ReadMessage(r)
+		if err != nil {
+			return
+		}
+		if id != swarm.MsgExtended || len(payload) == 0 {
+			continue
+		}
+		if payload[0] == extHandshake {
+			v, _ := bencode.Decode(payload[1:])
+			m, _ := v.(map[string]interface{})["m"].(map[string]interface{})
+			id, _ := m["ut_metadata"].(int64)
+			clientUtMetadataID = int(id)
+			continue
+		}
+		if payload[0] != peerUtMetadataID {
+			continue
+		}
+		v, _ := bencode.Decode(payload[1:])
+		piece := int(v.(map[string]interface{})["piece"].(int64))
+		if isRejecting {
+			msg, _ := bencode.Encode(map[string]interface{}{"msg_type": metadataReject, "piece": piece})
+			swarm.WriteMessage(conn, swarm.MsgExtended, append([]byte{byte(clientUtMetadataID)}, msg...))
+			continue
+		}
+		end := (piece + 1) * metadataPieceLen
+		if end > len(info) {
+			end = len(info)
+		}
+		msg, _ := bencode.Encode(map[string]interface{}{"msg_type": metadataData, "piece": piece, "total_size": len(info)})
+		msg = append(msg, info[piece*metadataPieceLen:end]...)
+		swarm.WriteMessage(conn, swarm.MsgExtended, append([]byte{byte(clientUtMetadataID)}, msg...))
+	}
+}
+
+func TestFetch(t *testing.T) {
+	info := testInfo(t)
+	addr := servePeer(t, info, false)
+
+	got, err := Fetch(context.Background(), addr, sha1.Sum(info), [20]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(info) {
+		t.Fatal("Wrong metadata")
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	info := testInfo(t)
+
+	addr := servePeer(t, info, true)
+	if _, err := Fetch(context.Background(), addr, sha1.Sum(info), [20]byte{}); err == nil {
+		t.Fatal("No error for a rejected request")
+	}
+
+	// The peer does not have the torrent
+	addr = servePeer(t, info, false)
+	if _, err := Fetch(context.Background(), addr, [20]byte{1}, [20]byte{}); err == nil {
+		t.Fatal("No error for an unknown torrent")
+	}
+
+	// The peer never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := Fetch(ctx, l.Addr().String(), sha1.Sum(info), [20]byte{}); err == nil {
+		t.Fatal("No error for a silent peer")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	info := testInfo(t)
+	infoHash := sha1.Sum(info)
+	m := &magnet.Magnet{
+		InfoHash: hex.EncodeToString(infoHash[:]),
+		Length:   -1,
+		Peers:    []string{servePeer(t, info, true), servePeer(t, info, false)},
+		Trackers: []string{"udp://tracker.invalid:6969"},
+		WebSeeds: []string{"http://seed.example/ubuntu.iso"},
+	}
+
+	mi, err := Resolve(m, nil, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi.InfoHash != infoHash || mi.Name != "ubuntu.iso" {
+		t.Fatalf("Wrong metainfo: %+v", mi)
+	}
+	if len(mi.Trackers) != 1 || mi.Trackers[0][0] != m.Trackers[0] || len(mi.WebSeeds) != 1 {
+		t.Fatalf("Wrong trackers %v or web seeds %v", mi.Trackers, mi.WebSeeds)
+	}
+}
+
+func TestResolveWithTracker(t *testing.T) {
+	info := testInfo(t)
+	infoHash := sha1.Sum(info)
+	host, port, _ := net.SplitHostPort(servePeer(t, info, false))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := strconv.Atoi(port)
+		peer := append(net.ParseIP(host).To4(), byte(p>>8), byte(p))
+		b, _ := bencode.Encode(map[string]interface{}{"interval": 1800, "peers": string(peer)})
+		w.Write(b)
+	}))
+	defer ts.Close()
+	m := &magnet.Magnet{
+		InfoHash: hex.EncodeToString(infoHash[:]),
+		Length:   -1,
+		Trackers: []string{ts.URL + "/announce"},
+	}
+
+	mi, err := Resolve(m, nil, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi.InfoHash != infoHash {
+		t.Fatalf("Wrong metainfo: %+v", mi)
+	}
+}
+
+func TestResolveNoPeer(t *testing.T) {
+	m := &magnet.Magnet{InfoHash: strings.Repeat("ab", 20), Length: -1}
+	if _, err := Resolve(m, nil, time.Second); err == nil {
+		t.Fatal("No error without peers")
+	}
+
+	m = &magnet.Magnet{InfoHashV2: strings.Repeat("ab", 32), Length: -1}
+	if _, err := Resolve(m, nil, time.Second); err == nil {
+		t.Fatal("No error for a v2 only magnet")
+	}
+}
@@ -0,0 +1,183 @@
+// Package metadata fetches the info dictionary of torrents from the peers of
+// their swarm, with the ut_metadata extension (BEP 9 and BEP 10), so that
+// magnet links can be converted into .torrent files.
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/juliensalinas/torrengo/bencode"
+	"github.com/juliensalinas/torrengo/swarm"
+)
+
+// Extension protocol messages
+const (
+	// extHandshake is the extended message ID of extended handshakes
+	extHandshake = 0
+	// utMetadataID is the extended message ID peers must use to send us
+	// ut_metadata messages
+	utMetadataID = 1
+)
+
+// ut_metadata message types
+const (
+	metadataRequest = 0
+	metadataData    = 1
+	metadataReject  = 2
+)
+
+// metadataPieceLen is the length of metadata pieces, except the last one
+const metadataPieceLen = 16384
+
+// maxMetadataSize is the maximum size of accepted metadata
+const maxMetadataSize = 10 << 20
+
+// Fetch connects to the peer at addr, like "192.168.1.2:6881", and
+// downloads the info dictionary of the torrent with the given v1 infohash.
+// The info dictionary is checked against the infohash.
+func Fetch(ctx context.Context, addr string, infoHash, peerID [20]byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to peer: %v", err)
+	}
+	defer conn.Close()
+	// Closing the connection interrupts reads and writes
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	info, err := fetch(conn, infoHash, peerID)
+	if err != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("peer did not send the metadata in time")
+	}
+	return info, err
+}
+
+// fetch downloads the info dictionary over a peer connection
+func fetch(conn io.ReadWriter, infoHash, peerID [20]byte) ([]byte, error) {
+	r := bufio.NewReader(conn)
+	_, isExtended, err := swarm.Handshake(conn, r, infoHash, peerID)
+	if err != nil {
+		return nil, err
+	}
+	if !isExtended {
+		return nil, fmt.Errorf("peer does not support the extension protocol")
+	}
+	ext, _ := bencode.Encode(map[string]interface{}{
+		"m": map[string]interface{}{"ut_metadata": utMetadataID},
+		"v": "torrengo",
+	})
+	if err := swarm.WriteMessage(conn, swarm.MsgExtended, append([]byte{extHandshake}, ext...)); err != nil {
+		return nil, err
+	}
+
+	var (
+		pieces   [][]byte
+		size     int
+		received int
+	)
+	for {
+		id, payload, err := swarm.ReadMessage(r)
+		if err != nil {
+			return nil, err
+		}
+		if id != swarm.MsgExtended || len(payload) == 0 {
+			continue
+		}
+
+		switch payload[0] {
+		case extHandshake:
+			if pieces != nil {
+				continue
+			}
+			var peerUtMetadataID int
+			peerUtMetadataID, size, err = parseExtHandshake(payload[1:])
+			if err != nil {
+				return nil, err
+			}
+			pieces = make([][]byte, (size+metadataPieceLen-1)/metadataPieceLen)
+			for i := range pieces {
+				req, _ := bencode.Encode(map[string]interface{}{"msg_type": metadataRequest, "piece": i})
+				if err := swarm.WriteMessage(conn, swarm.MsgExtended, append([]byte{byte(peerUtMetadataID)}, req...)); err != nil {
+					return nil, err
+				}
+			}
+
+		case utMetadataID:
+			if pieces == nil {
+				continue
+			}
+			v, n, err := bencode.DecodePrefix(payload[1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid metadata message: %v", err)
+			}
+			dict, _ := v.(map[string]interface{})
+			msgType, _ := dict["msg_type"].(int64)
+			piece, ok := dict["piece"].(int64)
+			if !ok || piece < 0 || piece >= int64(len(pieces)) {
+				return nil, fmt.Errorf("invalid metadata piece")
+			}
+			switch msgType {
+			case metadataReject:
+				return nil, fmt.Errorf("peer rejected the metadata request")
+			case metadataData:
+				data := payload[1+n:]
+				wantLen := metadataPieceLen
+				if piece == int64(len(pieces)-1) {
+					wantLen = size - metadataPieceLen*(len(pieces)-1)
+				}
+				if len(data) != wantLen {
+					return nil, fmt.Errorf("wrong metadata piece length")
+				}
+				if pieces[piece] == nil {
+					pieces[piece] = append([]byte(nil), data...)
+					received++
+				}
+			}
+			if received == len(pieces) {
+				info := bytes.Join(pieces, nil)
+				if sha1.Sum(info) != infoHash {
+					return nil, fmt.Errorf("metadata sent by peer do not match the infohash")
+				}
+				return info, nil
+			}
+		}
+	}
+}
+
+// parseExtHandshake returns the ut_metadata message ID and the metadata size
+// given in an extended handshake
+func parseExtHandshake(payload []byte) (int, int, error) {
+	v, err := bencode.Decode(payload)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid extended handshake: %v", err)
+	}
+	dict, _ := v.(map[string]interface{})
+	m, _ := dict["m"].(map[string]interface{})
+	id, ok := m["ut_metadata"].(int64)
+	if !ok || id <= 0 || id > 255 {
+		return 0, 0, fmt.Errorf("peer does not support metadata exchange")
+	}
+	size, ok := dict["metadata_size"].(int64)
+	if !ok || size <= 0 {
+		return 0, 0, fmt.Errorf("peer does not know the metadata")
+	}
+	if size > maxMetadataSize {
+		return 0, 0, fmt.Errorf("metadata are too big")
+	}
+
+	return int(id), int(size), nil
+}
@@ -0,0 +1,115 @@
+package metadata
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/juliensalinas/torrengo/magnet"
+	"github.com/juliensalinas/torrengo/metainfo"
+	"github.com/juliensalinas/torrengo/swarm"
+)
+
+// maxConcurrentPeers is the maximum number of peers asked the metadata at
+// the same time
+const maxConcurrentPeers = 16
+
+// peerTimeout is how long a single peer is given to send the metadata, so
+// that slow peers do not hold up the others
+const peerTimeout = 20 * time.Second
+
+// peerPort is the port announced to trackers. Connections are not accepted
+// since only metadata are fetched.
+const peerPort = 6881
+
+// Resolve fetches the metadata of the torrent of magnet m from its swarm and
+// returns them as a torrent, with the trackers and web seeds of the magnet.
+// Peers are the ones given by the magnet (x.pe), by its trackers, and by the
+// DHT searched from bootstrapNodes (the DHT is not used if bootstrapNodes is
+// empty). They are asked concurrently and the first valid metadata win.
+// Only magnets with a v1 infohash are supported.
+// Set timeout to 0 to completely remove timeout.
+func Resolve(m *magnet.Magnet, bootstrapNodes []string, timeout time.Duration) (*metainfo.MetaInfo, error) {
+	if m.InfoHash == "" {
+		return nil, fmt.Errorf("only magnets with a v1 infohash can be resolved")
+	}
+	var infoHash [20]byte
+	if _, err := hex.Decode(infoHash[:], []byte(m.InfoHash)); err != nil {
+		return nil, fmt.Errorf("invalid infohash %v", m.InfoHash)
+	}
+	peerID, err := swarm.NewPeerID()
+	if err != nil {
+		return nil, err
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	peers := swarm.FindPeers(ctx, infoHash, peerID, peerPort, m.Peers, m.Trackers, bootstrapNodes)
+
+	type result struct {
+		info []byte
+		err  error
+	}
+	results := make(chan result)
+	seen := make(map[string]bool)
+	pending := 0
+	isFinding := true
+	lastErr := fmt.Errorf("no peer found")
+	for isFinding || pending > 0 {
+		// Wait for a free slot before taking new peers
+		var newPeers <-chan string
+		if isFinding && pending < maxConcurrentPeers {
+			newPeers = peers
+		}
+
+		select {
+		case p, ok := <-newPeers:
+			if !ok {
+				isFinding = false
+				continue
+			}
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			pending++
+			go func(p string) {
+				peerCtx, peerCancel := context.WithTimeout(ctx, peerTimeout)
+				defer peerCancel()
+				info, err := Fetch(peerCtx, p, infoHash, peerID)
+				select {
+				case results <- result{info, err}:
+				case <-ctx.Done():
+				}
+			}(p)
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				lastErr = r.err
+				continue
+			}
+			mi, err := metainfo.ParseInfo(r.info)
+			if err != nil {
+				lastErr = fmt.Errorf("invalid metadata: %v", err)
+				continue
+			}
+			for _, tr := range m.Trackers {
+				mi.Trackers = append(mi.Trackers, []string{tr})
+			}
+			mi.WebSeeds = m.WebSeeds
+			return mi, nil
+		case <-ctx.Done():
+			return nil, fmt.Errorf("could not fetch the metadata before timeout (%d peers tried)", len(seen))
+		}
+	}
+
+	return nil, fmt.Errorf("could not fetch the metadata from any of %d peers: %v", len(seen), lastErr)
+}
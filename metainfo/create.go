@@ -0,0 +1,358 @@
+package metainfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+)
+
+// BlockLength is the length of the blocks v2 files are hashed by (BEP 52),
+// and the minimum piece length of v2 torrents
+const BlockLength = 16384
+
+// maxAutoPieceLength is the maximum piece length chosen by Create
+const maxAutoPieceLength = 16 << 20
+
+// autoPieces is the number of pieces Create aims at when it chooses the piece
+// length
+const autoPieces = 1500
+
+// CreateOptions are the settings of the torrents built by Create
+type CreateOptions struct {
+	// PieceLength must be a power of two of at least BlockLength. It is
+	// chosen from the size of the content if 0.
+	PieceLength int64
+	// Trackers are the announce URLs, grouped by tier (BEP 12)
+	Trackers [][]string
+	// WebSeeds are the HTTP seeds (BEP 19)
+	WebSeeds  []string
+	Private   bool
+	Comment   string
+	CreatedBy string
+	// IsHybrid adds v2 hashes (BEP 52) to the v1 ones, so that the torrent
+	// can be shared on both v1 and v2 swarms. Files are then aligned on
+	// pieces with padding files.
+	IsHybrid bool
+}
+
+// localFile is a file of the content given to Create
+type localFile struct {
+	path   string
+	elems  []string
+	length int64
+}
+
+// Create builds the torrent of the file or directory at root. The torrent is
+// named after root, and the files of directories are sorted by path.
+func Create(root string, opts CreateOptions) (*MetaInfo, error) {
+	// The torrent is named after the absolute path, so that "." gets the name of
+	// the current directory
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %v: %v", root, err)
+	}
+	root = abs
+	stat, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %v: %v", root, err)
+	}
+	name := filepath.Base(root)
+	if !isValidPathElement(name) {
+		return nil, fmt.Errorf("invalid name %q", name)
+	}
+
+	var files []localFile
+	if stat.IsDir() {
+		files, err = listFiles(root)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no file in %v", root)
+		}
+	} else {
+		files = []localFile{{path: root, elems: []string{name}, length: stat.Size()}}
+	}
+
+	var total int64
+	for _, f := range files {
+		total += f.length
+	}
+	pieceLength := opts.PieceLength
+	if pieceLength == 0 {
+		pieceLength = BlockLength
+		for total/pieceLength > autoPieces && pieceLength < maxAutoPieceLength {
+			pieceLength *= 2
+		}
+	}
+	if pieceLength < BlockLength || pieceLength&(pieceLength-1) != 0 {
+		return nil, fmt.Errorf("piece length should be a power of two of at least %d bytes", BlockLength)
+	}
+
+	h := &pieceHasher{pieceLength: pieceLength}
+	var v1Files []interface{}
+	fileTree := make(map[string]interface{})
+	pieceLayers := make(map[string]string)
+	for i, f := range files {
+		pieceRoot, layer, err := h.hashFile(f, opts.IsHybrid)
+		if err != nil {
+			return nil, err
+		}
+		v1Files = append(v1Files, map[string]interface{}{"length": f.length, "path": f.elems})
+
+		if opts.IsHybrid {
+			leaf := map[string]interface{}{"length": f.length}
+			if f.length > 0 {
+				leaf["pieces root"] = string(pieceRoot[:])
+			}
+			if f.length > pieceLength {
+				pieceLayers[string(pieceRoot[:])] = string(layer)
+			}
+			addToFileTree(fileTree, f.elems, leaf)
+
+			// Align the next file on pieces
+			if pad := h.padding(); pad > 0 && i < len(files)-1 {
+				h.write(make([]byte, pad))
+				v1Files = append(v1Files, map[string]interface{}{
+					"attr":   "p",
+					"length": pad,
+					"path":   []string{".pad", strconv.FormatInt(pad, 10)},
+				})
+			}
+		}
+	}
+	h.flush()
+
+	info := map[string]interface{}{
+		"name":         name,
+		"piece length": pieceLength,
+		"pieces":       string(h.pieces),
+	}
+	if stat.IsDir() {
+		info["files"] = v1Files
+	} else {
+		info["length"] = files[0].length
+	}
+	if opts.Private {
+		info["private"] = 1
+	}
+	if opts.IsHybrid {
+		info["meta version"] = 2
+		info["file tree"] = fileTree
+	}
+	infoBytes, err := bencode.Encode(info)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode info dictionary: %v", err)
+	}
+
+	m, err := ParseInfo(infoBytes)
+	if err != nil {
+		return nil, err
+	}
+	m.Trackers = opts.Trackers
+	m.WebSeeds = opts.WebSeeds
+	m.Comment = opts.Comment
+	m.CreatedBy = opts.CreatedBy
+	m.CreationDate = time.Unix(time.Now().Unix(), 0)
+	if len(pieceLayers) > 0 {
+		m.PieceLayers = pieceLayers
+	}
+
+	return m, nil
+}
+
+// listFiles returns the regular files of the directory root, sorted by path
+func listFiles(root string) ([]localFile, error) {
+	var files []localFile
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		elems := strings.Split(filepath.ToSlash(rel), "/")
+		for _, e := range elems {
+			if !isValidPathElement(e) {
+				return fmt.Errorf("invalid path %q", rel)
+			}
+		}
+		files = append(files, localFile{
+			path:   path,
+			elems:  elems,
+			length: info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list files: %v", err)
+	}
+
+	return files, nil
+}
+
+// addToFileTree adds the leaf of the file at elems to the v2 file tree
+func addToFileTree(tree map[string]interface{}, elems []string, leaf map[string]interface{}) {
+	for _, e := range elems {
+		node, ok := tree[e].(map[string]interface{})
+		if !ok {
+			node = make(map[string]interface{})
+			tree[e] = node
+		}
+		tree = node
+	}
+	tree[""] = leaf
+}
+
+// pieceHasher computes the v1 piece hashes of the content of a torrent, and
+// the v2 merkle trees of its files
+type pieceHasher struct {
+	pieceLength int64
+	// piece is the data of the v1 piece being hashed
+	piece []byte
+	// pieces are the SHA-1 hashes of the v1 pieces
+	pieces []byte
+	// length is the length of the content hashed so far
+	length int64
+}
+
+// write adds p to the v1 content
+func (h *pieceHasher) write(p []byte) {
+	h.length += int64(len(p))
+	for len(p) > 0 {
+		n := int(h.pieceLength) - len(h.piece)
+		if n > len(p) {
+			n = len(p)
+		}
+		h.piece = append(h.piece, p[:n]...)
+		p = p[n:]
+		if int64(len(h.piece)) == h.pieceLength {
+			h.flush()
+		}
+	}
+}
+
+// flush hashes the last v1 piece, which may be shorter than the others
+func (h *pieceHasher) flush() {
+	if len(h.piece) == 0 {
+		return
+	}
+	sum := sha1.Sum(h.piece)
+	h.pieces = append(h.pieces, sum[:]...)
+	h.piece = h.piece[:0]
+}
+
+// padding returns the number of bytes needed to align the content on pieces
+func (h *pieceHasher) padding() int64 {
+	if r := h.length % h.pieceLength; r != 0 {
+		return h.pieceLength - r
+	}
+	return 0
+}
+
+// hashFile adds the content of f to the v1 content. If isV2 is true, it
+// also returns the root of the merkle tree of f and its piece layer, which
+// are the concatenated roots of the subtrees of each piece.
+func (h *pieceHasher) hashFile(f localFile, isV2 bool) ([32]byte, []byte, error) {
+	var root [32]byte
+	file, err := os.Open(f.path)
+	if err != nil {
+		return root, nil, fmt.Errorf("could not read %v: %v", f.path, err)
+	}
+	defer file.Close()
+
+	blocksPerPiece := int(h.pieceLength / BlockLength)
+	var blocks, pieceRoots [][32]byte
+	var read int64
+	buf := make([]byte, BlockLength)
+	for {
+		n, err := io.ReadFull(file, buf)
+		if n > 0 {
+			read += int64(n)
+			h.write(buf[:n])
+			if isV2 {
+				blocks = append(blocks, sha256.Sum256(buf[:n]))
+				if len(blocks) == blocksPerPiece {
+					pieceRoots = append(pieceRoots, merkleRoot(blocks, blocksPerPiece, [32]byte{}))
+					blocks = blocks[:0]
+				}
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return root, nil, fmt.Errorf("could not read %v: %v", f.path, err)
+		}
+	}
+	if read != f.length {
+		return root, nil, fmt.Errorf("%v changed while being read", f.path)
+	}
+	if !isV2 || read == 0 {
+		return root, nil, nil
+	}
+
+	// Files of one piece at most are hashed as a single tree of blocks
+	if len(pieceRoots) == 0 {
+		return merkleRoot(blocks, nextPowerOfTwo(len(blocks)), [32]byte{}), nil, nil
+	}
+	if len(blocks) > 0 {
+		pieceRoots = append(pieceRoots, merkleRoot(blocks, blocksPerPiece, [32]byte{}))
+	}
+	layer := make([]byte, 0, 32*len(pieceRoots))
+	for _, r := range pieceRoots {
+		layer = append(layer, r[:]...)
+	}
+	pad := merkleRoot(nil, blocksPerPiece, [32]byte{})
+
+	return merkleRoot(pieceRoots, nextPowerOfTwo(len(pieceRoots)), pad), layer, nil
+}
+
+// merkleRoot returns the root of the SHA-256 merkle tree whose leaves are
+// hashes, followed by pad hashes up to count leaves. count must be a power
+// of two.
+func merkleRoot(hashes [][32]byte, count int, pad [32]byte) [32]byte {
+	layer := hashes
+	for ; count > 1; count /= 2 {
+		next := make([][32]byte, (len(layer)+1)/2)
+		for i := range next {
+			right := pad
+			if 2*i+1 < len(layer) {
+				right = layer[2*i+1]
+			}
+			next[i] = sha256.Sum256(append(layer[2*i][:], right[:]...))
+		}
+		layer = next
+		pad = sha256.Sum256(append(pad[:], pad[:]...))
+	}
+	if len(layer) == 0 {
+		return pad
+	}
+	return layer[0]
+}
+
+// nextPowerOfTwo returns the smallest power of two not below n
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p *= 2
+	}
+	return p
+}
@@ -0,0 +1,159 @@
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeContent writes a file of length bytes at path and returns its content
+func writeContent(t *testing.T, path string, length int) []byte {
+	content := make([]byte, length)
+	for i := range content {
+		content[i] = byte(i * 31 / 7)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+// hashPair returns the hash of the merkle tree node above a and b
+func hashPair(a, b [32]byte) [32]byte {
+	return sha256.Sum256(append(a[:], b[:]...))
+}
+
+func TestCreateHybrid(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "Dumas")
+	a := writeContent(t, filepath.Join(root, "a.txt"), 40000)
+	writeContent(t, filepath.Join(root, "empty"), 0)
+	b := writeContent(t, filepath.Join(root, "sub", "b.bin"), 100)
+
+	m, err := Create(root, CreateOptions{
+		PieceLength: 32768,
+		Trackers:    [][]string{{"http://tracker.example/announce"}},
+		WebSeeds:    []string{"https://example.com/Dumas/"},
+		Private:     true,
+		Comment:     "Monte-Cristo",
+		IsHybrid:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.HasV1() || !m.HasV2() || m.Name != "Dumas" || !m.IsDir || !m.Private {
+		t.Fatalf("Got torrent %+v", m)
+	}
+
+	// v1 files are aligned on pieces with padding files
+	want := []File{
+		{Path: []string{"a.txt"}, Length: 40000},
+		{Path: []string{".pad", "25536"}, Length: 25536, IsPadding: true},
+		{Path: []string{"empty"}, Length: 0},
+		{Path: []string{"sub", "b.bin"}, Length: 100},
+	}
+	if len(m.Files) != len(want) {
+		t.Fatalf("Got files %+v", m.Files)
+	}
+	for i, f := range m.Files {
+		if f.Length != want[i].Length || f.IsPadding != want[i].IsPadding || filepath.Join(f.Path...) != filepath.Join(want[i].Path...) {
+			t.Fatalf("Got file %+v, want %+v", f, want[i])
+		}
+	}
+	content := append(append(append([]byte(nil), a...), make([]byte, 25536)...), b...)
+	if len(m.Pieces) != 3 || m.Pieces[1] != sha1.Sum(content[32768:65536]) || m.Pieces[2] != sha1.Sum(content[65536:]) {
+		t.Fatal("Wrong v1 pieces")
+	}
+
+	// a.txt has a piece layer of 2 pieces, the last one being padded with
+	// zero blocks
+	block0, block1, block2 := sha256.Sum256(a[:16384]), sha256.Sum256(a[16384:32768]), sha256.Sum256(a[32768:])
+	piece0, piece1 := hashPair(block0, block1), hashPair(block2, [32]byte{})
+	pieceRoot := hashPair(piece0, piece1)
+	layer, ok := m.PieceLayers[string(pieceRoot[:])]
+	if !ok || layer != string(append(piece0[:], piece1[:]...)) {
+		t.Fatalf("Wrong piece layers %q", m.PieceLayers)
+	}
+	if len(m.PieceLayers) != 1 {
+		t.Fatal("Piece layer for a file smaller than a piece")
+	}
+
+	// The torrent file is parsed back identically
+	data, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.InfoHash != m.InfoHash || parsed.InfoHashV2 != m.InfoHashV2 || parsed.Comment != "Monte-Cristo" ||
+		len(parsed.PieceLayers) != 1 || len(parsed.WebSeeds) != 1 || len(parsed.AnnounceURLs()) != 1 {
+		t.Fatalf("Parsed torrent %+v", parsed)
+	}
+}
+
+func TestCreateSingleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tome1.epub")
+	content := writeContent(t, path, 50000)
+
+	m, err := Create(path, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "tome1.epub" || m.IsDir || m.HasV2() || m.TotalLength != 50000 || m.PieceLength != BlockLength {
+		t.Fatalf("Got torrent %+v", m)
+	}
+	if len(m.Pieces) != 4 || m.Pieces[3] != sha1.Sum(content[3*BlockLength:]) {
+		t.Fatal("Wrong pieces")
+	}
+
+	if _, err := Create(path, CreateOptions{PieceLength: 100000}); err == nil {
+		t.Fatal("No error for a piece length which is not a power of two")
+	}
+	if _, err := Create(filepath.Join(t.TempDir(), "missing"), CreateOptions{}); err == nil {
+		t.Fatal("No error for missing content")
+	}
+}
+
+func TestCreateCurrentDir(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "Dumas")
+	writeContent(t, filepath.Join(root, "a.txt"), 100)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	m, err := Create(".", CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "Dumas" || !m.IsDir || m.TotalLength != 100 {
+		t.Fatalf("Got torrent %+v", m)
+	}
+}
+
+func TestMerkleRoot(t *testing.T) {
+	h1, h2, h3 := sha256.Sum256([]byte("1")), sha256.Sum256([]byte("2")), sha256.Sum256([]byte("3"))
+	if got := merkleRoot([][32]byte{h1}, 1, [32]byte{}); got != h1 {
+		t.Fatal("Wrong root of a single leaf")
+	}
+	want := hashPair(hashPair(h1, h2), hashPair(h3, [32]byte{}))
+	if got := merkleRoot([][32]byte{h1, h2, h3}, 4, [32]byte{}); got != want {
+		t.Fatal("Wrong root of 3 leaves")
+	}
+	zero := hashPair([32]byte{}, [32]byte{})
+	want = hashPair(hashPair(h1, h2), zero)
+	if got := merkleRoot([][32]byte{h1, h2}, 4, [32]byte{}); !bytes.Equal(got[:], want[:]) {
+		t.Fatal("Wrong root of a padded tree")
+	}
+}
@@ -0,0 +1,393 @@
+// Package metainfo parses and writes .torrent files (BEP 3), including the v2
+// and hybrid torrents of BEP 52, and computes their infohashes.
+package metainfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+)
+
+// File is a file described by a torrent
+type File struct {
+	// Path is the path of the file, relative to the torrent directory for
+	// multi-file torrents. For single file torrents it is the torrent name.
+	Path   []string
+	Length int64
+	// IsPadding is true for the padding files of hybrid torrents, which align
+	// files on pieces and are not written to disk
+	IsPadding bool
+}
+
+// MetaInfo is the content of a .torrent file
+type MetaInfo struct {
+	Name string
+	// IsDir is true for multi-file torrents, whose files are stored in a
+	// directory called Name
+	IsDir       bool
+	Files       []File
+	TotalLength int64
+	PieceLength int64
+	// Pieces are the SHA-1 hashes of the pieces of v1 torrents
+	Pieces [][20]byte
+	// Trackers are the announce URLs, grouped by tier (BEP 12)
+	Trackers [][]string
+	// WebSeeds are the HTTP seeds (BEP 19)
+	WebSeeds     []string
+	Private      bool
+	CreationDate time.Time
+	Comment      string
+	CreatedBy    string
+	// MetaVersion is 1 for v1 torrents and 2 for v2 and hybrid torrents
+	MetaVersion int
+	// InfoHash is the v1 infohash, zero for v2 only torrents
+	InfoHash [20]byte
+	// InfoHashV2 is the v2 infohash, zero for v1 only torrents
+	InfoHashV2 [32]byte
+	// InfoBytes is the raw bencoded info dictionary
+	InfoBytes []byte
+	// PieceLayers are the hashes of the pieces of the v2 files larger than a
+	// piece, by pieces root
+	PieceLayers map[string]string
+}
+
+// Load parses the .torrent file at filePath
+func Load(filePath string) (*MetaInfo, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the torrent file: %v", err)
+	}
+
+	return Parse(data)
+}
+
+// Parse parses the content of a .torrent file
+func Parse(data []byte) (*MetaInfo, error) {
+	raw, err := bencode.DictRaw(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bencoding: %v", err)
+	}
+	infoBytes, ok := raw["info"]
+	if !ok {
+		return nil, fmt.Errorf("no info dictionary")
+	}
+	v, err := bencode.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bencoding: %v", err)
+	}
+	root := v.(map[string]interface{})
+
+	m, err := ParseInfo(infoBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Trackers: the announce list supersedes the announce URL (BEP 12)
+	if tiers, ok := root["announce-list"].([]interface{}); ok {
+		for _, tier := range tiers {
+			urls := stringList(tier)
+			if len(urls) > 0 {
+				m.Trackers = append(m.Trackers, urls)
+			}
+		}
+	}
+	if announce, ok := root["announce"].(string); ok && announce != "" && len(m.Trackers) == 0 {
+		m.Trackers = [][]string{{announce}}
+	}
+	switch urlList := root["url-list"].(type) {
+	case string:
+		if urlList != "" {
+			m.WebSeeds = []string{urlList}
+		}
+	case []interface{}:
+		m.WebSeeds = stringList(urlList)
+	}
+	if date, ok := root["creation date"].(int64); ok && date > 0 {
+		m.CreationDate = time.Unix(date, 0)
+	}
+	m.Comment, _ = root["comment"].(string)
+	m.CreatedBy, _ = root["created by"].(string)
+	if layers, ok := root["piece layers"].(map[string]interface{}); ok && len(layers) > 0 {
+		m.PieceLayers = make(map[string]string, len(layers))
+		for pieceRoot, layer := range layers {
+			if layer, ok := layer.(string); ok {
+				m.PieceLayers[pieceRoot] = layer
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// ParseInfo parses a raw bencoded info dictionary, like the one exchanged
+// between peers for magnet links (BEP 9).
+// Only the fields of the info dictionary are set.
+func ParseInfo(infoBytes []byte) (*MetaInfo, error) {
+	v, err := bencode.Decode(infoBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bencoding: %v", err)
+	}
+	info, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("info is not a dictionary")
+	}
+
+	m := &MetaInfo{InfoBytes: infoBytes, MetaVersion: 1}
+	m.Name, _ = info["name"].(string)
+	if m.Name == "" {
+		return nil, fmt.Errorf("no name")
+	}
+	if !isValidPathElement(m.Name) {
+		return nil, fmt.Errorf("invalid name %q", m.Name)
+	}
+	m.PieceLength, _ = info["piece length"].(int64)
+	if m.PieceLength <= 0 {
+		return nil, fmt.Errorf("invalid piece length")
+	}
+	if private, ok := info["private"].(int64); ok && private == 1 {
+		m.Private = true
+	}
+	if version, ok := info["meta version"].(int64); ok {
+		if version != 2 {
+			return nil, fmt.Errorf("unsupported meta version %d", version)
+		}
+		m.MetaVersion = 2
+	}
+
+	// v1 pieces and files
+	pieces, hasV1 := info["pieces"].(string)
+	if hasV1 {
+		if len(pieces)%20 != 0 {
+			return nil, fmt.Errorf("invalid pieces length %d", len(pieces))
+		}
+		m.Pieces = make([][20]byte, len(pieces)/20)
+		for i := range m.Pieces {
+			copy(m.Pieces[i][:], pieces[i*20:])
+		}
+		if err := m.parseFiles(info); err != nil {
+			return nil, err
+		}
+		nbPieces := (m.TotalLength + m.PieceLength - 1) / m.PieceLength
+		if int64(len(m.Pieces)) != nbPieces {
+			return nil, fmt.Errorf("%d pieces for %d bytes, %d expected", len(m.Pieces), m.TotalLength, nbPieces)
+		}
+		m.InfoHash = sha1.Sum(infoBytes)
+	}
+
+	// v2 file tree
+	if m.MetaVersion == 2 {
+		tree, ok := info["file tree"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("no file tree")
+		}
+		var files []File
+		if err := parseFileTree(tree, nil, &files, 0); err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("empty file tree")
+		}
+		if !hasV1 {
+			m.Files = files
+			m.IsDir = len(files) > 1 || len(files[0].Path) != 1 || files[0].Path[0] != m.Name
+			if !m.IsDir {
+				m.Files[0].Path = []string{m.Name}
+			}
+			for _, f := range files {
+				m.TotalLength += f.Length
+			}
+		}
+		m.InfoHashV2 = sha256.Sum256(infoBytes)
+	} else if !hasV1 {
+		return nil, fmt.Errorf("no pieces")
+	}
+
+	return m, nil
+}
+
+// parseFiles parses the files of v1 info dictionaries
+func (m *MetaInfo) parseFiles(info map[string]interface{}) error {
+	if length, ok := info["length"].(int64); ok {
+		if length < 0 {
+			return fmt.Errorf("invalid length")
+		}
+		m.Files = []File{{Path: []string{m.Name}, Length: length}}
+		m.TotalLength = length
+		return nil
+	}
+
+	files, ok := info["files"].([]interface{})
+	if !ok || len(files) == 0 {
+		return fmt.Errorf("no length nor files")
+	}
+	m.IsDir = true
+	for i, f := range files {
+		file, ok := f.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("file %d is not a dictionary", i)
+		}
+		length, ok := file["length"].(int64)
+		if !ok || length < 0 {
+			return fmt.Errorf("invalid length for file %d", i)
+		}
+		p := stringList(file["path"])
+		if len(p) == 0 {
+			return fmt.Errorf("no path for file %d", i)
+		}
+		for _, e := range p {
+			if !isValidPathElement(e) {
+				return fmt.Errorf("invalid path for file %d", i)
+			}
+		}
+		attr, _ := file["attr"].(string)
+		m.Files = append(m.Files, File{Path: p, Length: length, IsPadding: strings.ContainsRune(attr, 'p')})
+		m.TotalLength += length
+	}
+
+	return nil
+}
+
+// parseFileTree walks the file tree of v2 info dictionaries. Files are
+// appended to files in the order of their paths.
+func parseFileTree(tree map[string]interface{}, dir []string, files *[]File, depth int) error {
+	if depth > 64 {
+		return fmt.Errorf("file tree too deep")
+	}
+
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		node, ok := tree[name].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid file tree entry %q", name)
+		}
+		if name == "" {
+			// Leaf describing the file at dir
+			length, ok := node["length"].(int64)
+			if !ok || length < 0 || len(dir) == 0 {
+				return fmt.Errorf("invalid file %q", path.Join(dir...))
+			}
+			*files = append(*files, File{Path: append([]string(nil), dir...), Length: length})
+			continue
+		}
+		if !isValidPathElement(name) {
+			return fmt.Errorf("invalid path element %q", name)
+		}
+		if err := parseFileTree(node, append(dir, name), files, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Bytes returns the content of the .torrent file of m: InfoBytes as info
+// dictionary, with the trackers, web seeds, creation date, comment, creator
+// and piece layers of m
+func (m *MetaInfo) Bytes() ([]byte, error) {
+	if len(m.InfoBytes) == 0 {
+		return nil, fmt.Errorf("no info dictionary")
+	}
+	root := map[string]interface{}{
+		"info": bencode.RawMessage(m.InfoBytes),
+	}
+	if len(m.Trackers) > 0 && len(m.Trackers[0]) > 0 {
+		root["announce"] = m.Trackers[0][0]
+		if len(m.Trackers) > 1 || len(m.Trackers[0]) > 1 {
+			tiers := make([]interface{}, 0, len(m.Trackers))
+			for _, tier := range m.Trackers {
+				tiers = append(tiers, tier)
+			}
+			root["announce-list"] = tiers
+		}
+	}
+	if len(m.WebSeeds) > 0 {
+		root["url-list"] = m.WebSeeds
+	}
+	if !m.CreationDate.IsZero() {
+		root["creation date"] = m.CreationDate.Unix()
+	}
+	if m.Comment != "" {
+		root["comment"] = m.Comment
+	}
+	if m.CreatedBy != "" {
+		root["created by"] = m.CreatedBy
+	}
+	if len(m.PieceLayers) > 0 {
+		root["piece layers"] = m.PieceLayers
+	}
+
+	return bencode.Encode(root)
+}
+
+// HasV1 reports whether the torrent can be shared on v1 swarms
+func (m *MetaInfo) HasV1() bool {
+	return m.InfoHash != [20]byte{}
+}
+
+// HasV2 reports whether the torrent can be shared on v2 swarms
+func (m *MetaInfo) HasV2() bool {
+	return m.InfoHashV2 != [32]byte{}
+}
+
+// InfoHashHex returns the v1 infohash in hexadecimal, or the v2 one for v2
+// only torrents
+func (m *MetaInfo) InfoHashHex() string {
+	if m.HasV1() {
+		return hex.EncodeToString(m.InfoHash[:])
+	}
+	return hex.EncodeToString(m.InfoHashV2[:])
+}
+
+// AnnounceURLs returns the tracker URLs of all tiers, without duplicates
+func (m *MetaInfo) AnnounceURLs() []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, tier := range m.Trackers {
+		for _, u := range tier {
+			if !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls
+}
+
+// stringList converts a decoded bencoded list into strings, ignoring other
+// values
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	var strs []string
+	for _, e := range list {
+		if s, ok := e.(string); ok && s != "" {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+// isValidPathElement rejects path elements which would write files outside
+// of the torrent directory
+func isValidPathElement(e string) bool {
+	if e == "" || e == "." || e == ".." {
+		return false
+	}
+	for _, r := range e {
+		if r == '/' || r == '\\' || r == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,204 @@
+package metainfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+)
+
+// encode bencodes a torrent with the given info dictionary
+func encode(t *testing.T, info map[string]interface{}, extra map[string]interface{}) ([]byte, []byte) {
+	infoBytes, err := bencode.Encode(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := map[string]interface{}{"info": bencode.RawMessage(infoBytes)}
+	for k, v := range extra {
+		root[k] = v
+	}
+	data, err := bencode.Encode(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, infoBytes
+}
+
+func TestParseSingleFile(t *testing.T) {
+	data, infoBytes := encode(t, map[string]interface{}{
+		"name":         "ubuntu.iso",
+		"length":       40000,
+		"piece length": 16384,
+		"pieces":       strings.Repeat("a", 3*20),
+		"private":      1,
+	}, map[string]interface{}{
+		"announce":      "http://tracker.example/announce",
+		"comment":       "Ubuntu",
+		"created by":    "mktorrent",
+		"creation date": 1575385440,
+		"url-list":      "http://seed.example/ubuntu.iso",
+	})
+
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "ubuntu.iso" || m.IsDir || m.TotalLength != 40000 || len(m.Pieces) != 3 || !m.Private {
+		t.Fatalf("Wrong metainfo: %+v", m)
+	}
+	if !reflect.DeepEqual(m.Files, []File{{Path: []string{"ubuntu.iso"}, Length: 40000}}) {
+		t.Fatalf("Wrong files: %+v", m.Files)
+	}
+	if !reflect.DeepEqual(m.Trackers, [][]string{{"http://tracker.example/announce"}}) {
+		t.Fatalf("Wrong trackers: %v", m.Trackers)
+	}
+	if !reflect.DeepEqual(m.WebSeeds, []string{"http://seed.example/ubuntu.iso"}) {
+		t.Fatalf("Wrong web seeds: %v", m.WebSeeds)
+	}
+	if m.Comment != "Ubuntu" || m.CreatedBy != "mktorrent" || !m.CreationDate.Equal(time.Unix(1575385440, 0)) {
+		t.Fatalf("Wrong comment, creator or date: %+v", m)
+	}
+	if m.InfoHash != sha1.Sum(infoBytes) || !m.HasV1() || m.HasV2() {
+		t.Fatalf("Wrong infohash: %x", m.InfoHash)
+	}
+	if m.InfoHashHex() != strings.ToLower(m.InfoHashHex()) || len(m.InfoHashHex()) != 40 {
+		t.Fatalf("Wrong hex infohash: %v", m.InfoHashHex())
+	}
+}
+
+func TestParseMultiFile(t *testing.T) {
+	data, _ := encode(t, map[string]interface{}{
+		"name": "album",
+		"files": []interface{}{
+			map[string]interface{}{"length": 100, "path": []string{"cd1", "01.mp3"}},
+			map[string]interface{}{"length": 16284, "path": []string{".pad", "16284"}, "attr": "p"},
+			map[string]interface{}{"length": 50, "path": []string{"cover.jpg"}},
+		},
+		"piece length": 16384,
+		"pieces":       strings.Repeat("b", 2*20),
+	}, map[string]interface{}{
+		"announce":      "http://ignored.example/announce",
+		"announce-list": []interface{}{[]string{"http://a.example/announce", "udp://b.example:80"}, []string{"http://a.example/announce"}},
+	})
+
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsDir || len(m.Files) != 3 || m.TotalLength != 16434 {
+		t.Fatalf("Wrong metainfo: %+v", m)
+	}
+	if !m.Files[1].IsPadding || m.Files[0].IsPadding {
+		t.Fatalf("Wrong padding files: %+v", m.Files)
+	}
+	if len(m.Trackers) != 2 {
+		t.Fatalf("Wrong trackers: %v", m.Trackers)
+	}
+	if urls := m.AnnounceURLs(); !reflect.DeepEqual(urls, []string{"http://a.example/announce", "udp://b.example:80"}) {
+		t.Fatalf("Wrong announce URLs: %v", urls)
+	}
+}
+
+func TestParseV2(t *testing.T) {
+	fileTree := map[string]interface{}{
+		"dir": map[string]interface{}{
+			"b.txt": map[string]interface{}{"": map[string]interface{}{"length": 10, "pieces root": strings.Repeat("r", 32)}},
+			"a.txt": map[string]interface{}{"": map[string]interface{}{"length": 20, "pieces root": strings.Repeat("s", 32)}},
+		},
+	}
+	data, infoBytes := encode(t, map[string]interface{}{
+		"name":         "v2",
+		"meta version": 2,
+		"piece length": 16384,
+		"file tree":    fileTree,
+	}, nil)
+
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.HasV1() || !m.HasV2() || m.InfoHashV2 != sha256.Sum256(infoBytes) {
+		t.Fatalf("Wrong infohashes: %+v", m)
+	}
+	want := []File{{Path: []string{"dir", "a.txt"}, Length: 20}, {Path: []string{"dir", "b.txt"}, Length: 10}}
+	if !m.IsDir || !reflect.DeepEqual(m.Files, want) || m.TotalLength != 30 {
+		t.Fatalf("Wrong files: %+v", m.Files)
+	}
+
+	// Hybrid torrent: both infohashes, v1 files
+	data, infoBytes = encode(t, map[string]interface{}{
+		"name":         "v2.txt",
+		"meta version": 2,
+		"piece length": 16384,
+		"length":       10,
+		"pieces":       strings.Repeat("c", 20),
+		"file tree":    map[string]interface{}{"v2.txt": map[string]interface{}{"": map[string]interface{}{"length": 10}}},
+	}, nil)
+	m, err = Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.InfoHash != sha1.Sum(infoBytes) || m.InfoHashV2 != sha256.Sum256(infoBytes) || m.IsDir {
+		t.Fatalf("Wrong hybrid metainfo: %+v", m)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, err := Parse([]byte("<!DOCTYPE html><html><body>Please log in</body></html>")); err == nil {
+		t.Fatal("No error for an HTML page")
+	}
+
+	tests := map[string]map[string]interface{}{
+		"no name":      {"length": 10, "piece length": 16384, "pieces": strings.Repeat("a", 20)},
+		"wrong pieces": {"name": "x", "length": 40000, "piece length": 16384, "pieces": strings.Repeat("a", 20)},
+		"no pieces":    {"name": "x", "length": 10, "piece length": 16384},
+		"traversal": {"name": "x", "piece length": 16384, "pieces": strings.Repeat("a", 20),
+			"files": []interface{}{map[string]interface{}{"length": 10, "path": []string{"..", "etc", "passwd"}}}},
+	}
+	for name, info := range tests {
+		data, _ := encode(t, info, nil)
+		if _, err := Parse(data); err == nil {
+			t.Fatalf("No error for %v", name)
+		}
+	}
+}
+
+func TestBytes(t *testing.T) {
+	_, infoBytes := encode(t, map[string]interface{}{
+		"name":         "ubuntu.iso",
+		"length":       40000,
+		"piece length": 16384,
+		"pieces":       strings.Repeat("a", 3*20),
+	}, nil)
+	m, err := ParseInfo(infoBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Trackers = [][]string{{"http://a.example/announce"}, {"udp://b.example:6969"}}
+	m.WebSeeds = []string{"http://seed.example/ubuntu.iso"}
+	m.Comment = "Ubuntu"
+	m.CreatedBy = "torrengo"
+	m.CreationDate = time.Unix(1575385440, 0)
+
+	data, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.InfoHash != m.InfoHash || !reflect.DeepEqual(got.Trackers, m.Trackers) ||
+		!reflect.DeepEqual(got.WebSeeds, m.WebSeeds) || got.Comment != m.Comment ||
+		got.CreatedBy != m.CreatedBy || !got.CreationDate.Equal(m.CreationDate) {
+		t.Fatalf("Got metainfo %+v, want %+v", got, m)
+	}
+
+	if _, err := (&MetaInfo{}).Bytes(); err == nil {
+		t.Fatal("No error without info dictionary")
+	}
+}
@@ -16,8 +16,13 @@
 //
 // - Size: the size of the file to be downloaded
 //
+// - SizeBytes: the size converted to bytes (set to -1 if cannot be converted)
+//
 // - UplDate: the date of upload
 //
+// - UplTime and UplDatePrecision: the date of upload converted to a time, and
+// its precision (core.PrecisionUnknown if cannot be converted)
+//
 // - Leechers: the number of leechers (set to -1 if cannot be converted to integer)
 //
 // - Seechers: the number of seechers (set to -1 if cannot be converted to integer)
@@ -49,7 +54,12 @@ type Torrent struct {
 	DescURL string
 	Name    string
 	Size    string
-	UplDate string
+	// SizeBytes is set to -1 if Size cannot be converted to bytes
+	SizeBytes int64
+	UplDate   string
+	// UplTime is the zero time if UplDate cannot be converted
+	UplTime          time.Time
+	UplDatePrecision core.DatePrecision
 	// Seeders and Leechers are converted to -1 if cannot be converted to integers
 	Seeders  int
 	Leechers int
@@ -110,9 +120,11 @@ func parseSearchPage(html string) ([]Torrent, error) {
 
 		// Upload date is the text of the 4th <td> tag
 		t.UplDate = s.Find("td").Eq(3).First().Text()
+		t.UplTime, t.UplDatePrecision = core.ParseDate(t.UplDate, time.Now())
 
 		// Size is the text of the 5th <td> tag
 		t.Size = s.Find("td").Eq(4).First().Text()
+		t.SizeBytes = core.ParseSize(t.Size)
 
 		torrents = append(torrents, t)
 	})
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// readLine reads a line from user input and removes the delimiter, which
+// depends on OS, and white spaces if any
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n') // returns string + delimiter
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+
+	return strings.TrimSpace(strings.TrimSuffix(line, lineBreak)), nil
+}
+
+// promptIndexes reads from user input the indexes of the torrents to
+// download among torrents, given as a list of indexes and ranges like
+// "1,4,7-9", optionally followed by a source like "4@otts" (see
+// parseSelection).
+func promptIndexes(reader *bufio.Reader, torrents []torrent) ([]int, error) {
+	nbTorrents := len(torrents)
+	fmt.Println("Please select the torrents to download (enter their indexes, e.g. 1,4,7-9): ")
+	for {
+		indexesStr, err := readLine(reader)
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil {
+			fmt.Println("Could not read your input, please try again (should be indexes like 1,4,7-9):")
+			continue
+		}
+		indexes, err := parseSelection(indexesStr, torrents)
+		if err != nil {
+			fmt.Printf("Please enter indexes between 0 and %d (%v):%s", nbTorrents-1, err, lineBreak)
+			continue
+		}
+		return indexes, nil
+	}
+}
+
+// promptYesNo asks a question to the user and returns true if the answer is "y"
+func promptYesNo(reader *bufio.Reader, question string) (bool, error) {
+	fmt.Println(question + " [y / n]")
+	for {
+		answer, err := readLine(reader)
+		if err == io.EOF {
+			return false, err
+		}
+		if err != nil {
+			fmt.Println("Could not read your input, please try again (should be 'y' or 'n'):")
+			continue
+		}
+		return answer == "y", nil
+	}
+}
+
+// promptClient reads from user input the torrent client the user wants to
+// open the torrent in, and returns its name
+func promptClient(reader *bufio.Reader) (string, error) {
+	fmt.Println("Do you want to open torrent in Deluge (d), QBittorrent (q), or Transmission (t)?")
+	for {
+		torrentClientAbbr, err := readLine(reader)
+		if err == io.EOF {
+			return "", err
+		}
+		if err != nil {
+			fmt.Println("Could not read your input, please try again (should be 'd', 'q' or 't'):")
+			continue
+		}
+
+		// Convert user input into proper torrent client name
+		switch torrentClientAbbr {
+		case "d":
+			return "deluge", nil
+		case "q":
+			return "qbittorrent", nil
+		case "t":
+			return "transmission", nil
+		}
+		fmt.Println("Please enter a valid torrent client. It should be 'd', 'q' or 't':")
+	}
+}
+
+// promptYggCredentials reads the Ygg Torrent user ID and password from user
+// input. The password is hidden during input.
+func promptYggCredentials(reader *bufio.Reader) (string, string, error) {
+	var userID string
+	var userPass string
+
+	fmt.Println("You need an Ygg Torrent account to download the file.")
+	fmt.Println("Please enter your user ID: ")
+	for {
+		var err error
+		userID, err = readLine(reader)
+		if err == io.EOF {
+			return "", "", err
+		}
+		if err != nil {
+			fmt.Println("Could not read your input, please try again:")
+			continue
+		}
+		break
+	}
+	fmt.Println("Please enter your user pass: ")
+	// Using a special lib for password hiding during input
+	rawUserPassBytes, err := term.ReadPassword(int(syscall.Stdin))
+	if err != nil {
+		return "", "", err
+	}
+	fmt.Println()
+	userPass = strings.TrimSpace(strings.TrimSuffix(string(rawUserPassBytes), lineBreak))
+
+	return userID, userPass, nil
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/juliensalinas/torrengo/core"
+)
+
+// queryFields are the fields predicates can be applied to
+var queryFields = []string{"size", "seeders", "leechers", "date", "source"}
+
+// relativeDate matches relative dates of date predicates like "30d"
+var relativeDate = regexp.MustCompile(`^(\d+)(h|d|w|m|y)$`)
+
+// relativeDateUnits maps the units of relative dates to their duration
+var relativeDateUnits = map[string]time.Duration{
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+	"m": 30 * 24 * time.Hour,
+	"y": 365 * 24 * time.Hour,
+}
+
+// nameSeparators are replaced by spaces in torrent names before matching
+// phrases, since names often use them instead of spaces
+var nameSeparators = strings.NewReplacer(".", " ", "_", " ")
+
+// predicate is a condition on a field of the results, like seeders:>=10
+type predicate struct {
+	field string
+	// op is one of "<", "<=", ">", ">=" and "="
+	op string
+	// value is a number of bytes for size, a number of peers for seeders and
+	// leechers, and a Unix time for date
+	value int64
+}
+
+// userQuery is the parsed user search, made up of words, "quoted phrases",
+// -excluded words or phrases, and predicates like size:>1GB seeders:>=10
+// source:tpb date:<30d
+type userQuery struct {
+	words    []string
+	phrases  []string
+	excluded []string
+	// sources restricts the sources to search if not empty
+	sources    []string
+	predicates []predicate
+}
+
+// splitQuery splits the user search on white spaces, except inside double
+// quotes which are kept in the tokens
+func splitQuery(in string) []string {
+	var tokens []string
+	var token strings.Builder
+	isQuoted := false
+	for _, r := range in {
+		switch {
+		case r == '"':
+			isQuoted = !isQuoted
+			token.WriteRune(r)
+		case !isQuoted && (r == ' ' || r == '\t'):
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+		default:
+			token.WriteRune(r)
+		}
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+
+	return tokens
+}
+
+// parseQuery parses the user search.
+// Tokens looking like predicates on unknown fields (e.g. "Mission:") are
+// considered as words.
+func parseQuery(in string) (userQuery, error) {
+	var q userQuery
+	for _, token := range splitQuery(in) {
+		isExcluded := len(token) > 1 && token[0] == '-'
+		if isExcluded {
+			token = token[1:]
+		}
+
+		// Quoted phrases
+		if strings.HasPrefix(token, `"`) {
+			phrase := strings.Join(strings.Fields(strings.Trim(token, `"`)), " ")
+			if phrase == "" {
+				continue
+			}
+			if isExcluded {
+				q.excluded = append(q.excluded, phrase)
+			} else {
+				q.phrases = append(q.phrases, phrase)
+			}
+			continue
+		}
+
+		// Predicates
+		if field, value, ok := cutField(token); ok && !isExcluded {
+			if field == "source" {
+				sourcesToLookup, err := parseSources(value)
+				if err != nil {
+					return userQuery{}, err
+				}
+				q.sources = append(q.sources, sourcesToLookup...)
+				continue
+			}
+			p, err := parsePredicate(field, value)
+			if err != nil {
+				return userQuery{}, err
+			}
+			q.predicates = append(q.predicates, p)
+			continue
+		}
+
+		if isExcluded {
+			q.excluded = append(q.excluded, token)
+		} else {
+			q.words = append(q.words, token)
+		}
+	}
+	if len(q.words) == 0 && len(q.phrases) == 0 {
+		return userQuery{}, fmt.Errorf("the search should contain at least one word or phrase")
+	}
+
+	return q, nil
+}
+
+// cutField splits a token like "size:>1GB" into its field and value if the
+// field is known
+func cutField(token string) (string, string, bool) {
+	i := strings.Index(token, ":")
+	if i <= 0 || i == len(token)-1 {
+		return "", "", false
+	}
+	field := strings.ToLower(token[:i])
+	for _, f := range queryFields {
+		if f == field {
+			return field, token[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// parsePredicate parses the value of a predicate on field, made up of an
+// optional operator and a value: a size like 1GB, a number of peers, or a
+// date which is either relative (30d, 2w, 6m, 1y, 12h) or absolute
+// (2006-01-02).
+// Relative dates compare ages, so date:<30d keeps the torrents uploaded less
+// than 30 days ago.
+func parsePredicate(field, value string) (predicate, error) {
+	p := predicate{field: field, op: "="}
+	for _, op := range []string{"<=", ">=", "<", ">", "="} {
+		if strings.HasPrefix(value, op) {
+			p.op = op
+			value = value[len(op):]
+			break
+		}
+	}
+
+	switch field {
+	case "size":
+		p.value = core.ParseSize(value)
+		if p.value < 0 {
+			return predicate{}, fmt.Errorf("invalid size %v", value)
+		}
+	case "seeders", "leechers":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return predicate{}, fmt.Errorf("invalid number of %v %v", field, value)
+		}
+		p.value = int64(n)
+	case "date":
+		if m := relativeDate.FindStringSubmatch(value); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			p.value = time.Now().Add(-time.Duration(n) * relativeDateUnits[m[2]]).Unix()
+			// A smaller age means a later date
+			p.op = strings.NewReplacer("<", ">", ">", "<").Replace(p.op)
+			break
+		}
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return predicate{}, fmt.Errorf("invalid date %v, should be like 30d or 2006-01-02", value)
+		}
+		p.value = date.Unix()
+	}
+
+	return p, nil
+}
+
+// isKnown checks whether the field of t checked by p is known
+func (p predicate) isKnown(t torrent) bool {
+	switch p.field {
+	case "size":
+		return t.sizeBytes >= 0
+	case "seeders":
+		return t.seeders >= 0
+	case "leechers":
+		return t.leechers >= 0
+	case "date":
+		return !t.uplTime.IsZero()
+	}
+	return false
+}
+
+// match checks whether the field of t satisfies p.
+// Torrents whose field is unknown never match.
+func (p predicate) match(t torrent) bool {
+	if !p.isKnown(t) {
+		return false
+	}
+	var v int64
+	switch p.field {
+	case "size":
+		v = t.sizeBytes
+	case "seeders":
+		v = int64(t.seeders)
+	case "leechers":
+		v = int64(t.leechers)
+	case "date":
+		// Dates are equal if they are on the same day
+		if p.op == "=" {
+			return t.uplTime.Format("2006-01-02") == time.Unix(p.value, 0).Format("2006-01-02")
+		}
+		v = t.uplTime.Unix()
+	}
+
+	switch p.op {
+	case "<":
+		return v < p.value
+	case "<=":
+		return v <= p.value
+	case ">":
+		return v > p.value
+	case ">=":
+		return v >= p.value
+	default:
+		return v == p.value
+	}
+}
+
+// siteInput returns the search sent to source.
+// Archive.org supports phrases and exclusions, other sources only get the
+// words of the search.
+func (q userQuery) siteInput(source string) string {
+	var parts []string
+	if source == "arc" {
+		parts = append(parts, q.words...)
+		for _, phrase := range q.phrases {
+			parts = append(parts, `"`+phrase+`"`)
+		}
+		for _, excluded := range q.excluded {
+			if strings.Contains(excluded, " ") {
+				excluded = `"` + excluded + `"`
+			}
+			parts = append(parts, "-"+excluded)
+		}
+		return strings.Join(parts, " ")
+	}
+
+	parts = append(parts, q.words...)
+	parts = append(parts, q.phrases...)
+	return strings.Join(parts, " ")
+}
+
+// match checks whether t satisfies the parts of the search the sources
+// cannot apply: phrases, exclusions and predicates
+func (q userQuery) match(t torrent) bool {
+	name := strings.Join(strings.Fields(nameSeparators.Replace(strings.ToLower(t.name))), " ")
+	for _, phrase := range q.phrases {
+		if !strings.Contains(name, strings.ToLower(phrase)) {
+			return false
+		}
+	}
+	for _, excluded := range q.excluded {
+		if containsWord(name, strings.ToLower(excluded)) {
+			return false
+		}
+	}
+	for _, p := range q.predicates {
+		if !p.match(t) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsWord checks whether s contains word as a whole word, so that
+// excluding "cam" does not drop "American"
+func containsWord(s, word string) bool {
+	for i := 0; i+len(word) <= len(s); {
+		j := strings.Index(s[i:], word)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(word)
+		before, _ := utf8.DecodeLastRuneInString(s[:start])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		i = start + 1
+	}
+	return false
+}
+
+// isWordRune checks whether r is part of a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// restrictSources returns the sources of sourcesToLookup allowed by the
+// source: predicates of the search
+func (q userQuery) restrictSources(sourcesToLookup []string) []string {
+	if len(q.sources) == 0 {
+		return sourcesToLookup
+	}
+	var restricted []string
+	for _, source := range sourcesToLookup {
+		for _, s := range q.sources {
+			if s == source {
+				restricted = append(restricted, source)
+				break
+			}
+		}
+	}
+	return restricted
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	q, err := parseQuery(`Dumas "Monte Cristo" -abridged -"le film" size:>1GB seeders:>=10 source:tpb,arc date:<30d Mission:`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Dumas", "Mission:"}; !reflect.DeepEqual(q.words, want) {
+		t.Fatalf("Got words %q, want %q", q.words, want)
+	}
+	if want := []string{"Monte Cristo"}; !reflect.DeepEqual(q.phrases, want) {
+		t.Fatalf("Got phrases %q, want %q", q.phrases, want)
+	}
+	if want := []string{"abridged", "le film"}; !reflect.DeepEqual(q.excluded, want) {
+		t.Fatalf("Got excluded %q, want %q", q.excluded, want)
+	}
+	if want := []string{"tpb", "arc"}; !reflect.DeepEqual(q.sources, want) {
+		t.Fatalf("Got sources %q, want %q", q.sources, want)
+	}
+	if len(q.predicates) != 3 {
+		t.Fatalf("Got %d predicates, want 3", len(q.predicates))
+	}
+	if p := q.predicates[0]; p != (predicate{field: "size", op: ">", value: 1e9}) {
+		t.Fatalf("Got size predicate %+v", p)
+	}
+	if p := q.predicates[2]; p.op != ">" {
+		t.Fatalf("Got op %v for date:<30d, want >", p.op)
+	}
+
+	if got := q.siteInput("arc"); got != `Dumas Mission: "Monte Cristo" -abridged -"le film"` {
+		t.Fatalf("Got arc input %q", got)
+	}
+	if got := q.siteInput("tpb"); got != "Dumas Mission: Monte Cristo" {
+		t.Fatalf("Got tpb input %q", got)
+	}
+	if got := q.restrictSources([]string{"arc", "otts", "tpb"}); !reflect.DeepEqual(got, []string{"arc", "tpb"}) {
+		t.Fatalf("Got sources %v, want [arc tpb]", got)
+	}
+
+	for _, in := range []string{"size:>1GB", "Dumas size:>huge", "Dumas source:foo", "Dumas date:<yesterday"} {
+		if _, err := parseQuery(in); err == nil {
+			t.Fatalf("Expected an error for %q", in)
+		}
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	q, err := parseQuery(`"monte cristo" -abridged size:>1GB seeders:>=10 date:<30d`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent := time.Now().Add(-48 * time.Hour)
+	old := time.Now().Add(-60 * 24 * time.Hour)
+
+	tests := []struct {
+		t    torrent
+		want bool
+	}{
+		{torrent{name: "The.Count.of.Monte.Cristo.2002", sizeBytes: 2e9, seeders: 10, uplTime: recent}, true},
+		{torrent{name: "Monte Cristo abridged", sizeBytes: 2e9, seeders: 10, uplTime: recent}, false},
+		{torrent{name: "Monte Cristo (Abridged)", sizeBytes: 2e9, seeders: 10, uplTime: recent}, false},
+		{torrent{name: "Monte Cristo unabridged", sizeBytes: 2e9, seeders: 10, uplTime: recent}, true},
+		{torrent{name: "Monte Cristo", sizeBytes: 700e6, seeders: 10, uplTime: recent}, false},
+		{torrent{name: "Monte Cristo", sizeBytes: 2e9, seeders: 9, uplTime: recent}, false},
+		{torrent{name: "Monte Cristo", sizeBytes: 2e9, seeders: 10, uplTime: old}, false},
+		{torrent{name: "Monte Cristo", sizeBytes: -1, seeders: -1}, false},
+		{torrent{name: "Les Trois Mousquetaires", sizeBytes: 2e9, seeders: 10, uplTime: recent}, false},
+	}
+	for _, test := range tests {
+		if got := q.match(test.t); got != test.want {
+			t.Fatalf("Got %v for %+v, want %v", got, test.t, test.want)
+		}
+	}
+}
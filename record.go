@@ -0,0 +1,67 @@
+package main
+
+import "time"
+
+// record is the unified torrent model exposed to other programs
+type record struct {
+	Name string `json:"name"`
+	// Size is the size as displayed by the source and SizeBytes its
+	// conversion to bytes (-1 if unknown)
+	Size      string `json:"size"`
+	SizeBytes int64  `json:"sizeBytes"`
+	// Seeders and Leechers are set to -1 if unknown. TrackerVerified is true
+	// if they were given by the trackers of the torrent.
+	Seeders         int  `json:"seeders"`
+	Leechers        int  `json:"leechers"`
+	TrackerVerified bool `json:"trackerVerified"`
+	// UplDate is the upload date as displayed by the source, UplDateISO
+	// its conversion to ISO 8601 (empty if unknown), and UplDatePrecision the
+	// precision of the conversion: unknown, day, hour, minute or second
+	UplDate          string `json:"uplDate"`
+	UplDateISO       string `json:"uplDateISO"`
+	UplDatePrecision string `json:"uplDatePrecision"`
+	Source           string `json:"source"`
+	// Sources are all the sources of merged torrents, starting with Source,
+	// the one they are retrieved from
+	Sources []string `json:"sources,omitempty"`
+	DescURL string   `json:"descURL,omitempty"`
+	Magnet  string   `json:"magnet,omitempty"`
+	// InfoHash is the infohash in lowercase hexadecimal, empty until the
+	// magnet or the torrent file is known
+	InfoHash string `json:"infoHash,omitempty"`
+}
+
+// newRecord converts a torrent into a record
+func newRecord(t torrent) record {
+	var uplDateISO string
+	if !t.uplTime.IsZero() {
+		uplDateISO = t.uplTime.Format(time.RFC3339)
+	}
+
+	var mergedSources []string
+	if t.mergedFrom != nil {
+		mergedSources = []string{t.source}
+		for _, e := range t.mergedFrom {
+			if !contains(mergedSources, e.source) {
+				mergedSources = append(mergedSources, e.source)
+			}
+		}
+	}
+
+	return record{
+		Name:             t.name,
+		Size:             t.size,
+		SizeBytes:        t.sizeBytes,
+		Seeders:          t.seeders,
+		Leechers:         t.leechers,
+		TrackerVerified:  t.isTrackerVerified,
+		UplDate:          t.uplDate,
+		UplDateISO:       uplDateISO,
+		UplDatePrecision: t.uplDatePrecision.String(),
+		Source:           t.source,
+		Sources:          mergedSources,
+		DescURL:          t.descURL,
+		Magnet:           t.magnet,
+		InfoHash:         t.infoHash,
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/juliensalinas/torrengo/core"
+)
+
+// replHelp lists the commands of the interactive shell
+const replHelp = `Commands:
+  search <words>       search the sources
+  filter <words>       only keep results whose name contains all the words
+  sort <keys>          sort results by relevance, seeders, leechers, size,
+                       date, name or source (e.g. -size,seeders)
+  sources [sources]    show or set the comma separated list of sources to search
+  list                 show the current results
+  show <index>         show the details of a result
+  get <indexes> [client]
+                       retrieve the magnets or torrent files of results (e.g.
+                       1,4,7-9, or 4@otts to choose the source of a merged
+                       result), and optionally open them in a torrent client
+  back                 go back to the previous results
+  help                 show this help
+  quit                 leave the shell`
+
+// repl is an interactive shell keeping the browser and the results between
+// searches
+type repl struct {
+	reader          *bufio.Reader
+	out             io.Writer
+	sourcesToLookup []string
+	timeout         time.Duration
+	torrentClient   string
+	yggUserID       string
+	yggUserPass     string
+	// isMerged is true if the torrents found on several sources are merged
+	isMerged bool
+	// isScrape is true if seeders and leechers are refreshed from trackers
+	isScrape bool
+
+	// history contains the successive results, the last one being the
+	// current one. filter, sort and search add results to the history and
+	// back removes the last one.
+	history []search
+}
+
+// current returns the current results
+func (r *repl) current() *search {
+	if len(r.history) == 0 {
+		return nil
+	}
+	return &r.history[len(r.history)-1]
+}
+
+// push adds a copy of the current results to the history and returns it so
+// it can be modified
+func (r *repl) push() *search {
+	s := *r.current()
+	s.out = append([]torrent(nil), s.out...)
+	r.history = append(r.history, s)
+	return r.current()
+}
+
+// exec executes a command line and returns false if the user wants to quit
+func (r *repl) exec(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+	cmd, args := fields[0], strings.Join(fields[1:], " ")
+
+	switch cmd {
+	case "quit", "exit":
+		return false
+	case "help":
+		fmt.Fprintln(r.out, replHelp)
+	case "search":
+		r.search(args)
+	case "sources":
+		r.sources(args)
+	case "filter", "sort", "list", "show", "get", "back":
+		if r.current() == nil {
+			fmt.Fprintln(r.out, "No results yet, please search first.")
+			return true
+		}
+		switch cmd {
+		case "filter":
+			s := r.push()
+			s.filterOut(args)
+			render(s.out)
+		case "sort":
+			s := r.push()
+			if err := s.sortOutBy(args); err != nil {
+				r.history = r.history[:len(r.history)-1]
+				fmt.Fprintf(r.out, "Please sort by %v, or a comma separated list of them.%v", strings.Join(sortKeys, ", "), lineBreak)
+				return true
+			}
+			render(s.out)
+		case "list":
+			render(r.current().out)
+		case "show":
+			if t := r.result(fields[1:]); t != nil {
+				r.show(*t)
+			}
+		case "get":
+			if len(fields) < 2 {
+				fmt.Fprintln(r.out, "Please enter the indexes of results, e.g. 1,4,7-9.")
+				return true
+			}
+			indexes, err := parseSelection(fields[1], r.current().out)
+			if err != nil {
+				fmt.Fprintf(r.out, "Please enter indexes between 0 and %d (%v).%s", len(r.current().out)-1, err, lineBreak)
+				return true
+			}
+			torrentClient := r.torrentClient
+			if len(fields) > 2 {
+				torrentClient = strings.Join(fields[2:], " ")
+			}
+			r.get(indexes, torrentClient)
+		case "back":
+			if len(r.history) == 1 {
+				fmt.Fprintln(r.out, "Already at the first results.")
+				return true
+			}
+			r.history = r.history[:len(r.history)-1]
+			render(r.current().out)
+		}
+	default:
+		fmt.Fprintf(r.out, "Unknown command %v, type help to list commands.%v", cmd, lineBreak)
+	}
+
+	return true
+}
+
+// search searches the sources and makes results the current ones
+func (r *repl) search(in string) {
+	s := search{
+		in:              strings.TrimSpace(in),
+		sourcesToLookup: r.sourcesToLookup,
+	}
+	if err := s.cleanIn(); err != nil {
+		fmt.Fprintln(r.out, "Please enter words to search.")
+		return
+	}
+	if _, err := parseQuery(s.in); err != nil {
+		fmt.Fprintf(r.out, "Your search is not correct: %v%v", err, lineBreak)
+		return
+	}
+
+	err := s.lookup(r.timeout)
+	for source := range s.errs {
+		fmt.Fprintf(r.out, "An error occured during search on %v%v", sources[source], lineBreak)
+	}
+	if err != nil {
+		fmt.Fprintln(r.out, "All searches returned an error.")
+		return
+	}
+	if r.isScrape {
+		s.scrapeOut(r.timeout)
+	}
+	if r.isMerged {
+		s.mergeOut()
+	}
+	s.sortOut()
+
+	r.history = append(r.history, s)
+	if len(s.out) == 0 {
+		fmt.Fprintln(r.out, "No result found...")
+		return
+	}
+	render(s.out)
+}
+
+// sources shows or sets the sources to search
+func (r *repl) sources(usrSources string) {
+	if usrSources != "" {
+		sourcesToLookup, err := parseSources(strings.Replace(usrSources, " ", "", -1))
+		if err != nil {
+			fmt.Fprintf(r.out, "This website is not correct: %v%v", err, lineBreak)
+			return
+		}
+		r.sourcesToLookup = sourcesToLookup
+	}
+
+	var names []string
+	for _, source := range r.sourcesToLookup {
+		names = append(names, source+" ("+sources[source]+")")
+	}
+	fmt.Fprintf(r.out, "Searching %v%v", strings.Join(names, ", "), lineBreak)
+}
+
+// result returns the current result whose index is the first argument
+func (r *repl) result(args []string) *torrent {
+	s := r.current()
+	if len(args) == 0 {
+		fmt.Fprintln(r.out, "Please enter the index of a result.")
+		return nil
+	}
+	index, err := strconv.Atoi(args[0])
+	if err != nil || index < 0 || index >= len(s.out) {
+		fmt.Fprintf(r.out, "Please enter an index between 0 and %d.%s", len(s.out)-1, lineBreak)
+		return nil
+	}
+	return &s.out[index]
+}
+
+// show prints the details of a result
+func (r *repl) show(t torrent) {
+	for _, field := range [][2]string{
+		{"Name", t.name},
+		{"Size", displaySize(t)},
+		{"Seeders", unknownIfNegative(t.seeders)},
+		{"Leechers", unknownIfNegative(t.leechers)},
+		{"Upload date", displayUplDate(t)},
+		{"Source", displaySources(t)},
+		{"Trackers", strings.Join(t.trackers, " ")},
+		{"Description", t.descURL},
+		{"Magnet", t.magnet},
+		{"Torrent file", t.filePath},
+	} {
+		if field[1] != "" {
+			fmt.Fprintf(r.out, "%-13s%s%s", field[0]+":", field[1], lineBreak)
+		}
+	}
+
+	if t.isTrackerVerified {
+		fmt.Fprintln(r.out, "Seeders and leechers were given by the trackers.")
+	}
+
+	// Merged results can be retrieved from each of their sources
+	for _, e := range t.mergedFrom {
+		fmt.Fprintf(r.out, "  %-11s%s seeders, %s leechers%s",
+			e.source+":", unknownIfNegative(e.seeders), unknownIfNegative(e.leechers), lineBreak)
+	}
+}
+
+// get concurrently retrieves the magnets or the torrent files of the current
+// results at the given indexes, and optionally opens them in a torrent client
+func (r *repl) get(indexes []int, torrentClient string) {
+	s := r.current()
+	for _, index := range indexes {
+		if s.out[index].source == "ygg" && r.yggUserID == "" {
+			var err error
+			r.yggUserID, r.yggUserPass, err = promptYggCredentials(r.reader)
+			if err != nil {
+				fmt.Fprintln(r.out, "Could not read your Ygg Torrent credentials.")
+				return
+			}
+			break
+		}
+	}
+
+	results := resolveAll(s, indexes, r.yggUserID, r.yggUserPass, r.timeout, defaultMetadataTimeout, false, torrentClient)
+
+	for _, result := range results {
+		t := s.out[result.index]
+		if result.err != nil {
+			fmt.Fprintf(r.out, "%d: could not process %v (%v)%s", result.index, t.name, result.err, lineBreak)
+			continue
+		}
+		fmt.Fprintf(r.out, "%d: %v%s", result.index, result.resource, lineBreak)
+	}
+	if torrentClient != "" {
+		fmt.Fprintln(r.out, "Opened the retrieved torrents in client.")
+	}
+}
+
+// shellCmd parses the shell subcommand flags and launches the interactive
+// shell
+func shellCmd(args []string) {
+	flags := flag.NewFlagSet("shell", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(
+			flags.Output(),
+			"Usage of %[1]s shell:%[2]s%[2]s\t%[1]s shell [-client client] [-no-merge] [-s sources] [-scrape] [-t timeout] [-v]%[2]s%[2]s"+
+				"%[3]s%[2]s%[2]sOptions:%[2]s%[2]s",
+			os.Args[0], lineBreak, replHelp,
+		)
+		flags.PrintDefaults()
+	}
+	torrentClient := flags.String("client", "", "Torrent client used by get if none is given: "+
+		"deluge | qbittorrent | transmission, or any command line the magnet or torrent file is appended to.")
+	usrSources := flags.String("s", "all", "A comma separated list of sources "+
+		"you want to search."+lineBreak+"Choices: arc (Archive.org) | tpb (ThePirateBay) | otts (1337x) | ygg (YggTorrent). ")
+	isNoMerge := flags.Bool("no-merge", false, "Do not merge the torrents found on several sources.")
+	isScrape := flags.Bool("scrape", false, "Refresh seeders and leechers from the trackers of the torrents whose magnet is known.")
+	timeoutInMillisec := flags.Int("t", 20000, "Timeout of HTTP requests in milliseconds. Set it to 0 to completely remove timeout.")
+	isVerbosePtr := flags.Bool("v", false, "Verbose mode. Use it to see more logs.")
+	flags.Parse(args)
+
+	isVerbose = *isVerbosePtr
+	setLogger(isVerbose)
+
+	if err := loadExtraTrackers(); err != nil {
+		fmt.Printf("Could not use your trackers: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+	sourcesToLookup, err := parseSources(*usrSources)
+	if err != nil {
+		fmt.Printf("This website is not correct: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+
+	// Keep the same browser, and thus its cookies, during the whole session
+	fmt.Println("Launching browser...")
+	closeBrowser, err := core.StartBrowser()
+	if err != nil {
+		fmt.Println("Could not launch browser (see logs for more details).")
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("Could not launch browser")
+	}
+	defer closeBrowser()
+
+	r := repl{
+		reader:          bufio.NewReader(os.Stdin),
+		out:             os.Stdout,
+		sourcesToLookup: sourcesToLookup,
+		timeout:         time.Duration(*timeoutInMillisec) * time.Millisecond,
+		torrentClient:   *torrentClient,
+		isMerged:        !*isNoMerge,
+		isScrape:        *isScrape,
+		yggUserID:       os.Getenv("TORRENGO_YGG_ID"),
+		yggUserPass:     os.Getenv("TORRENGO_YGG_PASS"),
+	}
+	fmt.Println("Type help to list commands.")
+
+	// If a search was given as arguments, launch it right away
+	if flags.NArg() > 0 {
+		r.search(strings.Join(flags.Args(), " "))
+	}
+	for {
+		fmt.Print("torrengo> ")
+		line, err := readLine(r.reader)
+		if err != nil {
+			fmt.Println()
+			return
+		}
+		if !r.exec(line) {
+			return
+		}
+	}
+}
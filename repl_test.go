@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestReplHistory(t *testing.T) {
+	r := &repl{out: io.Discard, history: []search{{in: "dumas", out: []torrent{
+		{name: "Le Comte de Monte-Cristo", seeders: 3, leechers: 1},
+		{name: "Les Trois Mousquetaires", seeders: 5, leechers: 2},
+		{name: "Monte Cristo (2002)", seeders: 1, leechers: 7},
+	}}}}
+	names := func() []string {
+		var names []string
+		for _, t := range r.current().out {
+			names = append(names, t.name)
+		}
+		return names
+	}
+
+	r.exec("filter monte")
+	if want := []string{"Le Comte de Monte-Cristo", "Monte Cristo (2002)"}; !reflect.DeepEqual(names(), want) {
+		t.Fatalf("Got %q once filtered, want %q", names(), want)
+	}
+	r.exec("sort leechers")
+	if want := []string{"Monte Cristo (2002)", "Le Comte de Monte-Cristo"}; !reflect.DeepEqual(names(), want) {
+		t.Fatalf("Got %q once sorted, want %q", names(), want)
+	}
+
+	// An invalid sort key should not change the results
+	r.exec("sort foo")
+	if len(r.history) != 3 {
+		t.Fatalf("Got %d results in history, want 3", len(r.history))
+	}
+
+	r.exec("back")
+	r.exec("back")
+	if len(names()) != 3 {
+		t.Fatalf("Got %d results after going back, want 3", len(names()))
+	}
+	r.exec("back")
+	if len(r.history) != 1 {
+		t.Fatalf("Got %d results in history, want 1", len(r.history))
+	}
+
+	if !r.exec("list") || r.exec("quit") {
+		t.Fatal("Only quit should end the shell")
+	}
+}
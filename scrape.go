@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/juliensalinas/torrengo/tracker"
+)
+
+// maxConcurrentScrapes is the maximum number of trackers scraped at the same
+// time
+const maxConcurrentScrapes = 8
+
+// scrapeOut refreshes the seeders and leechers of the torrents of s with the
+// figures of their trackers, when their infohash and trackers are known.
+// Refreshed torrents are marked as tracker-verified. Trackers which fail are
+// ignored.
+func (s *search) scrapeOut(timeout time.Duration) {
+	stats := scrapeTorrents(s.out, timeout)
+	for i := range s.out {
+		applyStats(&s.out[i], stats)
+	}
+}
+
+// scrapeTorrents concurrently scrapes the trackers of torrents and returns
+// the figures of each infohash. When trackers disagree, the one seeing the
+// most seeders is kept.
+func scrapeTorrents(torrents []torrent, timeout time.Duration) map[string]tracker.Stats {
+	// Group infohashes by tracker, so that each tracker is scraped once
+	hashesByTracker := make(map[string][][20]byte)
+	seen := make(map[string]bool)
+	for _, t := range torrents {
+		for _, e := range entries(t) {
+			var h [20]byte
+			// Only v1 infohashes can be scraped
+			if len(e.infoHash) != 2*len(h) {
+				continue
+			}
+			if _, err := hex.Decode(h[:], []byte(e.infoHash)); err != nil {
+				continue
+			}
+			for _, tr := range e.trackers {
+				if !seen[tr+e.infoHash] {
+					seen[tr+e.infoHash] = true
+					hashesByTracker[tr] = append(hashesByTracker[tr], h)
+				}
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	stats := make(map[string]tracker.Stats)
+	sem := make(chan struct{}, maxConcurrentScrapes)
+	var wg sync.WaitGroup
+	for tr, hashes := range hashesByTracker {
+		wg.Add(1)
+		go func(tr string, hashes [][20]byte) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			trackerStats, err := tracker.Scrape(tr, hashes, timeout)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"tracker": tr,
+					"error":   err,
+				}).Debug("Could not scrape tracker")
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			isUDP := strings.HasPrefix(tr, "udp://")
+			for h, st := range trackerStats {
+				// UDP trackers give zeros for the torrents they do not know,
+				// while HTTP trackers leave them out
+				if isUDP && st == (tracker.Stats{}) {
+					continue
+				}
+				infoHash := hex.EncodeToString(h[:])
+				if prev, ok := stats[infoHash]; !ok || st.Seeders > prev.Seeders {
+					stats[infoHash] = st
+				}
+			}
+		}(tr, hashes)
+	}
+	wg.Wait()
+
+	return stats
+}
+
+// applyStats sets the seeders and leechers of t, and of the torrents merged
+// into it, to the figures of their trackers.
+// Merged torrents are tracker-verified if all their sources are.
+func applyStats(t *torrent, stats map[string]tracker.Stats) {
+	if t.mergedFrom == nil {
+		if st, ok := stats[t.infoHash]; ok {
+			t.seeders, t.leechers = st.Seeders, st.Leechers
+			t.isTrackerVerified = true
+		}
+		return
+	}
+
+	isVerified := true
+	for i := range t.mergedFrom {
+		applyStats(&t.mergedFrom[i], stats)
+		isVerified = isVerified && t.mergedFrom[i].isTrackerVerified
+	}
+	t.seeders, t.leechers = combinedPeers(t.mergedFrom)
+	t.isTrackerVerified = isVerified
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+)
+
+func TestScrapeOut(t *testing.T) {
+	known := "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+	dead := "fedcba9876543210fedcba9876543210fedcba98"
+	deadBytes, _ := hex.DecodeString(dead)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files := make(map[string]interface{})
+		for _, h := range r.URL.Query()["info_hash"] {
+			files[h] = map[string]interface{}{"complete": 42, "incomplete": 7, "downloaded": 100}
+			if h == string(deadBytes) {
+				files[h] = map[string]interface{}{"complete": 0, "incomplete": 0, "downloaded": 0}
+			}
+		}
+		b, _ := bencode.Encode(map[string]interface{}{"files": files})
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	s := &search{out: []torrent{
+		{name: "Monte Cristo", source: "tpb", seeders: 3, leechers: 1,
+			magnet: "magnet:?xt=urn:btih:" + known + "&tr=" + ts.URL + "/announce"},
+		{name: "Vingt ans après", source: "arc", seeders: -1, leechers: -1},
+		{name: "Les Trois Mousquetaires", source: "tpb", seeders: 5, leechers: 2,
+			magnet: "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&tr=http%3A%2F%2F127.0.0.1%3A1%2Fannounce"},
+		{name: "Le Vicomte de Bragelonne", source: "tpb", seeders: 8, leechers: 3,
+			magnet: "magnet:?xt=urn:btih:" + dead + "&tr=" + ts.URL + "/announce"},
+	}}
+	for i := range s.out {
+		setInfoHash(&s.out[i])
+	}
+	s.scrapeOut(time.Second)
+
+	if tor := s.out[0]; tor.seeders != 42 || tor.leechers != 7 || !tor.isTrackerVerified {
+		t.Fatalf("Torrent should be refreshed: %+v", tor)
+	}
+	if tor := s.out[1]; tor.seeders != -1 || tor.isTrackerVerified {
+		t.Fatalf("Torrent without infohash should not change: %+v", tor)
+	}
+	if tor := s.out[2]; tor.seeders != 5 || tor.isTrackerVerified {
+		t.Fatalf("Torrent whose tracker failed should not change: %+v", tor)
+	}
+	if tor := s.out[3]; tor.seeders != 0 || tor.leechers != 0 || !tor.isTrackerVerified {
+		t.Fatalf("Dead torrent should be refreshed: %+v", tor)
+	}
+	if r := newRecord(s.out[0]); !r.TrackerVerified {
+		t.Fatal("Record should be tracker-verified")
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/publicsuffix"
+)
+
+// webUI contains the single page web UI served at the root of the server
+//
+//go:embed web
+var webUI embed.FS
+
+// server exposes the torrengo sources over HTTP
+type server struct {
+	sourcesToLookup []string
+	timeout         time.Duration
+	// apiKey is required from clients if not empty
+	apiKey string
+	// secret is used to sign the download links given to clients
+	secret []byte
+	// Ygg Torrent credentials needed to download ygg torrent files
+	yggUserID   string
+	yggUserPass string
+	// torrentClient is the torrent client results are pushed to
+	torrentClient string
+
+	mu sync.Mutex
+	// httpClient is the http client returned by the last ygg search.
+	// It holds the cookies needed to download ygg torrent files.
+	httpClient *http.Client
+	// health tracks the results of the searches on each source
+	health map[string]*sourceHealth
+}
+
+// newServer creates a server searching the given sources.
+// If no API key is set, a random secret is used to sign download links, which
+// means links do not survive a restart of the server.
+func newServer(sourcesToLookup []string, timeout time.Duration, apiKey string) (*server, error) {
+	srv := &server{
+		sourcesToLookup: sourcesToLookup,
+		timeout:         timeout,
+		apiKey:          apiKey,
+		yggUserID:       os.Getenv("TORRENGO_YGG_ID"),
+		yggUserPass:     os.Getenv("TORRENGO_YGG_PASS"),
+		health:          make(map[string]*sourceHealth),
+	}
+	for source := range sources {
+		srv.health[source] = &sourceHealth{Source: source, Name: sources[source], Status: "unknown"}
+	}
+	for _, source := range sourcesToLookup {
+		srv.health[source].Enabled = true
+	}
+
+	if apiKey != "" {
+		secret := sha256.Sum256([]byte(apiKey))
+		srv.secret = secret[:]
+	} else {
+		srv.secret = make([]byte, 32)
+		if _, err := rand.Read(srv.secret); err != nil {
+			return nil, fmt.Errorf("could not generate a secret: %v", err)
+		}
+	}
+
+	return srv, nil
+}
+
+// search launches a search on the given sources and returns merged results.
+// Handlers sort them.
+func (srv *server) search(in string, sourcesToLookup []string, timeout time.Duration) (search, error) {
+	s := search{
+		in:              strings.TrimSpace(in),
+		sourcesToLookup: sourcesToLookup,
+	}
+	if err := s.cleanIn(); err != nil {
+		return s, err
+	}
+
+	err := s.lookup(timeout)
+	for source, sourceErr := range s.errs {
+		log.WithFields(log.Fields{
+			"input":          s.in,
+			"sourceToSearch": source,
+			"error":          sourceErr,
+		}).Error("Search failed on source")
+	}
+	srv.updateHealth(s)
+	if err != nil {
+		return s, err
+	}
+	s.mergeOut()
+
+	// Keep the ygg cookies for later torrent file downloads
+	if s.httpClient != nil {
+		srv.mu.Lock()
+		srv.httpClient = s.httpClient
+		srv.mu.Unlock()
+	}
+
+	return s, nil
+}
+
+// updateHealth updates the health of the sources searched by s
+func (srv *server) updateHealth(s search) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	now := time.Now()
+	for _, source := range s.sourcesToLookup {
+		h := srv.health[source]
+		h.LastSearch = &now
+		if err, ok := s.errs[source]; ok {
+			h.Status = "failing"
+			h.LastError = err.Error()
+			h.Failures++
+			continue
+		}
+		h.Status = "ok"
+		h.LastSuccess = &now
+		h.Successes++
+	}
+}
+
+// yggHTTPClient returns a copy of the http client of the last ygg search, or
+// a new one if no ygg search was done yet.
+// A copy is returned because ygg.FindAndDlFile modifies the client timeout.
+func (srv *server) yggHTTPClient() *http.Client {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.httpClient == nil {
+		cookieJar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		return &http.Client{Jar: cookieJar}
+	}
+	httpClient := *srv.httpClient
+	return &httpClient
+}
+
+// authorized checks the API key sent by the client, either as an "apikey" GET
+// parameter or as an "X-Api-Key" header
+func (srv *server) authorized(r *http.Request) bool {
+	if srv.apiKey == "" {
+		return true
+	}
+	key := r.URL.Query().Get("apikey")
+	if key == "" {
+		key = r.Header.Get("X-Api-Key")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(key), []byte(srv.apiKey)) == 1
+}
+
+// sign returns the signature of a download link so clients cannot make the
+// server fetch arbitrary urls
+func (srv *server) sign(source, descURL, in string) string {
+	mac := hmac.New(sha256.New, srv.secret)
+	mac.Write([]byte(source + "\x00" + descURL + "\x00" + in))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedURL returns the absolute url of the given server path with the
+// parameters needed to resolve t lazily
+func (srv *server) signedURL(r *http.Request, path string, t torrent, in string) string {
+	params := url.Values{
+		"source": {t.source},
+		"url":    {t.descURL},
+		"q":      {in},
+		"sig":    {srv.sign(t.source, t.descURL, in)},
+	}
+
+	return baseURL(r) + path + "?" + params.Encode()
+}
+
+// verify retrieves the torrent and the user search from the parameters of a
+// signed url.
+// false is returned if the signature is wrong.
+func (srv *server) verify(params url.Values) (torrent, string, bool) {
+	t := torrent{
+		source:  params.Get("source"),
+		descURL: params.Get("url"),
+	}
+	in := params.Get("q")
+	ok := hmac.Equal([]byte(params.Get("sig")), []byte(srv.sign(t.source, t.descURL, in)))
+
+	return t, in, ok
+}
+
+// handleDl resolves a signed download link.
+// Magnets are returned as a redirection while torrent files are sent as is.
+func (srv *server) handleDl(w http.ResponseWriter, r *http.Request) {
+	t, in, ok := srv.verify(r.URL.Query())
+	if !ok {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	// tpb magnets are known at search time so they never go through here
+	switch t.source {
+	case "otts":
+		if err := getMagnet(&t, srv.timeout); err != nil {
+			log.WithFields(log.Fields{
+				"descURL": t.descURL,
+				"error":   err,
+			}).Error("Could not retrieve magnet")
+			http.Error(w, "could not retrieve magnet", http.StatusBadGateway)
+			return
+		}
+		http.Redirect(w, r, t.magnet, http.StatusFound)
+	case "arc", "ygg":
+		srv.sendTorrentFile(w, t, in)
+	default:
+		http.Error(w, "unknown source", http.StatusBadRequest)
+	}
+}
+
+// sendTorrentFile downloads the torrent file of t and sends it to the client.
+// The local copy of the file is removed afterwards.
+func (srv *server) sendTorrentFile(w http.ResponseWriter, t torrent, in string) {
+	if in == "" {
+		in = "torrengo"
+	}
+	err := getTorrentFile(&t, srv.yggUserID, in, srv.yggUserPass, srv.timeout, srv.yggHTTPClient())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"descURL": t.descURL,
+			"error":   err,
+		}).Error("Could not retrieve the torrent file")
+		http.Error(w, "could not retrieve the torrent file", http.StatusBadGateway)
+		return
+	}
+	defer os.Remove(t.filePath)
+
+	f, err := os.Open(t.filePath)
+	if err != nil {
+		http.Error(w, "could not open the torrent file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/x-bittorrent")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.Replace(in, " ", "_", -1)+".torrent"))
+	io.Copy(w, f)
+}
+
+// baseURL guesses the url the client used to reach the server, taking
+// reverse proxies into account
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host
+}
+
+// serveCmd parses the serve subcommand flags and launches the HTTP server
+func serveCmd(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(
+			flags.Output(),
+			"Usage of %[1]s serve:%[2]s%[2]s\t%[1]s serve [-addr address] [-apikey key] [-client client] [-torznab] [-s sources] [-t timeout] [-v]%[2]s%[2]s"+
+				"Ygg Torrent credentials are read from the TORRENGO_YGG_ID and TORRENGO_YGG_PASS environment variables.%[2]s%[2]s"+
+				"Options:%[2]s%[2]s",
+			os.Args[0], lineBreak,
+		)
+		flags.PrintDefaults()
+	}
+	addr := flags.String("addr", "127.0.0.1:9117", "Address the HTTP server listens on.")
+	apiKey := flags.String("apikey", "", "API key clients must send. Leave empty to disable authentication.")
+	torrentClient := flags.String("client", "", "Torrent client results can be pushed to from the web UI or the API: "+
+		"deluge | qbittorrent | transmission, or any command line the magnet or torrent file is appended to "+
+		"(e.g. \"transmission-remote localhost:9091 -a\"). Requires -apikey.")
+	isTorznab := flags.Bool("torznab", false, "Expose sources through a Torznab API under /torznab/api (Sonarr, Radarr, ...).")
+	usrSources := flags.String("s", "all", "A comma separated list of sources "+
+		"you want to search."+lineBreak+"Choices: arc (Archive.org) | tpb (ThePirateBay) | otts (1337x) | ygg (YggTorrent). ")
+	timeoutInMillisec := flags.Int("t", 20000, "Timeout of HTTP requests in milliseconds. Set it to 0 to completely remove timeout.")
+	isVerbosePtr := flags.Bool("v", false, "Verbose mode. Use it to see more logs.")
+	flags.Parse(args)
+
+	timeout := time.Duration(*timeoutInMillisec) * time.Millisecond
+	isVerbose = *isVerbosePtr
+	setLogger(isVerbose)
+
+	// Anyone reaching the server could otherwise open any magnet in the
+	// torrent client, and run a command line client on the host
+	if *torrentClient != "" && *apiKey == "" {
+		fmt.Printf("Pushing torrents to a client requires an API key, set one with -apikey.%v", lineBreak)
+		os.Exit(1)
+	}
+
+	if err := loadExtraTrackers(); err != nil {
+		fmt.Printf("Could not use your trackers: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+	sourcesToLookup, err := parseSources(*usrSources)
+	if err != nil {
+		fmt.Printf("This website is not correct: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+
+	srv, err := newServer(sourcesToLookup, timeout, *apiKey)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("Could not create server")
+	}
+	srv.torrentClient = *torrentClient
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dl", srv.handleDl)
+	mux.HandleFunc("/api/v1/search", srv.handleAPISearch)
+	mux.HandleFunc("/api/v1/resolve", srv.handleAPIResolve)
+	mux.HandleFunc("/api/v1/sources", srv.handleAPISources)
+	mux.HandleFunc("/api/v1/push", srv.handleAPIPush)
+	fmt.Printf("JSON API available on http://%s/api/v1%s", *addr, lineBreak)
+	webUIRoot, _ := fs.Sub(webUI, "web")
+	mux.Handle("/", http.FileServer(http.FS(webUIRoot)))
+	fmt.Printf("Web UI available on http://%s/%s", *addr, lineBreak)
+	if *isTorznab {
+		mux.HandleFunc("/torznab/api", srv.handleTorznab)
+		fmt.Printf("Torznab API available on http://%s/torznab/api%s", *addr, lineBreak)
+	}
+
+	err = http.ListenAndServe(*addr, mux)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"addr":  *addr,
+			"error": err,
+		}).Fatal("Server stopped")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sortKeys are the keys results can be sorted by
+var sortKeys = []string{"relevance", "seeders", "leechers", "size", "date", "name", "source"}
+
+// sortKey is a key to sort results by.
+// Relevance, numbers and dates are sorted top down, names and sources
+// alphabetically, unless isReversed is true.
+type sortKey struct {
+	name       string
+	isReversed bool
+}
+
+// sorter sorts results on several keys, the next keys being used when
+// results are equal on the previous ones
+type sorter struct {
+	keys []sortKey
+	// tokens are the words and phrases of the search, used to compute
+	// relevance
+	tokens []string
+	now    time.Time
+}
+
+// newSorter parses a comma separated list of sort keys like
+// "seeders,-size". A "-" prefix reverses the order of a key.
+// in is the user search, used to compute relevance.
+func newSorter(keys string, in string) (sorter, error) {
+	so := sorter{now: time.Now()}
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		k := sortKey{name: strings.TrimPrefix(key, "-"), isReversed: strings.HasPrefix(key, "-")}
+		isKnown := false
+		for _, name := range sortKeys {
+			isKnown = isKnown || name == k.name
+		}
+		if !isKnown {
+			return so, fmt.Errorf("unknown sort key %v, should be one of %v", k.name, strings.Join(sortKeys, ", "))
+		}
+		so.keys = append(so.keys, k)
+	}
+
+	if q, err := parseQuery(in); err == nil {
+		so.tokens = append(so.tokens, q.words...)
+		so.tokens = append(so.tokens, q.phrases...)
+	} else {
+		so.tokens = strings.Fields(in)
+	}
+	for i := range so.tokens {
+		so.tokens[i] = strings.ToLower(so.tokens[i])
+	}
+
+	return so, nil
+}
+
+// sortOutBy sorts torrents list based on a comma separated list of sort keys
+// (see newSorter)
+func (s *search) sortOutBy(keys string) error {
+	so, err := newSorter(keys, s.in)
+	if err != nil {
+		return err
+	}
+	so.sort(s.out)
+
+	return nil
+}
+
+// sort sorts torrents in place. The order of equal torrents is kept.
+func (so sorter) sort(torrents []torrent) {
+	sort.SliceStable(torrents, func(i, j int) bool {
+		return so.less(torrents[i], torrents[j])
+	})
+}
+
+// less reports whether a should be sorted before b
+func (so sorter) less(a, b torrent) bool {
+	for _, k := range so.keys {
+		if c := so.compare(a, b, k); c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+// compare returns a negative number if a should be sorted before b on key k,
+// a positive number if b should be sorted first, and 0 if they are equal.
+// Torrents whose key is unknown are sorted last, whatever the order.
+func (so sorter) compare(a, b torrent, k sortKey) int {
+	var c int
+	switch k.name {
+	case "name":
+		c = strings.Compare(strings.ToLower(a.name), strings.ToLower(b.name))
+	case "source":
+		c = strings.Compare(a.source, b.source)
+	default:
+		var va, vb float64
+		switch k.name {
+		case "relevance":
+			va, vb = so.relevance(a), so.relevance(b)
+		case "seeders":
+			va, vb = float64(a.seeders), float64(b.seeders)
+		case "leechers":
+			va, vb = float64(a.leechers), float64(b.leechers)
+		case "size":
+			va, vb = float64(a.sizeBytes), float64(b.sizeBytes)
+		case "date":
+			va, vb = -1, -1
+			if !a.uplTime.IsZero() {
+				va = float64(a.uplTime.Unix())
+			}
+			if !b.uplTime.IsZero() {
+				vb = float64(b.uplTime.Unix())
+			}
+		}
+		switch {
+		case va < 0 && vb >= 0:
+			return 1
+		case vb < 0 && va >= 0:
+			return -1
+		case va > vb:
+			c = -1
+		case va < vb:
+			c = 1
+		}
+	}
+
+	if k.isReversed {
+		return -c
+	}
+	return c
+}
+
+// relevance scores how well t matches the user search, between 0 and 1.
+// It mostly depends on the proportion of the words and phrases of the search
+// found in the torrent name, then on the number of seeders, then on the
+// upload date. Unknown seeders and dates get an average score so that
+// sources which do not provide them are not always ranked last.
+func (so sorter) relevance(t torrent) float64 {
+	match := 1.0
+	if len(so.tokens) > 0 {
+		name := strings.Join(strings.Fields(nameSeparators.Replace(strings.ToLower(t.name))), " ")
+		var nbFound int
+		for _, token := range so.tokens {
+			if strings.Contains(name, token) {
+				nbFound++
+			}
+		}
+		match = float64(nbFound) / float64(len(so.tokens))
+	}
+
+	// 1000 seeders or more get the best score
+	health := 0.3
+	if t.seeders >= 0 {
+		health = math.Min(1, math.Log10(1+float64(t.seeders))/3)
+	}
+
+	// A one year old torrent gets half the best score
+	recency := 0.3
+	if !t.uplTime.IsZero() {
+		age := so.now.Sub(t.uplTime).Hours() / 24 / 365
+		recency = 1 / (1 + math.Max(0, age))
+	}
+
+	return 0.6*match + 0.3*health + 0.1*recency
+}
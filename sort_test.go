@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSortOutBy(t *testing.T) {
+	s := &search{in: "monte cristo", out: []torrent{
+		{name: "a", source: "tpb", sizeBytes: 1e9, seeders: 5},
+		{name: "b", source: "arc", sizeBytes: -1, seeders: -1},
+		{name: "c", source: "otts", sizeBytes: 2e9, seeders: 5},
+		{name: "d", source: "tpb", sizeBytes: 500e6, seeders: 10},
+	}}
+	names := func() []string {
+		var names []string
+		for _, t := range s.out {
+			names = append(names, t.name)
+		}
+		return names
+	}
+
+	if err := s.sortOutBy("seeders,-size"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"d", "a", "c", "b"}; !reflect.DeepEqual(names(), want) {
+		t.Fatalf("Got %q sorted by seeders then size, want %q", names(), want)
+	}
+
+	// Unknown sizes stay last in both orders
+	s.sortOutBy("-size")
+	if want := []string{"d", "a", "c", "b"}; !reflect.DeepEqual(names(), want) {
+		t.Fatalf("Got %q sorted by reversed size, want %q", names(), want)
+	}
+	s.sortOutBy("source,name")
+	if want := []string{"b", "c", "a", "d"}; !reflect.DeepEqual(names(), want) {
+		t.Fatalf("Got %q sorted by source then name, want %q", names(), want)
+	}
+
+	if err := s.sortOutBy("seeders,foo"); err == nil {
+		t.Fatal("Expected an error for an unknown sort key")
+	}
+}
+
+func TestRelevance(t *testing.T) {
+	recent := time.Now().Add(-24 * time.Hour)
+	s := &search{in: `"monte cristo" dumas`, out: []torrent{
+		{name: "Popular but unrelated", seeders: 5000, uplTime: recent},
+		{name: "Dumas - Le Comte de Monte Cristo", source: "arc", seeders: -1},
+		{name: "The.Count.of.Monte.Cristo.2002", seeders: 50, uplTime: recent},
+	}}
+	s.sortOutBy("relevance")
+
+	var names []string
+	for _, t := range s.out {
+		names = append(names, t.name)
+	}
+	want := []string{"Dumas - Le Comte de Monte Cristo", "The.Count.of.Monte.Cristo.2002", "Popular but unrelated"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("Got %q sorted by relevance, want %q", names, want)
+	}
+}
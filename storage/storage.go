@@ -0,0 +1,281 @@
+// Package storage reads and writes the content of torrents on disk, mapping
+// the byte stream their pieces are cut from onto their files.
+package storage
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/juliensalinas/torrengo/metainfo"
+)
+
+// Storage is the content of a torrent stored in a directory
+type Storage struct {
+	files       []file
+	pieceLength int64
+	totalLength int64
+
+	mu sync.Mutex
+	// readers and writers are the files open for reading and for writing, by
+	// path. Files are not reopened when their mode changes, since they may
+	// be in use.
+	readers map[string]*os.File
+	writers map[string]*os.File
+}
+
+// file is a file of the torrent content
+type file struct {
+	// index is the index of the file in mi.Files
+	index int
+	path  string
+	// offset is the position of the file in the torrent content
+	offset     int64
+	length     int64
+	isPadding  bool
+	isSelected bool
+}
+
+// New returns the storage of the torrent mi in dir. Single file torrents are
+// stored in dir/<name> and multi-file torrents in dir/<name>/<path>.
+// selected tells which files of mi.Files are written, all of them if nil.
+// Padding files are never written.
+func New(mi *metainfo.MetaInfo, dir string, selected []bool) *Storage {
+	s := &Storage{
+		pieceLength: mi.PieceLength,
+		totalLength: mi.TotalLength,
+		readers:     make(map[string]*os.File),
+		writers:     make(map[string]*os.File),
+	}
+	var offset int64
+	for i, f := range mi.Files {
+		p := append([]string{dir}, f.Path...)
+		if mi.IsDir {
+			p = append([]string{dir, mi.Name}, f.Path...)
+		}
+		s.files = append(s.files, file{
+			index:      i,
+			path:       filepath.Join(p...),
+			offset:     offset,
+			length:     f.Length,
+			isPadding:  f.IsPadding,
+			isSelected: !f.IsPadding && (selected == nil || selected[i]),
+		})
+		offset += f.Length
+	}
+
+	return s
+}
+
+// NumPieces returns the number of pieces of the torrent
+func (s *Storage) NumPieces() int {
+	return int((s.totalLength + s.pieceLength - 1) / s.pieceLength)
+}
+
+// PieceBounds returns the offset and the length of piece i in the torrent
+// content
+func (s *Storage) PieceBounds(i int) (int64, int64) {
+	offset := int64(i) * s.pieceLength
+	length := s.pieceLength
+	if offset+length > s.totalLength {
+		length = s.totalLength - offset
+	}
+	return offset, length
+}
+
+// SelectedLength returns the number of bytes of piece i which belong to
+// selected files
+func (s *Storage) SelectedLength(i int) int64 {
+	var n int64
+	s.forEachFile(i, func(f file, begin, end int64) {
+		if f.isSelected {
+			n += end - begin
+		}
+	})
+	return n
+}
+
+// IsStored reports whether piece i is fully stored once written, that is,
+// whether all its data belong to selected or padding files
+func (s *Storage) IsStored(i int) bool {
+	isStored := true
+	s.forEachFile(i, func(f file, begin, end int64) {
+		if !f.isSelected && !f.isPadding {
+			isStored = false
+		}
+	})
+	return isStored
+}
+
+// Files returns the paths of the files of the torrent on disk, in the order
+// of mi.Files
+func (s *Storage) Files() []string {
+	paths := make([]string, len(s.files))
+	for i, f := range s.files {
+		paths[i] = f.path
+	}
+	return paths
+}
+
+// PieceFiles returns the indexes of the files piece i holds data of, padding
+// files excluded
+func (s *Storage) PieceFiles(i int) []int {
+	var files []int
+	s.forEachFile(i, func(f file, begin, end int64) {
+		if !f.isPadding {
+			files = append(files, f.index)
+		}
+	})
+	return files
+}
+
+// CheckPiece reads piece i and reports whether it matches hash, its SHA-1
+// hash in the torrent. An error is returned if it cannot be read, like when
+// one of its files is missing.
+func (s *Storage) CheckPiece(i int, hash [20]byte) (bool, error) {
+	off, length := s.PieceBounds(i)
+	data := make([]byte, length)
+	if err := s.ReadAt(data, off); err != nil {
+		return false, err
+	}
+	return sha1.Sum(data) == hash, nil
+}
+
+// forEachFile calls fn with each non-empty file piece i holds data of, and
+// the bounds of this data in the file
+func (s *Storage) forEachFile(i int, fn func(f file, begin, end int64)) {
+	offset, length := s.PieceBounds(i)
+	s.forEachRange(offset, length, fn)
+}
+
+// forEachRange calls fn with each non-empty file the content range at off of
+// length bytes overlaps, and the bounds of the range in the file
+func (s *Storage) forEachRange(off, length int64, fn func(f file, begin, end int64)) {
+	for _, f := range s.files {
+		if f.length == 0 || f.offset+f.length <= off {
+			continue
+		}
+		if f.offset >= off+length {
+			break
+		}
+		begin := off - f.offset
+		if begin < 0 {
+			begin = 0
+		}
+		end := off + length - f.offset
+		if end > f.length {
+			end = f.length
+		}
+		fn(f, begin, end)
+	}
+}
+
+// ReadAt reads len(p) bytes of the torrent content at off. Padding files
+// read as zeros.
+func (s *Storage) ReadAt(p []byte, off int64) error {
+	var err error
+	s.forEachRange(off, int64(len(p)), func(f file, begin, end int64) {
+		if err != nil {
+			return
+		}
+		buf := p[f.offset+begin-off : f.offset+end-off]
+		if f.isPadding {
+			for i := range buf {
+				buf[i] = 0
+			}
+			return
+		}
+		var h *os.File
+		if h, err = s.open(f, false); err != nil {
+			return
+		}
+		if _, err = h.ReadAt(buf, begin); err == io.EOF {
+			err = fmt.Errorf("%v is incomplete", f.path)
+		}
+	})
+	return err
+}
+
+// WriteAt writes p to the torrent content at off. Data of unselected files
+// and of padding files are skipped.
+func (s *Storage) WriteAt(p []byte, off int64) error {
+	var err error
+	s.forEachRange(off, int64(len(p)), func(f file, begin, end int64) {
+		if err != nil || !f.isSelected {
+			return
+		}
+		var h *os.File
+		if h, err = s.open(f, true); err != nil {
+			return
+		}
+		_, err = h.WriteAt(p[f.offset+begin-off:f.offset+end-off], begin)
+	})
+	return err
+}
+
+// CreateEmptyFiles creates the selected files of zero length, which hold no
+// piece data and so are never written
+func (s *Storage) CreateEmptyFiles() error {
+	for _, f := range s.files {
+		if f.length != 0 || !f.isSelected {
+			continue
+		}
+		if _, err := s.open(f, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open returns the open file f, creating it and its directory if it is
+// opened for writing
+func (s *Storage) open(f file, isWritable bool) (*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if h, ok := s.writers[f.path]; ok {
+		return h, nil
+	}
+	if !isWritable {
+		if h, ok := s.readers[f.path]; ok {
+			return h, nil
+		}
+		h, err := os.Open(f.path)
+		if err != nil {
+			return nil, err
+		}
+		s.readers[f.path] = h
+		return h, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return nil, fmt.Errorf("could not create directory: %v", err)
+	}
+	h, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.writers[f.path] = h
+
+	return h, nil
+}
+
+// Close closes the open files
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for _, handles := range []map[string]*os.File{s.readers, s.writers} {
+		for path, h := range handles {
+			if closeErr := h.Close(); closeErr != nil {
+				err = closeErr
+			}
+			delete(handles, path)
+		}
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juliensalinas/torrengo/metainfo"
+)
+
+// testMetaInfo is a multi-file torrent of 3 pieces of 8 bytes: a.txt (10
+// bytes), a padding file (6 bytes) and b/c.txt (5 bytes)
+var testMetaInfo = &metainfo.MetaInfo{
+	Name:  "data",
+	IsDir: true,
+	Files: []metainfo.File{
+		{Path: []string{"a.txt"}, Length: 10},
+		{Path: []string{".pad", "6"}, Length: 6, IsPadding: true},
+		{Path: []string{"b", "c.txt"}, Length: 5},
+		{Path: []string{"empty"}, Length: 0},
+	},
+	TotalLength: 21,
+	PieceLength: 8,
+}
+
+func TestReadWrite(t *testing.T) {
+	dir := t.TempDir()
+	s := New(testMetaInfo, dir, nil)
+	defer s.Close()
+
+	if s.NumPieces() != 3 {
+		t.Fatalf("Got %d pieces", s.NumPieces())
+	}
+	if off, length := s.PieceBounds(2); off != 16 || length != 5 {
+		t.Fatalf("Got bounds %d %d for the last piece", off, length)
+	}
+
+	content := []byte("0123456789------abcde")
+	for i := 0; i < s.NumPieces(); i++ {
+		off, length := s.PieceBounds(i)
+		if err := s.WriteAt(content[off:off+length], off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.CreateEmptyFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, _ := os.ReadFile(filepath.Join(dir, "data", "a.txt"))
+	c, _ := os.ReadFile(filepath.Join(dir, "data", "b", "c.txt"))
+	if string(a) != "0123456789" || string(c) != "abcde" {
+		t.Fatalf("Wrote %q and %q", a, c)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data", ".pad")); !os.IsNotExist(err) {
+		t.Fatal("Padding file was written")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data", "empty")); err != nil {
+		t.Fatal("Empty file was not created")
+	}
+
+	// Padding reads as zeros
+	p := make([]byte, 12)
+	if err := s.ReadAt(p, 6); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte("6789\x00\x00\x00\x00\x00\x00ab"); !bytes.Equal(p, want) {
+		t.Fatalf("Read %q, want %q", p, want)
+	}
+}
+
+func TestSelectedFiles(t *testing.T) {
+	dir := t.TempDir()
+	s := New(testMetaInfo, dir, []bool{false, false, true, false})
+	defer s.Close()
+
+	if s.SelectedLength(0) != 0 || s.SelectedLength(1) != 0 || s.SelectedLength(2) != 5 {
+		t.Fatal("Wrong selected lengths")
+	}
+	if s.IsStored(0) || s.IsStored(1) || !s.IsStored(2) {
+		t.Fatal("Wrong stored pieces")
+	}
+	if err := s.WriteAt([]byte("0123456789------abcde"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data", "a.txt")); !os.IsNotExist(err) {
+		t.Fatal("Unselected file was written")
+	}
+	if err := s.ReadAt(make([]byte, 8), 0); err == nil {
+		t.Fatal("No error when reading a missing file")
+	}
+	p := make([]byte, 5)
+	if err := s.ReadAt(p, 16); err != nil || string(p) != "abcde" {
+		t.Fatalf("Read %q: %v", p, err)
+	}
+}
+
+func TestSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	s := New(&metainfo.MetaInfo{
+		Name:        "ubuntu.iso",
+		Files:       []metainfo.File{{Path: []string{"ubuntu.iso"}, Length: 4}},
+		TotalLength: 4,
+		PieceLength: 16384,
+	}, dir, nil)
+	defer s.Close()
+
+	if err := s.WriteAt([]byte("da"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReadAt(make([]byte, 4), 0); err == nil {
+		t.Fatal("No error when reading an incomplete file")
+	}
+	if err := s.WriteAt([]byte("ta"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "ubuntu.iso")); string(b) != "data" {
+		t.Fatalf("Wrote %q", b)
+	}
+}
+
+func TestCheckPiece(t *testing.T) {
+	dir := t.TempDir()
+	s := New(testMetaInfo, dir, nil)
+	defer s.Close()
+
+	if files := s.PieceFiles(1); len(files) != 1 || files[0] != 0 {
+		t.Fatalf("Got files %v for the padding piece", files)
+	}
+	if files := s.PieceFiles(2); len(files) != 1 || files[0] != 2 {
+		t.Fatalf("Got files %v for the last piece", files)
+	}
+	if paths := s.Files(); paths[2] != filepath.Join(dir, "data", "b", "c.txt") {
+		t.Fatalf("Got paths %v", paths)
+	}
+
+	hash := sha1.Sum([]byte("abcde"))
+	if _, err := s.CheckPiece(2, hash); err == nil {
+		t.Fatal("No error for a missing file")
+	}
+	if err := s.WriteAt([]byte("abcdf"), 16); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.CheckPiece(2, hash); err != nil || ok {
+		t.Fatalf("Corrupt piece checked: %v", err)
+	}
+	if err := s.WriteAt([]byte("e"), 20); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.CheckPiece(2, hash); err != nil || !ok {
+		t.Fatalf("Valid piece not checked: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package swarm
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/juliensalinas/torrengo/dht"
+	"github.com/juliensalinas/torrengo/tracker"
+)
+
+// peerIDPrefix identifies the client in peer IDs (Azureus-style)
+const peerIDPrefix = "-TG0001-"
+
+// announceTimeout is the maximum time given to trackers to answer
+const announceTimeout = 30 * time.Second
+
+// FindPeers concurrently looks for the peers of the torrent with the given
+// v1 infohash and sends their addresses to the returned channel, which is
+// closed once all lookups end.
+// Peers are the given ones, the ones of trackers, which are told we listen
+// on port, and the ones of the DHT searched from bootstrapNodes (the DHT is
+// not used if bootstrapNodes is empty). Lookups end when ctx is done.
+func FindPeers(ctx context.Context, infoHash, peerID [20]byte, port uint16,
+	peers, trackers, bootstrapNodes []string) <-chan string {
+	found := make(chan string)
+	send := func(addrs []string) {
+		for _, p := range addrs {
+			select {
+			case found <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		send(peers)
+	}()
+	for _, tr := range trackers {
+		wg.Add(1)
+		go func(tr string) {
+			defer wg.Done()
+			timeout := announceTimeout
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+				timeout = time.Until(deadline)
+			}
+			trPeers, err := tracker.Announce(tr, infoHash, peerID, port, timeout)
+			if err != nil {
+				return
+			}
+			send(trPeers)
+		}(tr)
+	}
+	if len(bootstrapNodes) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dht.GetPeers(ctx, infoHash, bootstrapNodes, found)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	return found
+}
+
+// NewPeerID returns a random peer ID
+func NewPeerID() ([20]byte, error) {
+	var id [20]byte
+	copy(id[:], peerIDPrefix)
+	if _, err := rand.Read(id[len(peerIDPrefix):]); err != nil {
+		return id, fmt.Errorf("could not generate peer ID: %v", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,113 @@
+package swarm
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+)
+
+var infoHash = [20]byte{1, 2, 3}
+
+// connPair returns both ends of a TCP connection. Unlike net.Pipe, writes do
+// not wait for reads, like on the network.
+func connPair(t *testing.T) (net.Conn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	a, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func TestHandshake(t *testing.T) {
+	a, b := connPair(t)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := Handshake(b, b, infoHash, [20]byte{'b'})
+		errs <- err
+	}()
+	remoteID, isExtended, err := Handshake(a, a, infoHash, [20]byte{'a'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if remoteID != [20]byte{'b'} || !isExtended {
+		t.Fatalf("Got peer ID %q and extension support %v", remoteID, isExtended)
+	}
+}
+
+func TestHandshakeWrongTorrent(t *testing.T) {
+	a, b := connPair(t)
+
+	go Handshake(b, b, [20]byte{4, 5, 6}, [20]byte{'b'})
+	if _, _, err := Handshake(a, a, infoHash, [20]byte{'a'}); err == nil {
+		t.Fatal("No error for a peer of another torrent")
+	}
+}
+
+func TestMessages(t *testing.T) {
+	var buf bytes.Buffer
+	WriteKeepAlive(&buf)
+	WriteMessage(&buf, MsgHave, Uint32s(42))
+	WriteMessage(&buf, MsgRequest, Uint32s(1, BlockLen, BlockLen))
+
+	id, payload, err := ReadMessage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != MsgHave || !bytes.Equal(payload, []byte{0, 0, 0, 42}) {
+		t.Fatalf("Got message %d %v", id, payload)
+	}
+	id, payload, err = ReadMessage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != MsgRequest || len(payload) != 12 {
+		t.Fatalf("Got message %d %v", id, payload)
+	}
+	if _, _, err := ReadMessage(&buf); err == nil {
+		t.Fatal("No error at the end of the stream")
+	}
+}
+
+func TestFindPeers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := bencode.Encode(map[string]interface{}{
+			"interval": 1800,
+			"peers":    string([]byte{10, 0, 0, 2, 0x1A, 0xE1}),
+		})
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	found := make(map[string]bool)
+	for p := range FindPeers(ctx, infoHash, [20]byte{}, 6881, []string{"10.0.0.1:6881"}, []string{ts.URL + "/announce"}, nil) {
+		found[p] = true
+	}
+	if len(found) != 2 || !found["10.0.0.1:6881"] || !found["10.0.0.2:6881"] {
+		t.Fatalf("Found peers %v", found)
+	}
+}
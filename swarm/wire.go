@@ -0,0 +1,123 @@
+// Package swarm talks to the peers of torrents: it finds them with trackers
+// and the DHT, and implements the peer wire protocol (BEP 3) with its
+// extension protocol (BEP 10).
+package swarm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// protocol is the protocol name of BitTorrent handshakes
+const protocol = "BitTorrent protocol"
+
+// extensionBit is the bit of the 6th reserved byte of handshakes announcing
+// the extension protocol (BEP 10)
+const extensionBit = 0x10
+
+// Peer wire messages
+const (
+	MsgChoke         = 0
+	MsgUnchoke       = 1
+	MsgInterested    = 2
+	MsgNotInterested = 3
+	MsgHave          = 4
+	MsgBitfield      = 5
+	MsgRequest       = 6
+	MsgPiece         = 7
+	MsgCancel        = 8
+	// MsgExtended messages are the ones of the extension protocol
+	MsgExtended = 20
+)
+
+// BlockLen is the length of the blocks pieces are requested by
+const BlockLen = 16384
+
+// maxMessageLen is the maximum length of accepted peer messages
+const maxMessageLen = 1 << 20
+
+// Handshake exchanges BitTorrent handshakes, announcing the extension
+// protocol, and checks the one of the peer.
+// It returns the ID of the peer and whether it supports the extension
+// protocol.
+func Handshake(w io.Writer, r io.Reader, infoHash, peerID [20]byte) ([20]byte, bool, error) {
+	var remoteID [20]byte
+
+	msg := make([]byte, 0, 68)
+	msg = append(msg, byte(len(protocol)))
+	msg = append(msg, protocol...)
+	reserved := make([]byte, 8)
+	reserved[5] |= extensionBit
+	msg = append(msg, reserved...)
+	msg = append(msg, infoHash[:]...)
+	msg = append(msg, peerID[:]...)
+	if _, err := w.Write(msg); err != nil {
+		return remoteID, false, fmt.Errorf("could not send handshake: %v", err)
+	}
+
+	resp := make([]byte, 68)
+	if _, err := io.ReadFull(r, resp); err != nil {
+		return remoteID, false, fmt.Errorf("could not read handshake: %v", err)
+	}
+	if int(resp[0]) != len(protocol) || string(resp[1:20]) != protocol {
+		return remoteID, false, fmt.Errorf("not a BitTorrent peer")
+	}
+	if !bytes.Equal(resp[28:48], infoHash[:]) {
+		return remoteID, false, fmt.Errorf("peer does not have the torrent")
+	}
+	copy(remoteID[:], resp[48:])
+
+	return remoteID, resp[25]&extensionBit != 0, nil
+}
+
+// ReadMessage reads a peer message and returns its ID and payload.
+// Keep-alives are skipped.
+func ReadMessage(r io.Reader) (byte, []byte, error) {
+	for {
+		var length uint32
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return 0, nil, fmt.Errorf("could not read message: %v", err)
+		}
+		if length == 0 {
+			continue
+		}
+		if length > maxMessageLen {
+			return 0, nil, fmt.Errorf("message is too long")
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return 0, nil, fmt.Errorf("could not read message: %v", err)
+		}
+		return msg[0], msg[1:], nil
+	}
+}
+
+// WriteMessage writes a peer message
+func WriteMessage(w io.Writer, id byte, payload []byte) error {
+	msg := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(msg, uint32(1+len(payload)))
+	msg[4] = id
+	if _, err := w.Write(append(msg, payload...)); err != nil {
+		return fmt.Errorf("could not send message: %v", err)
+	}
+	return nil
+}
+
+// WriteKeepAlive writes a keep-alive message
+func WriteKeepAlive(w io.Writer) error {
+	if _, err := w.Write(make([]byte, 4)); err != nil {
+		return fmt.Errorf("could not send message: %v", err)
+	}
+	return nil
+}
+
+// Uint32s encodes the integers of have, request and cancel messages
+func Uint32s(values ...int) []byte {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(b[4*i:], uint32(v))
+	}
+	return b
+}
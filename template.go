@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the functions available in user templates on top of the
+// text/template builtins
+var templateFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": strings.ReplaceAll,
+	"join":    strings.Join,
+	// truncate shortens s to n characters at most
+	"truncate": func(n int, s string) string {
+		r := []rune(s)
+		if len(r) <= n {
+			return s
+		}
+		return string(r[:n])
+	},
+	// json encodes v as JSON, which is handy to escape strings
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// templateResult is the data given to templates applied to each result
+type templateResult struct {
+	record
+	Index int
+}
+
+// templateResults is the data given to templates applied to the whole
+// results list
+type templateResults struct {
+	Query   string
+	Results []templateResult
+}
+
+// parseUserTemplate parses a user template.
+// usrTemplate is either the name of a template defined in the configuration
+// file, or the template itself.
+func parseUserTemplate(usrTemplate string, cfg config) (*template.Template, error) {
+	text := usrTemplate
+	if !strings.Contains(usrTemplate, "{{") {
+		var ok bool
+		text, ok = cfg.Templates[usrTemplate]
+		if !ok {
+			return nil, fmt.Errorf("no template named %v in config file", usrTemplate)
+		}
+	}
+
+	tmpl, err := template.New("user").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template: %v", err)
+	}
+
+	return tmpl, nil
+}
+
+// writeTemplate renders torrents to w with tmpl.
+// If all is false, tmpl is applied to each result and a line break is added
+// after each result if the template does not end with one. Otherwise tmpl is
+// applied once to the whole results list.
+func writeTemplate(w io.Writer, tmpl *template.Template, in string, torrents []torrent, all bool) error {
+	results := make([]templateResult, 0, len(torrents))
+	for i, t := range torrents {
+		results = append(results, templateResult{record: newRecord(t), Index: i})
+	}
+
+	if all {
+		return tmpl.Execute(w, templateResults{Query: in, Results: results})
+	}
+
+	for _, result := range results {
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, result); err != nil {
+			return err
+		}
+		out := sb.String()
+		if !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		if _, err := io.WriteString(w, out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
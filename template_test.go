@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteTemplateEach(t *testing.T) {
+	tmpl, err := parseUserTemplate(`{{.Index}}: {{.Name | upper}} ({{.Source}})`, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeTemplate(&buf, tmpl, "dumas", formatTestTorrents[:1], false); err != nil {
+		t.Fatal(err)
+	}
+	want := "0: LE COMTE DE MONTE-CRISTO (tpb)\n"
+	if buf.String() != want {
+		t.Fatalf("Got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteTemplateAllNamed(t *testing.T) {
+	cfg := config{Templates: map[string]string{
+		"markdown": "# {{.Query}}\n{{range .Results}}- [{{.Name}}]({{.DescURL}})\n{{end}}",
+	}}
+	tmpl, err := parseUserTemplate("markdown", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeTemplate(&buf, tmpl, "dumas", formatTestTorrents[1:], true); err != nil {
+		t.Fatal(err)
+	}
+	want := "# dumas\n- [Dumas\tcomplete](https://archive.org/details/dumas)\n"
+	if buf.String() != want {
+		t.Fatalf("Got %q, want %q", buf.String(), want)
+	}
+
+	if _, err := parseUserTemplate("unknown", cfg); err == nil {
+		t.Fatal("Unknown template name should return an error")
+	}
+}
@@ -2,24 +2,32 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
 	"sort"
 	"strconv"
 	"strings"
-	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/onrik/logrus/filename"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/term"
 
 	"github.com/juliensalinas/torrengo/arc"
+	"github.com/juliensalinas/torrengo/core"
+	"github.com/juliensalinas/torrengo/dht"
+	"github.com/juliensalinas/torrengo/engine"
+	"github.com/juliensalinas/torrengo/magnet"
+	"github.com/juliensalinas/torrengo/metadata"
+	"github.com/juliensalinas/torrengo/metainfo"
 	"github.com/juliensalinas/torrengo/otts"
 	"github.com/juliensalinas/torrengo/tpb"
 	"github.com/juliensalinas/torrengo/ygg"
@@ -39,25 +47,44 @@ var sources = map[string]string{
 // isVerbose is used to switch debugging on or off
 var isVerbose bool
 
-// ft is the final torrent the user wants to download
-var ft torrent
+// defaultMetadataTimeout is how long the metadata of a magnet are looked for
+// in its swarm when converting it into a torrent file
+const defaultMetadataTimeout = 2 * time.Minute
 
 // torrent contains meta information about the torrent
 type torrent struct {
 	fileURL string
 	magnet  string
+	// infoHash is the v1 infohash (or v2 for v2 only torrents) in lowercase
+	// hexadecimal, empty until the magnet or the torrent file is known
+	infoHash string
+	// trackers are the announce URLs of the torrent, when its magnet or its
+	// torrent file is known
+	trackers []string
 	// Description url containing more info about the torrent including the torrent file address
-	descURL  string
-	name     string
-	size     string
-	seeders  int
-	leechers int
-	// Date of upload
+	descURL string
+	name    string
+	size    string
+	// sizeBytes is the size converted to bytes (-1 if unknown)
+	sizeBytes int64
+	seeders   int
+	leechers  int
+	// isTrackerVerified is true if seeders and leechers were given by the
+	// trackers of the torrent rather than by the source
+	isTrackerVerified bool
+	// Date of upload, as displayed by the source
 	uplDate string
+	// uplTime is the date of upload converted to a time (zero if unknown), and
+	// uplDatePrecision its precision
+	uplTime          time.Time
+	uplDatePrecision core.DatePrecision
 	// Website the torrent is coming from
 	source string
 	// Local path where torrent was saved
 	filePath string
+	// mergedFrom are the torrents of each source merged into this one by
+	// mergeOut, including itself (nil if it was not merged)
+	mergedFrom []torrent
 }
 
 // torListAndHTTPClient contains the torrents found and the http client
@@ -72,6 +99,8 @@ type search struct {
 	out             []torrent
 	sourcesToLookup []string
 	httpClient      *http.Client
+	// errs contains the errors returned by the sources that failed
+	errs map[string]error
 }
 
 // cleanIn cleans the user search input
@@ -94,212 +123,45 @@ func (s *search) sortOut() {
 	})
 }
 
-// render renders torrents in a tabular user-friendly way with colors in terminal
-func render(torrents []torrent) {
-	// Turn type []torrent to type [][]string because this is what tablewriter expects
-	var renderedTorrents [][]string
-	for i, t := range torrents {
-		// Replace -1 by unknown because more user-friendly
-		seedersStr := strconv.Itoa(t.seeders)
-		if seedersStr == "-1" {
-			seedersStr = "Unknown"
-		}
-		leechersStr := strconv.Itoa(t.leechers)
-		if leechersStr == "-1" {
-			leechersStr = "Unknown"
-		}
-		renderedTorrent := []string{
-			strconv.Itoa(i),
-			t.name,
-			t.size,
-			seedersStr,
-			leechersStr,
-			t.uplDate,
-			sources[t.source],
-		}
-		renderedTorrents = append([][]string{renderedTorrent}, renderedTorrents...)
-	}
-
-	// Render results using tablewriter
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Index", "Name", "Size", "Seeders", "Leechers", "Date of upload", "Source"})
-	table.SetRowLine(true)
-	table.SetColumnColor(
-		tablewriter.Colors{tablewriter.Normal, tablewriter.Normal},
-		tablewriter.Colors{tablewriter.Normal, tablewriter.Normal},
-		tablewriter.Colors{tablewriter.Normal, tablewriter.Normal},
-		tablewriter.Colors{tablewriter.Bold, tablewriter.FgHiGreenColor},
-		tablewriter.Colors{tablewriter.Bold, tablewriter.FgHiRedColor},
-		tablewriter.Colors{tablewriter.Normal, tablewriter.Normal},
-		tablewriter.Colors{tablewriter.Normal, tablewriter.Normal},
-	)
-	table.AppendBulk(renderedTorrents)
-	table.Render()
-}
-
-// getTorrentFile retrieves and displays torrent file to user.
-// TODO(juliensalinas): pass a proper context.Context object instead
-// of a mere timeout.
-func getTorrentFile(userID, in string, userPass string,
-	timeout time.Duration, httpClient *http.Client) {
-	var err error
-	switch ft.source {
-	case "arc":
-		log.WithFields(log.Fields{
-			"sourceToSearch": "arc",
-		}).Debug("Download torrent file")
-		ft.filePath, err = arc.FindAndDlFile(ft.descURL, in, timeout)
-	case "ygg":
-		log.WithFields(log.Fields{
-			"sourceToSearch": "ygg",
-		}).Debug("Download torrent file")
-		ft.filePath, err = ygg.FindAndDlFile(
-			ft.descURL, in, userID, userPass, timeout, httpClient)
-	}
-	if err != nil {
-		fmt.Println("Could not retrieve the torrent file (see logs for more details).")
-		log.WithFields(log.Fields{
-			"descURL": ft.descURL,
-			"error":   err,
-		}).Fatal("Could not retrieve the torrent file")
-	}
-}
-
-// openMagOrTorInClient opens magnet link or torrent file in user torrent client
-func openMagOrTorInClient(resource string, torrentClient string) {
-	// Open torrent in client
-	log.WithFields(log.Fields{
-		"resource": resource,
-		"client":   torrentClient,
-	}).Debug("Opening magnet link or torrent file with torrent client")
-	fmt.Println("Opening torrent in client...")
-	cmd := exec.Command(torrentClient, resource)
-
-	// Use Start() instead of Run() because do not want to wait for the torrent
-	// client process to complete (detached process).
-	err := cmd.Start()
-	if err != nil {
-		fmt.Println("Could not open your torrent in client, you need to do it manually (see logs for more details).")
-		log.WithFields(log.Fields{
-			"resource": resource,
-			"client":   torrentClient,
-			"error":    err,
-		}).Fatal("Could not open torrent in client")
-	}
-}
-
-// rmDuplicates removes duplicates from slice
-func rmDuplicates(elements []string) []string {
-	encountered := map[string]bool{}
-
-	// Create a map of all unique elements.
-	for v := range elements {
-		encountered[elements[v]] = true
-	}
-
-	// Place all keys from the map into a slice.
-	result := []string{}
-	for key := range encountered {
-		result = append(result, key)
-	}
-	return result
-}
-
-// setLogger sets various logging parameters
-func setLogger(isVerbose bool) {
-	// If verbose, set logger to debug, otherwise display errors only
-	if isVerbose {
-		log.SetLevel(log.DebugLevel)
-	} else {
-		log.SetLevel(log.ErrorLevel)
-	}
-
-	// Log as standard text
-	log.SetFormatter(&log.TextFormatter{})
-
-	// Log as JSON instead of the default ASCII formatter
-	// log.SetFormatter(&log.JSONFormatter{})
-
-	// Log filename and line number.
-	// Should be removed from production because adds a performance cost.
-	log.AddHook(filename.NewHook())
-}
-
-func init() {
-	// Set custom line break in order for the script to work on any OS
-	if runtime.GOOS == "windows" {
-		lineBreak = "\r\n"
-	} else {
-		lineBreak = "\n"
+// filterOut only keeps torrents whose name contains all the words of filter
+// (case insensitive)
+func (s *search) filterOut(filter string) {
+	words := strings.Fields(strings.ToLower(filter))
+	if len(words) == 0 {
+		return
 	}
-}
 
-func main() {
-	// Get command line flags and arguments
-	flag.Usage = func() {
-		fmt.Fprintf(
-			flag.CommandLine.Output(),
-			"Usage of %[1]s:%[2]s%[2]s\t%[1]s [-s sources] [-t timeout] [-v] arg1 arg2 arg3 ...%[2]s%[2]s"+
-				"Examples:%[2]s%[2]s\tSearch 'Alexandre Dumas' on all sources:%[2]s\t\t%[1]s Alexandre Dumas%[2]s"+
-				"\tSearch 'Alexandre Dumas' on Archive.org and ThePirateBay only:%[2]s\t\t%[1]s -s arc,tpb Alexandre Dumas%[2]s%[2]s"+
-				"Options:%[2]s%[2]s",
-			os.Args[0], lineBreak,
-		)
-		flag.PrintDefaults()
-	}
-	usrSourcesPtr := flag.String("s", "all", "A comma separated list of sources "+
-		"you want to search."+lineBreak+"Choices: arc (Archive.org) | tpb (ThePirateBay) | otts (1337x) | ygg (YggTorrent). ")
-	timeoutInMillisecPtr := flag.Int("t", 20000, "Timeout of HTTP requests in milliseconds. Set it to 0 to completely remove timeout.")
-	isVerbosePtr := flag.Bool("v", false, "Verbose mode. Use it to see more logs.")
-	flag.Parse()
-
-	// Get timeout and convert it to a proper Go timeout in nanoseconds
-	timeoutInMillisec := *timeoutInMillisecPtr
-	timeout := time.Duration(timeoutInMillisec * 1000 * 1000)
-
-	// Set logging parameters depending on the verbose user input
-	isVerbose = *isVerbosePtr
-	setLogger(isVerbose)
-
-	// If no command line argument is supplied, then we stop here
-	if len(flag.Args()) == 0 {
-		fmt.Println("Please enter proper arguments (-h for help).")
-		os.Exit(1)
-	}
-
-	// Initialize the user search with the user input and sourcesToLookup, and out is zeroed.
-	// Remove possible duplicates from user input.
-	// In case user chooses "all" as a source, convert it to the proper source names.
-	// Stop if a user source is unknown.
-	// Concatenate all input arguments into one single string in case user does not use quotes.
-	usrSourcesSlc := strings.Split(*usrSourcesPtr, ",")
-	cleanedUsrSourcesSlc := rmDuplicates(usrSourcesSlc)
-	for _, usrSource := range cleanedUsrSourcesSlc {
-		if usrSource == "all" {
-			cleanedUsrSourcesSlc = []string{"arc", "tpb", "otts", "ygg"}
-			break
+	var filtered []torrent
+	for _, t := range s.out {
+		name := strings.ToLower(t.name)
+		keep := true
+		for _, word := range words {
+			if !strings.Contains(name, word) {
+				keep = false
+				break
+			}
 		}
-		if usrSource != "arc" && usrSource != "tpb" && usrSource != "otts" && usrSource != "ygg" {
-			fmt.Printf("This website is not correct: %v%v", usrSource, lineBreak)
-			log.WithFields(log.Fields{
-				"sourcesList": cleanedUsrSourcesSlc,
-				"wrongSource": usrSource,
-			}).Fatal("Unknown source in user sources list")
+		if keep {
+			filtered = append(filtered, t)
 		}
 	}
-	s := search{
-		in:              strings.Join(flag.Args(), " "),
-		sourcesToLookup: cleanedUsrSourcesSlc,
-	}
+	s.out = filtered
+}
 
-	// Clean user input
-	err := s.cleanIn()
+// lookup concurrently searches all the sources to lookup and gathers the
+// results in s.out.
+// Errors returned by the sources are stored in s.errs. An error is returned
+// only if all the sources failed.
+func (s *search) lookup(timeout time.Duration) error {
+	// Parse the user search. Sources only receive the parts they support,
+	// and the other parts are applied on the results.
+	q, err := parseQuery(s.in)
 	if err != nil {
-		fmt.Println("Could not process your input (see logs for more details).")
-		log.WithFields(log.Fields{
-			"input": s.in,
-			"error": err,
-		}).Fatal("Could not clean user input")
+		return fmt.Errorf("invalid search: %v", err)
+	}
+	sourcesToLookup := q.restrictSources(s.sourcesToLookup)
+	if len(sourcesToLookup) == 0 {
+		return fmt.Errorf("no source to search")
 	}
 
 	// Channels for results
@@ -318,7 +180,7 @@ func main() {
 	log.WithFields(log.Fields{
 		"input": s.in,
 	}).Debug("Launch search...")
-	for _, source := range s.sourcesToLookup {
+	for _, source := range sourcesToLookup {
 		switch source {
 		// User wants to search arc
 		case "arc":
@@ -327,7 +189,7 @@ func main() {
 					"input":          s.in,
 					"sourceToSearch": "arc",
 				}).Debug("Start search goroutine")
-				arcTorrents, err := arc.Lookup(s.in, timeout)
+				arcTorrents, err := arc.Lookup(q.siteInput("arc"), timeout)
 				if err != nil {
 					arcSearchErrCh <- err
 					return
@@ -335,12 +197,13 @@ func main() {
 				var torList []torrent
 				for _, arcTorrent := range arcTorrents {
 					t := torrent{
-						descURL:  arcTorrent.DescURL,
-						name:     arcTorrent.Name,
-						size:     "Unknown",
-						leechers: -1,
-						seeders:  -1,
-						source:   "arc",
+						descURL:   arcTorrent.DescURL,
+						name:      arcTorrent.Name,
+						size:      "Unknown",
+						sizeBytes: -1,
+						leechers:  -1,
+						seeders:   -1,
+						source:    "arc",
 					}
 					torList = append(torList, t)
 				}
@@ -354,7 +217,7 @@ func main() {
 					"input":          s.in,
 					"sourceToSearch": "tpb",
 				}).Debug("Start search goroutine")
-				tpbTorrents, err := tpb.Lookup(s.in, timeout)
+				tpbTorrents, err := tpb.Lookup(q.siteInput("tpb"), timeout)
 				if err != nil {
 					tpbSearchErrCh <- err
 					return
@@ -362,14 +225,18 @@ func main() {
 				var torList []torrent
 				for _, tpbTorrent := range tpbTorrents {
 					t := torrent{
-						magnet:   tpbTorrent.Magnet,
-						name:     tpbTorrent.Name,
-						size:     tpbTorrent.Size,
-						uplDate:  tpbTorrent.UplDate,
-						leechers: tpbTorrent.Leechers,
-						seeders:  tpbTorrent.Seeders,
-						source:   "tpb",
+						magnet:           tpbTorrent.Magnet,
+						name:             tpbTorrent.Name,
+						size:             tpbTorrent.Size,
+						sizeBytes:        tpbTorrent.SizeBytes,
+						uplDate:          tpbTorrent.UplDate,
+						uplTime:          tpbTorrent.UplTime,
+						uplDatePrecision: tpbTorrent.UplDatePrecision,
+						leechers:         tpbTorrent.Leechers,
+						seeders:          tpbTorrent.Seeders,
+						source:           "tpb",
 					}
+					setInfoHash(&t)
 					torList = append(torList, t)
 				}
 				tpbTorListCh <- torList
@@ -381,7 +248,7 @@ func main() {
 					"input":          s.in,
 					"sourceToSearch": "otts",
 				}).Debug("Start search goroutine")
-				ottsTorrents, err := otts.Lookup(s.in, timeout)
+				ottsTorrents, err := otts.Lookup(q.siteInput("otts"), timeout)
 				if err != nil {
 					ottsSearchErrCh <- err
 					return
@@ -389,13 +256,16 @@ func main() {
 				var torList []torrent
 				for _, ottsTorrent := range ottsTorrents {
 					t := torrent{
-						descURL:  ottsTorrent.DescURL,
-						name:     ottsTorrent.Name,
-						size:     ottsTorrent.Size,
-						uplDate:  ottsTorrent.UplDate,
-						leechers: ottsTorrent.Leechers,
-						seeders:  ottsTorrent.Seeders,
-						source:   "otts",
+						descURL:          ottsTorrent.DescURL,
+						name:             ottsTorrent.Name,
+						size:             ottsTorrent.Size,
+						sizeBytes:        ottsTorrent.SizeBytes,
+						uplDate:          ottsTorrent.UplDate,
+						uplTime:          ottsTorrent.UplTime,
+						uplDatePrecision: ottsTorrent.UplDatePrecision,
+						leechers:         ottsTorrent.Leechers,
+						seeders:          ottsTorrent.Seeders,
+						source:           "otts",
 					}
 					torList = append(torList, t)
 				}
@@ -408,7 +278,7 @@ func main() {
 					"input":          s.in,
 					"sourceToSearch": "ygg",
 				}).Debug("Start search goroutine")
-				yggTorrents, httpClient, err := ygg.Lookup(s.in, timeout)
+				yggTorrents, httpClient, err := ygg.Lookup(q.siteInput("ygg"), timeout)
 				if err != nil {
 					yggSearchErrCh <- err
 					return
@@ -416,13 +286,16 @@ func main() {
 				var torList []torrent
 				for _, yggTorrent := range yggTorrents {
 					t := torrent{
-						descURL:  yggTorrent.DescURL,
-						name:     yggTorrent.Name,
-						size:     yggTorrent.Size,
-						uplDate:  yggTorrent.UplDate,
-						leechers: yggTorrent.Leechers,
-						seeders:  yggTorrent.Seeders,
-						source:   "ygg",
+						descURL:          yggTorrent.DescURL,
+						name:             yggTorrent.Name,
+						size:             yggTorrent.Size,
+						sizeBytes:        yggTorrent.SizeBytes,
+						uplDate:          yggTorrent.UplDate,
+						uplTime:          yggTorrent.UplTime,
+						uplDatePrecision: yggTorrent.UplDatePrecision,
+						leechers:         yggTorrent.Leechers,
+						seeders:          yggTorrent.Seeders,
+						source:           "ygg",
 					}
 					torList = append(torList, t)
 				}
@@ -434,16 +307,17 @@ func main() {
 	}
 
 	// Initialize search errors
+	s.errs = make(map[string]error)
 	var arcSearchErr, tpbSearchErr, ottsSearchErr, yggSearchErr error
 
 	// Gather all goroutines results
-	for _, source := range s.sourcesToLookup {
+	for _, source := range sourcesToLookup {
 		switch source {
 		case "arc":
 			// Get results or error from arc
 			select {
 			case arcSearchErr = <-arcSearchErrCh:
-				fmt.Printf("An error occured during search on %v%v", sources["arc"], lineBreak)
+				s.errs["arc"] = arcSearchErr
 				log.WithFields(log.Fields{
 					"input": s.in,
 					"error": arcSearchErr,
@@ -459,7 +333,7 @@ func main() {
 			// Get results or error from tpb
 			select {
 			case tpbSearchErr = <-tpbSearchErrCh:
-				fmt.Printf("An error occured during search on %v%v", sources["tpb"], lineBreak)
+				s.errs["tpb"] = tpbSearchErr
 				log.WithFields(log.Fields{
 					"input": s.in,
 					"error": tpbSearchErr,
@@ -475,7 +349,7 @@ func main() {
 			// Get results or error from otts
 			select {
 			case ottsSearchErr = <-ottsSearchErrCh:
-				fmt.Printf("An error occured during search on %v%v", sources["otts"], lineBreak)
+				s.errs["otts"] = ottsSearchErr
 				log.WithFields(log.Fields{
 					"input": s.in,
 					"error": ottsSearchErr,
@@ -491,7 +365,7 @@ func main() {
 			// Get results or error from ygg
 			select {
 			case yggSearchErr = <-yggSearchErrCh:
-				fmt.Printf("An error occured during search on %v%v", sources["ygg"], lineBreak)
+				s.errs["ygg"] = yggSearchErr
 				log.WithFields(log.Fields{
 					"input": s.in,
 					"error": yggSearchErr,
@@ -506,165 +380,813 @@ func main() {
 			}
 		}
 	}
+	// Return an error only if all goroutines returned an error
+	if len(s.errs) == len(sourcesToLookup) {
+		return fmt.Errorf("all searches returned an error")
+	}
+
+	// Apply the parts of the search the sources do not support
+	var matching []torrent
+	for _, t := range s.out {
+		if q.match(t) {
+			matching = append(matching, t)
+		}
+	}
+	s.out = matching
+
+	return nil
+}
+
+// render renders torrents in a tabular user-friendly way with colors in terminal
+func render(torrents []torrent) {
+	// Turn type []torrent to type [][]string because this is what tablewriter expects
+	var renderedTorrents [][]string
+	for i, t := range torrents {
+		// Replace -1 by unknown because more user-friendly
+		seedersStr := strconv.Itoa(t.seeders)
+		if seedersStr == "-1" {
+			seedersStr = "Unknown"
+		}
+		leechersStr := strconv.Itoa(t.leechers)
+		if leechersStr == "-1" {
+			leechersStr = "Unknown"
+		}
+		// Mark the figures given by trackers
+		if t.isTrackerVerified {
+			seedersStr += " ✓"
+			leechersStr += " ✓"
+		}
+		renderedTorrent := []string{
+			strconv.Itoa(i),
+			t.name,
+			displaySize(t),
+			seedersStr,
+			leechersStr,
+			displayUplDate(t),
+			displaySources(t),
+		}
+		renderedTorrents = append([][]string{renderedTorrent}, renderedTorrents...)
+	}
+
+	// Render results using tablewriter
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Index", "Name", "Size", "Seeders", "Leechers", "Date of upload", "Source"})
+	table.SetRowLine(true)
+	table.SetColumnColor(
+		tablewriter.Colors{tablewriter.Normal, tablewriter.Normal},
+		tablewriter.Colors{tablewriter.Normal, tablewriter.Normal},
+		tablewriter.Colors{tablewriter.Normal, tablewriter.Normal},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgHiGreenColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgHiRedColor},
+		tablewriter.Colors{tablewriter.Normal, tablewriter.Normal},
+		tablewriter.Colors{tablewriter.Normal, tablewriter.Normal},
+	)
+	table.AppendBulk(renderedTorrents)
+	table.Render()
+}
+
+// displaySize returns the size of t as displayed to the user. Known sizes
+// are all formatted the same way whatever the source.
+func displaySize(t torrent) string {
+	if t.sizeBytes < 0 {
+		return "Unknown"
+	}
+	return core.FormatSize(t.sizeBytes)
+}
+
+// displayUplDate returns the upload date of t as displayed to the user.
+// Known dates are all formatted the same way whatever the source.
+func displayUplDate(t torrent) string {
+	if t.uplTime.IsZero() {
+		return t.uplDate
+	}
+	return core.FormatDate(t.uplTime, t.uplDatePrecision)
+}
+
+// getTorrentFile retrieves the torrent file of t and stores its local path in t.filePath.
+// TODO(juliensalinas): pass a proper context.Context object instead
+// of a mere timeout.
+func getTorrentFile(t *torrent, userID, in string, userPass string,
+	timeout time.Duration, httpClient *http.Client) error {
+	var err error
+	switch t.source {
+	case "arc":
+		log.WithFields(log.Fields{
+			"sourceToSearch": "arc",
+		}).Debug("Download torrent file")
+		t.filePath, err = arc.FindAndDlFile(t.descURL, in, timeout)
+	case "ygg":
+		log.WithFields(log.Fields{
+			"sourceToSearch": "ygg",
+		}).Debug("Download torrent file")
+		t.filePath, err = ygg.FindAndDlFile(
+			t.descURL, in, userID, userPass, timeout, httpClient)
+	default:
+		err = fmt.Errorf("%s does not provide torrent files", t.source)
+	}
+	if err == nil {
+		setInfoHash(t)
+	}
+
+	return err
+}
+
+// getMagnet retrieves the magnet link of t and stores it in t.magnet.
+func getMagnet(t *torrent, timeout time.Duration) error {
+	var err error
+	switch t.source {
+	case "tpb":
+		// Magnet is already known from the search results page
+	case "otts":
+		log.WithFields(log.Fields{
+			"sourceToSearch": "otts",
+		}).Debug("Extract magnet")
+		t.magnet, err = otts.ExtractMag(t.descURL, timeout)
+	default:
+		err = fmt.Errorf("%s does not provide magnet links", t.source)
+	}
+	if err == nil {
+		setInfoHash(t)
+		t.magnet = extraTrackers.addTo(t.source, t.magnet)
+	}
+
+	return err
+}
+
+// fetchTorrentFile converts the magnet of t into a torrent file, by fetching
+// its metadata from the peers of its swarm, and stores the path of the file in
+// t.filePath.
+// The file is named after in, like the downloaded torrent files.
+func fetchTorrentFile(t *torrent, in string, timeout time.Duration) error {
+	m, err := magnet.Parse(t.magnet)
+	if err != nil {
+		return fmt.Errorf("could not parse magnet: %v", err)
+	}
+	log.WithFields(log.Fields{
+		"infoHash": m.InfoHash,
+		"trackers": len(m.Trackers),
+	}).Debug("Fetch metadata from peers")
+	mi, err := metadata.Resolve(m, dht.DefaultBootstrapNodes, timeout)
+	if err != nil {
+		return err
+	}
+	data, err := mi.Bytes()
+	if err != nil {
+		return fmt.Errorf("could not build the torrent file: %v", err)
+	}
+	t.filePath, err = core.SaveTorrentFile(data, in)
+
+	return err
+}
+
+// isFileSource reports whether source provides torrent files rather than
+// magnets
+func isFileSource(source string) bool {
+	return source == "arc" || source == "ygg"
+}
+
+// setInfoHash sets t.infoHash and t.trackers from the magnet or the torrent
+// file of t, when they are known
+func setInfoHash(t *torrent) {
+	if t.magnet != "" {
+		m, err := magnet.Parse(t.magnet)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"magnet": t.magnet,
+				"error":  err,
+			}).Debug("Could not parse magnet")
+			return
+		}
+		t.infoHash = m.InfoHash
+		if t.infoHash == "" {
+			t.infoHash = m.InfoHashV2
+		}
+		t.trackers = m.Trackers
+		return
+	}
+	if t.filePath != "" {
+		mi, err := metainfo.Load(t.filePath)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"filePath": t.filePath,
+				"error":    err,
+			}).Debug("Could not parse torrent file")
+			return
+		}
+		t.infoHash = mi.InfoHashHex()
+		t.trackers = mi.AnnounceURLs()
+	}
+}
+
+// torrentClients maps torrent client names to the command opening them
+var torrentClients = map[string]string{
+	"deluge":       "deluge",
+	"qbittorrent":  "qbittorrent",
+	"transmission": "transmission-gtk",
+}
+
+// clientCommand returns the command line used to open a resource in the given
+// torrent client.
+// Known client names are converted to their command, anything else is used as
+// a command line (e.g. "transmission-remote localhost:9091 -a").
+func clientCommand(torrentClient string) []string {
+	if cmd, ok := torrentClients[torrentClient]; ok {
+		return []string{cmd}
+	}
+	return strings.Fields(torrentClient)
+}
+
+// openInClient opens magnet link or torrent file in user torrent client
+func openInClient(resource string, torrentClient string) error {
+	log.WithFields(log.Fields{
+		"resource": resource,
+		"client":   torrentClient,
+	}).Debug("Opening magnet link or torrent file with torrent client")
+	cmdLine := clientCommand(torrentClient)
+	if len(cmdLine) == 0 {
+		return fmt.Errorf("no torrent client")
+	}
+	cmd := exec.Command(cmdLine[0], append(cmdLine[1:], resource)...)
+
+	// Use Start() instead of Run() because do not want to wait for the torrent
+	// client process to complete (detached process).
+	// The process is still waited for in the background so long running
+	// programs do not leave zombie processes behind.
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+
+	return nil
+}
+
+// rmDuplicates removes duplicates from slice, keeping the order of the
+// first occurrences
+func rmDuplicates(elements []string) []string {
+	encountered := map[string]bool{}
+
+	result := []string{}
+	for _, element := range elements {
+		if !encountered[element] {
+			encountered[element] = true
+			result = append(result, element)
+		}
+	}
+	return result
+}
+
+// parseSources converts a comma separated list of user sources into a list
+// of source short names.
+// Duplicates are removed and "all" is converted to the proper source names.
+// An error is returned if a source is unknown.
+func parseSources(usrSources string) ([]string, error) {
+	cleanedUsrSourcesSlc := rmDuplicates(strings.Split(usrSources, ","))
+	for _, usrSource := range cleanedUsrSourcesSlc {
+		if usrSource == "all" {
+			return []string{"arc", "tpb", "otts", "ygg"}, nil
+		}
+		if _, ok := sources[usrSource]; !ok {
+			return nil, fmt.Errorf("unknown source %v", usrSource)
+		}
+	}
+
+	return cleanedUsrSourcesSlc, nil
+}
+
+// isOutputFormat checks whether format is a machine-readable output format
+func isOutputFormat(format string) bool {
+	for _, f := range outputFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// setLogger sets various logging parameters
+func setLogger(isVerbose bool) {
+	// If verbose, set logger to debug, otherwise display errors only
+	if isVerbose {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetLevel(log.ErrorLevel)
+	}
+
+	// Log as standard text
+	log.SetFormatter(&log.TextFormatter{})
+
+	// Log as JSON instead of the default ASCII formatter
+	// log.SetFormatter(&log.JSONFormatter{})
+
+	// Log filename and line number.
+	// Should be removed from production because adds a performance cost.
+	log.AddHook(filename.NewHook())
+}
+
+func init() {
+	// Set custom line break in order for the script to work on any OS
+	if runtime.GOOS == "windows" {
+		lineBreak = "\r\n"
+	} else {
+		lineBreak = "\n"
+	}
+}
+
+func main() {
+	// Dispatch subcommands, which have their own flags
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			serveCmd(os.Args[2:])
+			return
+		case "shell":
+			shellCmd(os.Args[2:])
+			return
+		case "batch":
+			batchCmd(os.Args[2:])
+			return
+		case "info":
+			infoCmd(os.Args[2:])
+			return
+		case "fetch":
+			fetchCmd(os.Args[2:])
+			return
+		case "download":
+			downloadCmd(os.Args[2:])
+			return
+		case "verify":
+			verifyCmd(os.Args[2:])
+			return
+		case "create":
+			createCmd(os.Args[2:])
+			return
+		}
+	}
+
+	// Get command line flags and arguments
+	flag.Usage = func() {
+		fmt.Fprintf(
+			flag.CommandLine.Output(),
+			"Usage of %[1]s:%[2]s%[2]s\t%[1]s [-s sources] [-t timeout] [-v] [-format format | -template template [-template-all]] [-pick index | -best] [-client client | -download dir] [-add-trackers file [-check-trackers]] [-print magnet|file] [-to-file [-metadata-timeout timeout]] [-yes] arg1 arg2 arg3 ...%[2]s"+
+				"\t%[1]s shell [options] [arg1 arg2 arg3 ...]%[2]s"+
+				"\t%[1]s batch [options] [file]%[2]s"+
+				"\t%[1]s info [options] file.torrent|magnet ...%[2]s"+
+				"\t%[1]s fetch [options] magnet ...%[2]s"+
+				"\t%[1]s download [options] file.torrent|magnet%[2]s"+
+				"\t%[1]s verify [options] file.torrent path%[2]s"+
+				"\t%[1]s create [options] path%[2]s"+
+				"\t%[1]s serve [options]%[2]s%[2]s"+
+				"Examples:%[2]s%[2]s\tSearch 'Alexandre Dumas' on all sources:%[2]s\t\t%[1]s Alexandre Dumas%[2]s"+
+				"\tSearch 'Alexandre Dumas' on Archive.org and ThePirateBay only:%[2]s\t\t%[1]s -s arc,tpb Alexandre Dumas%[2]s"+
+				"\tPrint the magnet of the most seeded 'Alexandre Dumas' torrent on ThePirateBay:%[2]s\t\t%[1]s -s tpb -best -print magnet Alexandre Dumas%[2]s%[2]s"+
+				"Options:%[2]s%[2]s",
+			os.Args[0], lineBreak,
+		)
+		flag.PrintDefaults()
+	}
+	usrSourcesPtr := flag.String("s", "all", "A comma separated list of sources "+
+		"you want to search."+lineBreak+"Choices: arc (Archive.org) | tpb (ThePirateBay) | otts (1337x) | ygg (YggTorrent). ")
+	timeoutInMillisecPtr := flag.Int("t", 20000, "Timeout of HTTP requests in milliseconds. Set it to 0 to completely remove timeout.")
+	isVerbosePtr := flag.Bool("v", false, "Verbose mode. Use it to see more logs.")
+	pickPtr := flag.String("pick", "", "Indexes of the torrents to download, like 1,4,7-9. Skips the results table and the prompts. "+
+		"Add @source to choose the source of merged torrents, like 4@otts.")
+	isBestPtr := flag.Bool("best", false, "Download the first torrent (the most seeded unless -sort is used). Skips the results table and the prompts.")
+	clientPtr := flag.String("client", "", "Open torrent in this torrent client without asking: "+
+		"deluge | qbittorrent | transmission, or any command line the magnet or torrent file is appended to.")
+	printPtr := flag.String("print", "", "Only print the magnet (magnet) or the torrent file path (file) on stdout. "+
+		"Fails if the torrent does not provide it.")
+	isYesPtr := flag.Bool("yes", false, "Answer yes to all questions.")
+	formatPtr := flag.String("format", "table", "Output format of the results: table | "+strings.Join(outputFormats, " | ")+
+		"."+lineBreak+"Other formats than table write all results to stdout and exit.")
+	templatePtr := flag.String("template", "", "Go text/template applied to each result, or name of a template "+
+		"defined in the config file. Writes the rendered results to stdout and exits.")
+	isTemplateAllPtr := flag.Bool("template-all", false, "Apply -template once to the whole results list instead of each result.")
+	minSeedersPtr := flag.Int("min-seeders", 0, "Only keep torrents with at least this number of seeders.")
+	minSizePtr := flag.String("min-size", "", "Only keep torrents bigger than this size (e.g. 100MB).")
+	maxSizePtr := flag.String("max-size", "", "Only keep torrents smaller than this size (e.g. 4GB).")
+	maxAgePtr := flag.String("max-age", "", "Only keep torrents uploaded during this period (e.g. 12h, 30d, 2w, 6m, 1y).")
+	includePtr := flag.String("include", "", "Only keep torrents whose name matches this regular expression.")
+	excludePtr := flag.String("exclude", "", "Drop torrents whose name matches this regular expression.")
+	maxPerSourcePtr := flag.Int("max-per-source", 0, "Maximum number of results kept per source.")
+	isNoMergePtr := flag.Bool("no-merge", false, "Do not merge the torrents found on several sources.")
+	isToFilePtr := flag.Bool("to-file", false, "Convert magnets into torrent files by fetching their metadata from the peers "+
+		"of the torrents (DHT and trackers), for torrent clients which only accept files. Implied by -print file.")
+	metadataTimeoutInMillisecPtr := flag.Int("metadata-timeout", int(defaultMetadataTimeout/time.Millisecond),
+		"Timeout of the metadata fetching of each magnet by -to-file and -download in milliseconds. "+
+			"Set it to 0 to completely remove timeout.")
+	isScrapePtr := flag.Bool("scrape", false, "Refresh seeders and leechers from the trackers of the torrents "+
+		"whose magnet is known (ThePirateBay for now).")
+	addTrackersPtr := flag.String("add-trackers", "", "File listing trackers, one per line, added to the magnets "+
+		"before they are printed or opened in torrent client. Overrides the trackers file of the config file.")
+	isCheckTrackersPtr := flag.Bool("check-trackers", false, "Only add the trackers of -add-trackers which answer.")
+	downloadDirPtr := flag.String("download", "", "Download the content of the chosen torrents into this directory with "+
+		"the built-in engine, instead of using a torrent client. See the download section of the config file for rate limits and seeding.")
+	sortPtr := flag.String("sort", "seeders", "Comma separated list of keys results are sorted by, the next keys being used "+
+		"for equal results: "+strings.Join(sortKeys, " | ")+". Prefix a key with - to reverse its order.")
+	flag.Parse()
+
+	// Get timeout and convert it to a proper Go timeout in nanoseconds
+	timeoutInMillisec := *timeoutInMillisecPtr
+	timeout := time.Duration(timeoutInMillisec * 1000 * 1000)
+	metadataTimeout := time.Duration(*metadataTimeoutInMillisecPtr) * time.Millisecond
+
+	// Set logging parameters depending on the verbose user input
+	isVerbose = *isVerbosePtr
+	setLogger(isVerbose)
+
+	// If no command line argument is supplied, then we stop here
+	if len(flag.Args()) == 0 {
+		fmt.Println("Please enter proper arguments (-h for help).")
+		os.Exit(1)
+	}
+	if *printPtr != "" && *printPtr != "magnet" && *printPtr != "file" {
+		fmt.Println("-print should be either magnet or file (-h for help).")
+		os.Exit(1)
+	}
+	isPick := *pickPtr != ""
+	if isPick && *isBestPtr {
+		fmt.Println("-pick and -best cannot be used together (-h for help).")
+		os.Exit(1)
+	}
+	isTable := *formatPtr == "table"
+	if !isTable && !isOutputFormat(*formatPtr) {
+		fmt.Printf("-format should be table or one of %v (-h for help).%v", strings.Join(outputFormats, ", "), lineBreak)
+		os.Exit(1)
+	}
+	if !isTable && (isPick || *isBestPtr) {
+		fmt.Printf("-format %v cannot be used with -pick or -best (-h for help).%v", *formatPtr, lineBreak)
+		os.Exit(1)
+	}
+	isTemplate := *templatePtr != ""
+	if isTemplate && (!isTable || isPick || *isBestPtr) {
+		fmt.Println("-template cannot be used with -format, -pick or -best (-h for help).")
+		os.Exit(1)
+	}
+	if *isTemplateAllPtr && !isTemplate {
+		fmt.Println("-template-all needs -template (-h for help).")
+		os.Exit(1)
+	}
+	isDownload := *downloadDirPtr != ""
+	if isDownload && *clientPtr != "" {
+		fmt.Println("-download and -client cannot be used together (-h for help).")
+		os.Exit(1)
+	}
+
+	// Load user configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Println("Could not load your config file (see logs for more details).")
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("Could not load config")
+	}
+
+	// Filters set with flags override the ones of the config file
+	filters := cfg.Filters
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "min-seeders":
+			filters.MinSeeders = *minSeedersPtr
+		case "min-size":
+			filters.MinSize = *minSizePtr
+		case "max-size":
+			filters.MaxSize = *maxSizePtr
+		case "max-age":
+			filters.MaxAge = *maxAgePtr
+		case "include":
+			filters.Include = *includePtr
+		case "exclude":
+			filters.Exclude = *excludePtr
+		case "max-per-source":
+			filters.MaxPerSource = *maxPerSourcePtr
+		}
+	})
+	resFilter, err := newResultFilter(filters)
+	if err != nil {
+		fmt.Printf("Could not use your filters: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+
+	// Trackers set with flags override the ones of the config file
+	trackersCfg := cfg.Trackers
+	if *addTrackersPtr != "" {
+		trackersCfg.File = *addTrackersPtr
+	}
+	if *isCheckTrackersPtr {
+		trackersCfg.Check = true
+	}
+	if err := initExtraTrackers(trackersCfg); err != nil {
+		fmt.Printf("Could not use your trackers: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+
+	// Check download settings before searching so errors are reported early
+	var engineCfg engine.Config
+	if isDownload {
+		downloadCfg := cfg.Download
+		downloadCfg.Dir = *downloadDirPtr
+		engineCfg, err = downloadCfg.engineConfig()
+		if err != nil {
+			fmt.Printf("Could not use your download settings: %v%v", err, lineBreak)
+			os.Exit(1)
+		}
+	}
+
+	// Check sort keys before searching so errors are reported early
+	if _, err := newSorter(*sortPtr, ""); err != nil {
+		fmt.Printf("Could not sort results: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+
+	// Parse user template before searching so errors are reported early
+	var tmpl *template.Template
+	if isTemplate {
+		tmpl, err = parseUserTemplate(*templatePtr, cfg)
+		if err != nil {
+			fmt.Printf("Could not use your template: %v%v", err, lineBreak)
+			os.Exit(1)
+		}
+	}
+
+	// In non-interactive mode no prompt is displayed and messages are
+	// written to stderr so that stdout only contains the results, or the
+	// magnet or the torrent file path
+	isInteractive := !isPick && !*isBestPtr && isTable && !isTemplate
+	msgOut := os.Stdout
+	if !isInteractive {
+		msgOut = os.Stderr
+	}
+
+	// Initialize the user search with the user input and sourcesToLookup, and out is zeroed.
+	// Stop if a user source is unknown.
+	// Concatenate all input arguments into one single string in case user does not use quotes.
+	sourcesToLookup, err := parseSources(*usrSourcesPtr)
+	if err != nil {
+		fmt.Printf("This website is not correct: %v%v", err, lineBreak)
+		log.WithFields(log.Fields{
+			"sourcesList": *usrSourcesPtr,
+			"error":       err,
+		}).Fatal("Unknown source in user sources list")
+	}
+	s := search{
+		in:              strings.Join(flag.Args(), " "),
+		sourcesToLookup: sourcesToLookup,
+	}
+
+	// Clean user input
+	err = s.cleanIn()
+	if err != nil {
+		fmt.Println("Could not process your input (see logs for more details).")
+		log.WithFields(log.Fields{
+			"input": s.in,
+			"error": err,
+		}).Fatal("Could not clean user input")
+	}
+
+	// Check the search syntax before searching
+	if _, err := parseQuery(s.in); err != nil {
+		fmt.Fprintf(msgOut, "Your search is not correct: %v%v", err, lineBreak)
+		os.Exit(1)
+	}
+
+	// Launch search and gather results
+	err = s.lookup(timeout)
+	for source := range s.errs {
+		fmt.Fprintf(msgOut, "An error occured during search on %v%v", sources[source], lineBreak)
+	}
 	// Stop the program only if all goroutines returned an error
-	if arcSearchErr != nil && tpbSearchErr != nil && ottsSearchErr != nil && yggSearchErr != nil {
-		fmt.Println("All searches returned an error.")
+	if err != nil {
+		fmt.Fprintln(msgOut, "All searches returned an error.")
 		log.WithFields(log.Fields{
 			"input": s.in,
 			"error": err,
 		}).Fatal("All searches broke")
 	}
 
+	// Ask the trackers for live seeders and leechers
+	if *isScrapePtr {
+		log.Debug("Scrape trackers")
+		s.scrapeOut(timeout)
+	}
+
+	// Merge the torrents found on several sources
+	if !*isNoMergePtr {
+		s.mergeOut()
+	}
+
+	// Drop the results the user does not want
+	s.filterOutWith(resFilter)
+
 	// Stop the program if no result found
 	if len(s.out) == 0 {
-		fmt.Println("No result found...")
+		fmt.Fprintln(msgOut, "No result found...")
 		os.Exit(1)
 	}
 
-	// Sort results (on seeders)
+	// Sort results (on seeders by default)
 	log.Debug("Sort results")
-	s.sortOut()
+	s.sortOutBy(*sortPtr)
+
+	// Write all results with the user template and stop here
+	if isTemplate {
+		err = writeTemplate(os.Stdout, tmpl, s.in, s.out, *isTemplateAllPtr)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"template": *templatePtr,
+				"error":    err,
+			}).Fatal("Could not render results with template")
+		}
+		return
+	}
 
-	// Render the list of results to user in terminal
-	log.Debug("Render results")
-	render(s.out)
+	// Write all results in a machine-readable format and stop here
+	if !isTable {
+		err = writeRecords(os.Stdout, *formatPtr, s.out)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"format": *formatPtr,
+				"error":  err,
+			}).Fatal("Could not write results")
+		}
+		return
+	}
 
-	// Read from user input the index of torrent we want to download
+	// Choose the torrents to download, either from flags or from user input
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Println("Please select a torrent to download (enter its index): ")
-	var index int
-	for {
-		indexStr, err := reader.ReadString('\n') // returns string + delimiter
+	var indexes []int
+	switch {
+	case *isBestPtr:
+		indexes = []int{0}
+	case isPick:
+		indexes, err = parseSelection(*pickPtr, s.out)
 		if err != nil {
-			fmt.Println("Could not read your input, please try again (should be an integer):")
-			continue
+			fmt.Fprintf(msgOut, "Could not use -pick: %v (%d results were found).%s", err, len(s.out), lineBreak)
+			os.Exit(1)
 		}
-		// Remove delimiter which depends on OS + white spaces if any, and convert to integer
-		index, err = strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(indexStr, lineBreak)))
+	case !isDownload && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())):
+		// Let user browse results and act on them in a full-screen interface
+		log.Debug("Launch TUI")
+		err = runTUI(&s, *sortPtr, timeout, *clientPtr)
 		if err != nil {
-			fmt.Println("Please enter an integer:")
-			continue
+			fmt.Println("An error occured in the terminal interface (see logs for more details).")
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Fatal("TUI broke")
 		}
-		break
-	}
+		return
+	default:
+		// Render the list of results to user in terminal
+		log.Debug("Render results")
+		render(s.out)
 
-	// Final torrent we're working on as of now
-	ft = s.out[index]
-	log.WithFields(log.Fields{
-		"descURL":       ft.descURL,
-		"torrentSource": ft.source,
-	}).Debug("Got the final torrent to work on")
-
-	// Read from user input whether he wants to open torrent in client or not
-	reader = bufio.NewReader(os.Stdin)
-	fmt.Println("Do you want to open torrent in torrent client? [y / n]")
-	var launchClient string
-	for {
-		launchClientStr, err := reader.ReadString('\n') // returns string + delimiter
+		indexes, err = promptIndexes(reader, s.out)
 		if err != nil {
-			fmt.Println("Could not read your input, please try again (should be 'y' or 'n'):")
-			continue
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Fatal("Could not read torrent indexes")
 		}
-		// Remove delimiter which depends on OS + white spaces if any
-		launchClient = strings.TrimSpace(strings.TrimSuffix(launchClientStr, lineBreak))
-		break
 	}
+	log.WithFields(log.Fields{
+		"indexes": indexes,
+	}).Debug("Got the final torrents to work on")
 
-	var torrentClientAbbr string
-	if launchClient == "y" {
-		// Read from user input whether he wants to open torrent in Deluge or QBittorrent client
-		reader = bufio.NewReader(os.Stdin)
-		fmt.Println("Do you want to open torrent in Deluge (d), QBittorrent (q), or Transmission (t)?")
-		for {
-			torrentClientAbbrStr, err := reader.ReadString('\n')
-			if err != nil {
-				fmt.Println("Could not read your input, please try again (should be 'd', 'q' or 't'):")
-				continue
+	// Check that the torrents provide what the user wants to print. Magnets
+	// can be converted into torrent files, but it is faster to download the
+	// files of merged torrents when a source provides them.
+	isToFile := *isToFilePtr || *printPtr == "file"
+	var needsYggCredentials bool
+	for _, index := range indexes {
+		t := &s.out[index]
+		if *printPtr != "" && isFileSource(t.source) != (*printPtr == "file") {
+			// Merged torrents may provide it from another source
+			for _, e := range t.mergedFrom {
+				if isFileSource(e.source) == (*printPtr == "file") {
+					t.preferSource(e.source)
+					break
+				}
 			}
-			// Remove delimiter which depends on OS + white spaces if any
-			torrentClientAbbr = strings.TrimSpace(strings.TrimSuffix(torrentClientAbbrStr, lineBreak))
-			if torrentClientAbbr != "d" && torrentClientAbbr != "q" && torrentClientAbbr != "t" {
-				fmt.Println("Please enter a valid torrent client. It should be 'd', 'q' or 't':")
-				continue
+			if *printPtr == "magnet" && isFileSource(t.source) {
+				fmt.Fprintf(msgOut, "%v does not provide a %v for %v.%v", sources[t.source], *printPtr, t.name, lineBreak)
+				os.Exit(1)
 			}
-			break
+		}
+		if t.source == "ygg" {
+			needsYggCredentials = true
 		}
 	}
 
-	// Convert user input into proper torrent client name
-	var torrentClient string
-	switch torrentClientAbbr {
-	case "d":
-		torrentClient = "deluge"
-	case "q":
-		torrentClient = "qbittorrent"
-	case "t":
-		torrentClient = "transmission-gtk"
+	// Choose whether torrent is opened in torrent client, and which one
+	torrentClient := *clientPtr
+	if torrentClient == "" && !isDownload {
+		launchClient := *isYesPtr
+		if !launchClient && isInteractive {
+			launchClient, err = promptYesNo(reader, "Do you want to open torrent in torrent client?")
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+				}).Fatal("Could not read user answer")
+			}
+		}
+		if launchClient {
+			if !isInteractive {
+				fmt.Fprintln(msgOut, "Please choose a torrent client with -client.")
+				os.Exit(1)
+			}
+			torrentClient, err = promptClient(reader)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+				}).Fatal("Could not read torrent client")
+			}
+		}
 	}
 
-	// Download torrent and optionnaly open in torrent client
-	switch ft.source {
-	case "arc":
-		getTorrentFile("", s.in, "", timeout, nil)
-		fmt.Printf("Here is your torrent file: %s%s%s", lineBreak, ft.filePath, lineBreak)
-		if launchClient == "y" {
-			openMagOrTorInClient(ft.filePath, torrentClient)
-		}
-	case "tpb":
-		fmt.Printf("Here is your magnet link: %s%s%s", lineBreak, ft.magnet, lineBreak)
-		if launchClient == "y" {
-			openMagOrTorInClient(ft.magnet, torrentClient)
+	// Ygg credentials are read from environment or asked to user
+	userID := os.Getenv("TORRENGO_YGG_ID")
+	userPass := os.Getenv("TORRENGO_YGG_PASS")
+	if needsYggCredentials && userID == "" {
+		if !isInteractive {
+			fmt.Fprintln(msgOut, "Please set your Ygg Torrent credentials in TORRENGO_YGG_ID and TORRENGO_YGG_PASS.")
+			os.Exit(1)
 		}
-	case "otts":
-		log.WithFields(log.Fields{
-			"sourceToSearch": "otts",
-		}).Debug("Extract magnet")
-		ft.magnet, err = otts.ExtractMag(ft.descURL, timeout)
+		userID, userPass, err = promptYggCredentials(reader)
 		if err != nil {
-			fmt.Println("An error occured while retrieving magnet.")
 			log.WithFields(log.Fields{
-				"descURL":         ft.descURL,
-				"sourcesToLookup": s.sourcesToLookup,
-				"error":           err,
-			}).Fatal("Could not retrieve magnet")
+				"error": err,
+			}).Fatal("Could not read Ygg Torrent credentials")
 		}
-		fmt.Printf("Here is your magnet link: %s%s%s", lineBreak, ft.magnet, lineBreak)
-		if launchClient == "y" {
-			openMagOrTorInClient(ft.magnet, torrentClient)
+	}
+
+	// Download torrent files or retrieve magnets, and optionally open them in
+	// torrent client. Several torrents are processed concurrently.
+	if torrentClient != "" {
+		fmt.Fprintln(msgOut, "Opening torrents in client...")
+	}
+	if isToFile {
+		for _, index := range indexes {
+			if !isFileSource(s.out[index].source) {
+				fmt.Fprintln(msgOut, "Fetching torrent metadata from peers, this can take a while...")
+				break
+			}
 		}
-	case "ygg":
-		var userID string
-		var userPass string
-
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Println("You need an Ygg Torrent account to download the file.")
-		fmt.Println("Please enter your user ID: ")
-		for {
-			rawUserID, err := reader.ReadString('\n')
-			if err != nil {
-				fmt.Println("Could not read your input, please try again:")
+	}
+	results := resolveAll(&s, indexes, userID, userPass, timeout, metadataTimeout, isToFile, torrentClient)
+
+	// Report the result of each torrent.
+	// In non-interactive mode, or if asked to, only print the magnets or the
+	// torrent file paths on stdout so they can be piped to other programs.
+	var nbFailures int
+	for _, result := range results {
+		t := s.out[result.index]
+		if result.err != nil {
+			nbFailures++
+			fmt.Fprintf(msgOut, "Could not process torrent %d (%v) (see logs for more details).%v", result.index, t.name, lineBreak)
+			log.WithFields(log.Fields{
+				"descURL": t.descURL,
+				"client":  torrentClient,
+				"error":   result.err,
+			}).Error("Could not retrieve torrent or open it in client")
+			continue
+		}
+		switch {
+		case !isInteractive || *printPtr != "":
+			fmt.Println(result.resource)
+		case isFileSource(t.source) || isToFile:
+			fmt.Printf("Here is your torrent file for %v: %s%s%s", t.name, lineBreak, result.resource, lineBreak)
+		default:
+			fmt.Printf("Here is your magnet link for %v: %s%s%s", t.name, lineBreak, result.resource, lineBreak)
+		}
+	}
+	if len(results) > 1 {
+		fmt.Fprintf(msgOut, "Processed %d torrents successfully, %d failed.%s", len(results)-nbFailures, nbFailures, lineBreak)
+	}
+
+	// Download the content of the torrents one after the other
+	if isDownload {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		for _, result := range results {
+			if result.err != nil || ctx.Err() != nil {
 				continue
 			}
-			userID = strings.TrimSpace(strings.TrimSuffix(rawUserID, lineBreak))
-			break
-		}
-		fmt.Println("Please enter your user pass: ")
-		for {
-			// Using a special lib for password hiding during input
-			rawUserPassBytes, err := terminal.ReadPassword(int(syscall.Stdin))
+			torrentCfg := engineCfg
+			mi, err := loadTorrent(result.resource, &torrentCfg, metadataTimeout)
+			if err == nil {
+				err = downloadTorrent(ctx, mi, torrentCfg)
+			}
 			if err != nil {
-				fmt.Println("Could not read your input, please try again:")
-				continue
+				nbFailures++
+				t := s.out[result.index]
+				fmt.Fprintf(msgOut, "Could not download torrent %d (%v) (see logs for more details).%v", result.index, t.name, lineBreak)
+				log.WithFields(log.Fields{
+					"descURL": t.descURL,
+					"dir":     torrentCfg.Dir,
+					"error":   err,
+				}).Error("Could not download torrent content")
 			}
-			rawUserPass := string(rawUserPassBytes)
-			fmt.Println()
-			userPass = strings.TrimSpace(strings.TrimSuffix(rawUserPass, lineBreak))
-			break
-		}
-		getTorrentFile(userID, s.in, userPass, timeout, s.httpClient)
-		fmt.Printf("Here is your torrent file: %s%s%s", lineBreak, ft.filePath, lineBreak)
-		if launchClient == "y" {
-			openMagOrTorInClient(ft.filePath, torrentClient)
 		}
 	}
+	if nbFailures > 0 {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Torznab categories used by torrengo.
+// Sources do not tell the category of their torrents so results are
+// categorized based on the kind of search.
+const (
+	torznabCatMovies = 2000
+	torznabCatAudio  = 3000
+	torznabCatTV     = 5000
+	torznabCatBooks  = 7000
+	torznabCatOther  = 8000
+)
+
+// Torznab error codes
+const (
+	torznabErrCredentials    = 100
+	torznabErrMissingParam   = 200
+	torznabErrIncorrectParam = 201
+	torznabErrNoFunction     = 202
+	torznabErrUnknown        = 900
+)
+
+// torznabCaps is the response to the caps function
+type torznabCaps struct {
+	XMLName    xml.Name `xml:"caps"`
+	Server     torznabServerInfo
+	Limits     torznabLimits
+	Searching  torznabSearching
+	Categories torznabCategories
+}
+
+type torznabServerInfo struct {
+	XMLName xml.Name `xml:"server"`
+	Title   string   `xml:"title,attr"`
+}
+
+type torznabLimits struct {
+	XMLName xml.Name `xml:"limits"`
+	Max     int      `xml:"max,attr"`
+	Default int      `xml:"default,attr"`
+}
+
+type torznabSearching struct {
+	XMLName     xml.Name             `xml:"searching"`
+	Search      torznabSearchingMode `xml:"search"`
+	TVSearch    torznabSearchingMode `xml:"tv-search"`
+	MovieSearch torznabSearchingMode `xml:"movie-search"`
+}
+
+type torznabSearchingMode struct {
+	Available       string `xml:"available,attr"`
+	SupportedParams string `xml:"supportedParams,attr"`
+}
+
+type torznabCategories struct {
+	XMLName    xml.Name          `xml:"categories"`
+	Categories []torznabCategory `xml:"category"`
+}
+
+type torznabCategory struct {
+	ID   int    `xml:"id,attr"`
+	Name string `xml:"name,attr"`
+}
+
+// torznabFeed is the RSS feed returned by the search functions
+type torznabFeed struct {
+	XMLName   xml.Name       `xml:"rss"`
+	Version   string         `xml:"version,attr"`
+	TorznabNS string         `xml:"xmlns:torznab,attr"`
+	Channel   torznabChannel `xml:"channel"`
+}
+
+type torznabChannel struct {
+	Title       string        `xml:"title"`
+	Description string        `xml:"description"`
+	Items       []torznabItem `xml:"item"`
+}
+
+type torznabItem struct {
+	Title     string           `xml:"title"`
+	GUID      string           `xml:"guid"`
+	Link      string           `xml:"link"`
+	Comments  string           `xml:"comments,omitempty"`
+	PubDate   string           `xml:"pubDate,omitempty"`
+	Size      int64            `xml:"size,omitempty"`
+	Category  int              `xml:"category"`
+	Enclosure torznabEnclosure `xml:"enclosure"`
+	Attrs     []torznabAttr    `xml:"torznab:attr"`
+}
+
+type torznabEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type torznabAttr struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type torznabError struct {
+	XMLName     xml.Name `xml:"error"`
+	Code        int      `xml:"code,attr"`
+	Description string   `xml:"description,attr"`
+}
+
+// torznabMaxResults is the maximum number of results returned by a search
+const torznabMaxResults = 100
+
+// handleTorznab implements the Torznab API (caps, search, tvsearch and movie
+// functions) on top of the torrengo sources
+func (srv *server) handleTorznab(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	if !srv.authorized(r) {
+		writeTorznabError(w, torznabErrCredentials, "Incorrect user credentials")
+		return
+	}
+
+	switch params.Get("t") {
+	case "caps":
+		writeTorznabXML(w, torznabCapabilities())
+	case "search", "tvsearch", "movie":
+		srv.torznabSearch(w, r)
+	case "":
+		writeTorznabError(w, torznabErrMissingParam, "Missing parameter (t)")
+	default:
+		writeTorznabError(w, torznabErrNoFunction, "No such function")
+	}
+}
+
+// torznabCapabilities describes what the torrengo Torznab API supports
+func torznabCapabilities() torznabCaps {
+	return torznabCaps{
+		Server: torznabServerInfo{Title: "Torrengo"},
+		Limits: torznabLimits{Max: torznabMaxResults, Default: torznabMaxResults},
+		Searching: torznabSearching{
+			Search:      torznabSearchingMode{Available: "yes", SupportedParams: "q"},
+			TVSearch:    torznabSearchingMode{Available: "yes", SupportedParams: "q,season,ep"},
+			MovieSearch: torznabSearchingMode{Available: "yes", SupportedParams: "q"},
+		},
+		Categories: torznabCategories{Categories: []torznabCategory{
+			{ID: torznabCatMovies, Name: "Movies"},
+			{ID: torznabCatAudio, Name: "Audio"},
+			{ID: torznabCatTV, Name: "TV"},
+			{ID: torznabCatBooks, Name: "Books"},
+			{ID: torznabCatOther, Name: "Other"},
+		}},
+	}
+}
+
+// torznabSearch launches a search on the sources and writes results as a
+// Torznab feed
+func (srv *server) torznabSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	in, err := torznabQuery(params.Get("t"), params.Get("q"), params.Get("season"), params.Get("ep"))
+	if err != nil {
+		writeTorznabError(w, torznabErrIncorrectParam, err.Error())
+		return
+	}
+	category, err := torznabCategoryOf(params.Get("t"), params.Get("cat"))
+	if err != nil {
+		writeTorznabError(w, torznabErrIncorrectParam, err.Error())
+		return
+	}
+	limit, offset, err := torznabPagination(params.Get("limit"), params.Get("offset"))
+	if err != nil {
+		writeTorznabError(w, torznabErrIncorrectParam, err.Error())
+		return
+	}
+
+	feed := torznabFeed{
+		Version:   "2.0",
+		TorznabNS: "http://torznab.com/schemas/2015/feed",
+		Channel: torznabChannel{
+			Title:       "Torrengo",
+			Description: "Torrengo Torznab feed",
+		},
+	}
+
+	// Sonarr and Radarr check indexers with an empty search, which is not
+	// supported by the sources, so return an empty feed
+	if in == "" {
+		writeTorznabXML(w, feed)
+		return
+	}
+
+	s, err := srv.search(in, srv.sourcesToLookup, srv.timeout)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"input": in,
+			"error": err,
+		}).Error("Torznab search failed")
+		writeTorznabError(w, torznabErrUnknown, "All searches returned an error")
+		return
+	}
+
+	// Torznab has no sort parameter, so pages start with the best seeded
+	// results
+	s.sortOut()
+
+	results := s.out
+	if offset > len(results) {
+		offset = len(results)
+	}
+	results = results[offset:]
+	if limit < len(results) {
+		results = results[:limit]
+	}
+	for _, t := range results {
+		feed.Channel.Items = append(feed.Channel.Items, srv.torznabItem(r, t, in, category))
+	}
+
+	writeTorznabXML(w, feed)
+}
+
+// torznabItem converts a torrent into a Torznab feed item.
+// Enclosures of tpb torrents are magnets, others are links to the server
+// which lazily resolve the magnet or the torrent file.
+func (srv *server) torznabItem(r *http.Request, t torrent, in string, category int) torznabItem {
+	link := t.magnet
+	if link == "" {
+		link = srv.signedURL(r, "/dl", t, in)
+	}
+	guid := t.descURL
+	if guid == "" {
+		guid = t.magnet
+	}
+	size := t.sizeBytes
+	if size < 0 {
+		size = 0
+	}
+
+	var pubDate string
+	if !t.uplTime.IsZero() {
+		pubDate = t.uplTime.Format(time.RFC1123Z)
+	}
+
+	item := torznabItem{
+		Title:     t.name,
+		GUID:      guid,
+		Link:      link,
+		Comments:  t.descURL,
+		PubDate:   pubDate,
+		Size:      size,
+		Category:  category,
+		Enclosure: torznabEnclosure{URL: link, Length: size, Type: "application/x-bittorrent"},
+		Attrs: []torznabAttr{
+			{Name: "category", Value: strconv.Itoa(category)},
+			{Name: "downloadvolumefactor", Value: "1"},
+			{Name: "uploadvolumefactor", Value: "1"},
+		},
+	}
+	if t.magnet != "" {
+		item.Attrs = append(item.Attrs, torznabAttr{Name: "magneturl", Value: t.magnet})
+	}
+	if t.infoHash != "" {
+		item.Attrs = append(item.Attrs, torznabAttr{Name: "infohash", Value: t.infoHash})
+	}
+	if t.seeders >= 0 {
+		item.Attrs = append(item.Attrs, torznabAttr{Name: "seeders", Value: strconv.Itoa(t.seeders)})
+		if t.leechers >= 0 {
+			item.Attrs = append(item.Attrs,
+				torznabAttr{Name: "leechers", Value: strconv.Itoa(t.leechers)},
+				torznabAttr{Name: "peers", Value: strconv.Itoa(t.seeders + t.leechers)},
+			)
+		}
+	}
+
+	return item
+}
+
+// torznabQuery builds the user search out of the Torznab search parameters.
+// TV searches get the usual SxxEyy suffix appended.
+func torznabQuery(function, q, season, ep string) (string, error) {
+	in := strings.TrimSpace(q)
+	if function != "tvsearch" || season == "" || in == "" {
+		return in, nil
+	}
+
+	// Daily shows use the year as season and "month/day" as episode
+	seasonNb, err := strconv.Atoi(season)
+	if err != nil {
+		return "", fmt.Errorf("Incorrect parameter (season)")
+	}
+	if seasonNb >= 1000 {
+		return strings.TrimSpace(in + " " + season + " " + strings.Replace(ep, "/", " ", -1)), nil
+	}
+
+	in += fmt.Sprintf(" S%02d", seasonNb)
+	if ep != "" {
+		epNb, err := strconv.Atoi(ep)
+		if err != nil {
+			return "", fmt.Errorf("Incorrect parameter (ep)")
+		}
+		in += fmt.Sprintf("E%02d", epNb)
+	}
+
+	return in, nil
+}
+
+// torznabCategoryOf returns the category given to results: the first
+// requested category if any, otherwise a category based on the function
+func torznabCategoryOf(function, cat string) (int, error) {
+	if cat != "" {
+		category, err := strconv.Atoi(strings.Split(cat, ",")[0])
+		if err != nil {
+			return 0, fmt.Errorf("Incorrect parameter (cat)")
+		}
+		return category, nil
+	}
+
+	switch function {
+	case "movie":
+		return torznabCatMovies, nil
+	case "tvsearch":
+		return torznabCatTV, nil
+	}
+	return torznabCatOther, nil
+}
+
+// torznabPagination parses the limit and offset parameters
+func torznabPagination(limitStr, offsetStr string) (int, int, error) {
+	limit, offset := torznabMaxResults, 0
+	var err error
+	if limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			return 0, 0, fmt.Errorf("Incorrect parameter (limit)")
+		}
+		if limit > torznabMaxResults {
+			limit = torznabMaxResults
+		}
+	}
+	if offsetStr != "" {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("Incorrect parameter (offset)")
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// writeTorznabXML writes v as an XML document
+func writeTorznabXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	err := xml.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Could not encode Torznab response")
+	}
+}
+
+// writeTorznabError writes a Torznab error.
+// Torznab errors are sent with a 200 status code as expected by clients.
+func writeTorznabError(w http.ResponseWriter, code int, description string) {
+	writeTorznabXML(w, torznabError{Code: code, Description: description})
+}
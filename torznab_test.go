@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTorznabQuery(t *testing.T) {
+	in, err := torznabQuery("tvsearch", "The Wire", "3", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in != "The Wire S03E07" {
+		t.Fatalf("Got %q, want %q", in, "The Wire S03E07")
+	}
+
+	in, err = torznabQuery("tvsearch", "The Daily Show", "2019", "01/05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in != "The Daily Show 2019 01 05" {
+		t.Fatalf("Got %q, want %q", in, "The Daily Show 2019 01 05")
+	}
+
+	in, err = torznabQuery("movie", "Dumas", "3", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in != "Dumas" {
+		t.Fatalf("Got %q, want %q", in, "Dumas")
+	}
+}
+
+func TestTorznabCaps(t *testing.T) {
+	srv, err := newServer([]string{"arc"}, time.Second, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.handleTorznab(w, httptest.NewRequest("GET", "/torznab/api?t=caps", nil))
+	if !strings.Contains(w.Body.String(), `<error code="100"`) {
+		t.Fatalf("Missing API key should be rejected, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	srv.handleTorznab(w, httptest.NewRequest("GET", "/torznab/api?t=caps&apikey=secret", nil))
+	if !strings.Contains(w.Body.String(), `<tv-search available="yes" supportedParams="q,season,ep">`) {
+		t.Fatalf("Caps do not advertise TV search, got %s", w.Body.String())
+	}
+}
+
+func TestTorznabItem(t *testing.T) {
+	srv, err := newServer([]string{"arc"}, time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "http://localhost:9117/torznab/api?t=search&q=dumas", nil)
+
+	item := srv.torznabItem(r, torrent{
+		descURL:   "https://archive.org/details/dumas",
+		name:      "Dumas",
+		size:      "Unknown",
+		sizeBytes: -1,
+		seeders:   -1,
+		leechers:  -1,
+		source:    "arc",
+	}, "dumas", torznabCatBooks)
+	if !strings.HasPrefix(item.Enclosure.URL, "http://localhost:9117/dl?") {
+		t.Fatalf("Enclosure should be resolved by the server, got %s", item.Enclosure.URL)
+	}
+	for _, attr := range item.Attrs {
+		if attr.Name == "seeders" {
+			t.Fatal("Unknown seeders should not be advertised")
+		}
+	}
+
+	item = srv.torznabItem(r, torrent{
+		magnet:    "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567",
+		name:      "Dumas",
+		size:      "1.5 GiB",
+		sizeBytes: 1610612736,
+		seeders:   10,
+		leechers:  2,
+		source:    "tpb",
+	}, "dumas", torznabCatBooks)
+	if item.Enclosure.URL != item.GUID || !strings.HasPrefix(item.Link, "magnet:") {
+		t.Fatalf("Enclosure should be the magnet, got %s", item.Enclosure.URL)
+	}
+	if item.Size != 1610612736 {
+		t.Fatalf("Got size %d, want 1610612736", item.Size)
+	}
+}
+
+func TestHandleDlSignature(t *testing.T) {
+	srv, err := newServer([]string{"arc"}, time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.handleDl(w, httptest.NewRequest("GET", "/dl?source=arc&url=http://example.com&q=x&sig=bad", nil))
+	if w.Code != 403 {
+		t.Fatalf("Got status %d, want 403", w.Code)
+	}
+}
@@ -17,8 +17,13 @@
 //
 // - Size: the size of the file to be downloaded
 //
+// - SizeBytes: the size converted to bytes (set to -1 if cannot be converted)
+//
 // - UplDate: the date of upload
 //
+// - UplTime and UplDatePrecision: the date of upload converted to a time, and
+// its precision (core.PrecisionUnknown if cannot be converted)
+//
 // - Leechers: the number of leechers (set to -1 if cannot be converted to integer)
 //
 // - Seechers: the number of seechers (set to -1 if cannot be converted to integer)
@@ -41,10 +46,15 @@ const proxiesListURL = "https://pirateproxy.wtf"
 
 // Torrent contains meta information about the torrent
 type Torrent struct {
-	Magnet  string
-	Name    string
-	Size    string
-	UplDate string
+	Magnet string
+	Name   string
+	Size   string
+	// SizeBytes is set to -1 if Size cannot be converted to bytes
+	SizeBytes int64
+	UplDate   string
+	// UplTime is the zero time if UplDate cannot be converted
+	UplTime          time.Time
+	UplDatePrecision core.DatePrecision
 	// Seeders and Leechers are converted to -1 if cannot be converted to integers
 	Seeders  int
 	Leechers int
@@ -94,7 +104,9 @@ func parseSearchPage(html string) ([]Torrent, error) {
 		// Upload date, size, seeders, and leechers, are the text of
 		// other <span> tags.
 		t.UplDate = s.Find("span").Eq(2).Text()
+		t.UplTime, t.UplDatePrecision = core.ParseDate(t.UplDate, time.Now())
 		t.Size = s.Find("span").Eq(4).Text()
+		t.SizeBytes = core.ParseSize(t.Size)
 
 		// We convert seeders and leechers to integers and
 		// conversion fails we convert it to -1.
@@ -0,0 +1,167 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+)
+
+// announceLeft is the number of bytes left to download given to trackers.
+// It is not known before the torrent metadata are, but must not be 0 for
+// trackers to consider us as a leecher and give us seeders.
+const announceLeft = 1 << 30
+
+// Announce announces to the tracker with the given announce URL that we
+// start downloading the torrent with the given v1 infohash, and returns the
+// addresses of the peers of the torrent, like "192.168.1.2:6881".
+// http, https and udp trackers are supported.
+// Set timeout to 0 to completely remove timeout (UDP requests are still sent
+// a limited number of times).
+func Announce(announceURL string, infoHash, peerID [20]byte, port uint16, timeout time.Duration) ([]string, error) {
+	u, err := url.Parse(announceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tracker URL %v: %v", announceURL, err)
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return announceHTTP(u, infoHash, peerID, port, deadline)
+	case "udp":
+		return announceUDP(u.Host, infoHash, peerID, port, deadline)
+	}
+
+	return nil, fmt.Errorf("unsupported tracker scheme %v", u.Scheme)
+}
+
+// announceHTTP announces to an HTTP tracker
+func announceHTTP(announceURL *url.URL, infoHash, peerID [20]byte, port uint16, deadline time.Time) ([]string, error) {
+	u := *announceURL
+	params := "info_hash=" + url.QueryEscape(string(infoHash[:])) +
+		"&peer_id=" + url.QueryEscape(string(peerID[:])) +
+		"&port=" + strconv.Itoa(int(port)) +
+		"&uploaded=0&downloaded=0&left=" + strconv.Itoa(announceLeft) +
+		"&event=started&compact=1&numwant=50"
+	if u.RawQuery != "" {
+		u.RawQuery += "&"
+	}
+	u.RawQuery += params
+
+	client := &http.Client{}
+	if !deadline.IsZero() {
+		client.Timeout = time.Until(deadline)
+	}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("could not announce to tracker: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code error: %d %s", resp.StatusCode, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("could not read announce response: %v", err)
+	}
+
+	v, err := bencode.Decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid announce response: %v", err)
+	}
+	dict, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid announce response")
+	}
+	if reason, ok := dict["failure reason"].(string); ok {
+		return nil, fmt.Errorf("tracker error: %v", reason)
+	}
+
+	var peers []string
+	switch p := dict["peers"].(type) {
+	case string:
+		peers = CompactPeers([]byte(p), net.IPv4len)
+	case []interface{}:
+		// Non compact peers are dictionaries
+		for _, e := range p {
+			peer, ok := e.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			ip, _ := peer["ip"].(string)
+			port, _ := peer["port"].(int64)
+			if ip != "" && port > 0 && port < 1<<16 {
+				peers = append(peers, net.JoinHostPort(ip, strconv.Itoa(int(port))))
+			}
+		}
+	}
+	if p, ok := dict["peers6"].(string); ok {
+		peers = append(peers, CompactPeers([]byte(p), net.IPv6len)...)
+	}
+
+	return peers, nil
+}
+
+// announceUDP announces to an UDP tracker (BEP 15)
+func announceUDP(host string, infoHash, peerID [20]byte, port uint16, deadline time.Time) ([]string, error) {
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach tracker: %v", err)
+	}
+	defer conn.Close()
+
+	connID, err := udpConnect(conn, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	tid := rand.Uint32()
+	req := make([]byte, 98)
+	binary.BigEndian.PutUint64(req[0:], connID)
+	binary.BigEndian.PutUint32(req[8:], actionAnnounce)
+	binary.BigEndian.PutUint32(req[12:], tid)
+	copy(req[16:], infoHash[:])
+	copy(req[36:], peerID[:])
+	// Downloaded (56), left (64), uploaded (72)
+	binary.BigEndian.PutUint64(req[64:], announceLeft)
+	// Event: started
+	binary.BigEndian.PutUint32(req[80:], 2)
+	// IP address (84) is the sender's one, key (88) identifies us
+	binary.BigEndian.PutUint32(req[88:], rand.Uint32())
+	// Number of peers wanted: default
+	binary.BigEndian.PutUint32(req[92:], 0xFFFFFFFF)
+	binary.BigEndian.PutUint16(req[96:], port)
+	resp, err := udpRoundTrip(conn, req, actionAnnounce, tid, deadline)
+	if err != nil {
+		return nil, err
+	}
+	// Interval, leechers and seeders come first
+	if len(resp) < 12 {
+		return nil, fmt.Errorf("invalid announce response")
+	}
+
+	return CompactPeers(resp[12:], net.IPv4len), nil
+}
+
+// CompactPeers decodes peers in compact format: IP addresses of ipLen bytes
+// each followed by a port of 2 bytes
+func CompactPeers(b []byte, ipLen int) []string {
+	var peers []string
+	for ; len(b) >= ipLen+2; b = b[ipLen+2:] {
+		ip := net.IP(append([]byte(nil), b[:ipLen]...))
+		port := binary.BigEndian.Uint16(b[ipLen:])
+		peers = append(peers, net.JoinHostPort(ip.String(), strconv.Itoa(int(port))))
+	}
+	return peers
+}
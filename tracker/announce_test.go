@@ -0,0 +1,79 @@
+package tracker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+)
+
+// knownPeer is 10.0.0.1:6881 in compact format
+var knownPeer = []byte{10, 0, 0, 1, 0x1A, 0xE1}
+
+var peerID = [20]byte{'-', 'T', 'G'}
+
+func TestAnnounceHTTP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/announce" || q.Get("info_hash") != string(knownHash[:]) ||
+			q.Get("peer_id") != string(peerID[:]) || q.Get("port") != "6881" || q.Get("pk") != "42" {
+			w.Write([]byte("d14:failure reason7:unknowne"))
+			return
+		}
+		b, _ := bencode.Encode(map[string]interface{}{
+			"interval": 1800,
+			"peers":    string(knownPeer),
+			"peers6":   string(append(make([]byte, 15), 1, 0x1A, 0xE2)),
+		})
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	peers, err := Announce(ts.URL+"/announce?pk=42", knownHash, peerID, 6881, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.0.0.1:6881", "[::1]:6882"}; !reflect.DeepEqual(peers, want) {
+		t.Fatalf("Got peers %v, want %v", peers, want)
+	}
+
+	if _, err := Announce(ts.URL+"/announce", unknownHash, peerID, 6881, time.Second); err == nil {
+		t.Fatal("No error for a tracker failure")
+	}
+}
+
+func TestAnnounceHTTPNotCompact(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := bencode.Encode(map[string]interface{}{
+			"peers": []interface{}{
+				map[string]interface{}{"ip": "10.0.0.2", "port": 51413},
+				map[string]interface{}{"ip": "10.0.0.3"},
+			},
+		})
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	peers, err := Announce(ts.URL+"/announce", knownHash, peerID, 6881, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.0.0.2:51413"}; !reflect.DeepEqual(peers, want) {
+		t.Fatalf("Got peers %v, want %v", peers, want)
+	}
+}
+
+func TestAnnounceUDP(t *testing.T) {
+	addr := serveUDPTracker(t)
+
+	peers, err := Announce("udp://"+addr+"/announce", knownHash, peerID, 6881, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.0.0.1:6881"}; !reflect.DeepEqual(peers, want) {
+		t.Fatalf("Got peers %v, want %v", peers, want)
+	}
+}
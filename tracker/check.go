@@ -0,0 +1,85 @@
+package tracker
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+)
+
+// Check returns an error if the tracker with the given announce URL does not
+// answer. Trackers answering with an error, like for the unknown torrent
+// Check asks them about, are considered alive.
+// http, https and udp trackers are supported.
+func Check(announceURL string, timeout time.Duration) error {
+	u, err := url.Parse(announceURL)
+	if err != nil {
+		return fmt.Errorf("invalid tracker URL %v: %v", announceURL, err)
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return checkHTTP(u, deadline)
+	case "udp":
+		conn, err := net.Dial("udp", u.Host)
+		if err != nil {
+			return fmt.Errorf("could not reach tracker: %v", err)
+		}
+		defer conn.Close()
+		_, err = udpConnect(conn, deadline)
+		return err
+	}
+
+	return fmt.Errorf("unsupported tracker scheme %v", u.Scheme)
+}
+
+// checkHTTP checks that an HTTP tracker answers a bencoded dictionary to the
+// announce of a random torrent. The stopped event keeps trackers from adding
+// us to the peers of the torrent.
+func checkHTTP(announceURL *url.URL, deadline time.Time) error {
+	var infoHash, peerID [20]byte
+	rand.Read(infoHash[:])
+	rand.Read(peerID[:])
+	u := *announceURL
+	params := "info_hash=" + url.QueryEscape(string(infoHash[:])) +
+		"&peer_id=" + url.QueryEscape(string(peerID[:])) +
+		"&port=6881&uploaded=0&downloaded=0&left=0&event=stopped&compact=1"
+	if u.RawQuery != "" {
+		u.RawQuery += "&"
+	}
+	u.RawQuery += params
+
+	client := &http.Client{}
+	if !deadline.IsZero() {
+		client.Timeout = time.Until(deadline)
+	}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return fmt.Errorf("could not reach tracker: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code error: %d %s", resp.StatusCode, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("could not read announce response: %v", err)
+	}
+	if v, err := bencode.Decode(body); err != nil {
+		return fmt.Errorf("invalid announce response: %v", err)
+	} else if _, ok := v.(map[string]interface{}); !ok {
+		return fmt.Errorf("invalid announce response")
+	}
+
+	return nil
+}
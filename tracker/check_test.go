@@ -0,0 +1,54 @@
+package tracker
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckHTTP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/announce":
+			if r.URL.Query().Get("event") != "stopped" {
+				t.Errorf("Got event %q", r.URL.Query().Get("event"))
+			}
+			w.Write([]byte("d14:failure reason17:unknown info hashe"))
+		case "/parked":
+			w.Write([]byte("<html>This domain is for sale</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	if err := Check(ts.URL+"/announce", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/parked", "/missing"} {
+		if err := Check(ts.URL+path, 5*time.Second); err == nil {
+			t.Fatalf("No error for %v", path)
+		}
+	}
+}
+
+func TestCheckUDP(t *testing.T) {
+	addr := serveUDPTracker(t)
+	if err := Check("udp://"+addr+"/announce", 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := Check("udp://"+conn.LocalAddr().String(), 300*time.Millisecond); err == nil {
+		t.Fatal("No error for a silent tracker")
+	}
+	if err := Check("wss://tracker.example", time.Second); err == nil {
+		t.Fatal("No error for an unsupported tracker")
+	}
+}
@@ -0,0 +1,194 @@
+// Package tracker talks to BitTorrent trackers over HTTP (BEP 3 and BEP 48)
+// or UDP (BEP 15): it asks them the number of seeders and leechers of
+// torrents and the addresses of their peers, and checks that they answer.
+package tracker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+)
+
+// maxHashesPerScrape is the maximum number of infohashes scraped in one
+// request. UDP packets cannot hold more than about 74 infohashes.
+const maxHashesPerScrape = 50
+
+// ErrScrapeNotSupported is returned for HTTP trackers whose announce URL does
+// not follow the scrape convention
+var ErrScrapeNotSupported = errors.New("tracker does not support scrape")
+
+// Stats are the figures of a torrent given by a tracker
+type Stats struct {
+	Seeders  int
+	Leechers int
+	// Completed is the number of times the torrent was downloaded
+	Completed int
+}
+
+// Scrape asks the tracker with the given announce URL the stats of the
+// torrents with the given v1 infohashes.
+// http, https and udp trackers are supported. Torrents unknown to the
+// tracker are missing from the returned stats.
+// Set timeout to 0 to completely remove timeout (UDP requests are still sent
+// a limited number of times).
+func Scrape(announceURL string, infoHashes [][20]byte, timeout time.Duration) (map[[20]byte]Stats, error) {
+	u, err := url.Parse(announceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tracker URL %v: %v", announceURL, err)
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	stats := make(map[[20]byte]Stats)
+	for start := 0; start < len(infoHashes); start += maxHashesPerScrape {
+		end := start + maxHashesPerScrape
+		if end > len(infoHashes) {
+			end = len(infoHashes)
+		}
+		var chunkStats map[[20]byte]Stats
+		switch u.Scheme {
+		case "http", "https":
+			chunkStats, err = scrapeHTTP(u, infoHashes[start:end], deadline)
+		case "udp":
+			chunkStats, err = scrapeUDP(u.Host, infoHashes[start:end], deadline)
+		default:
+			return nil, fmt.Errorf("unsupported tracker scheme %v", u.Scheme)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for h, s := range chunkStats {
+			stats[h] = s
+		}
+	}
+
+	return stats, nil
+}
+
+// ScrapeURL converts an HTTP announce URL into its scrape URL: the last path
+// element must start with "announce", which is replaced by "scrape".
+func ScrapeURL(announceURL *url.URL) (*url.URL, error) {
+	i := strings.LastIndex(announceURL.Path, "/")
+	if i < 0 || !strings.HasPrefix(announceURL.Path[i+1:], "announce") {
+		return nil, ErrScrapeNotSupported
+	}
+	u := *announceURL
+	u.Path = announceURL.Path[:i+1] + "scrape" + strings.TrimPrefix(announceURL.Path[i+1:], "announce")
+	u.RawPath = ""
+
+	return &u, nil
+}
+
+// scrapeHTTP scrapes an HTTP tracker
+func scrapeHTTP(announceURL *url.URL, infoHashes [][20]byte, deadline time.Time) (map[[20]byte]Stats, error) {
+	u, err := ScrapeURL(announceURL)
+	if err != nil {
+		return nil, err
+	}
+	params := make([]string, 0, len(infoHashes))
+	for _, h := range infoHashes {
+		params = append(params, "info_hash="+url.QueryEscape(string(h[:])))
+	}
+	if u.RawQuery != "" {
+		u.RawQuery += "&"
+	}
+	u.RawQuery += strings.Join(params, "&")
+
+	client := &http.Client{}
+	if !deadline.IsZero() {
+		client.Timeout = time.Until(deadline)
+	}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("could not scrape tracker: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code error: %d %s", resp.StatusCode, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("could not read scrape response: %v", err)
+	}
+
+	v, err := bencode.Decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scrape response: %v", err)
+	}
+	dict, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid scrape response")
+	}
+	if reason, ok := dict["failure reason"].(string); ok {
+		return nil, fmt.Errorf("tracker error: %v", reason)
+	}
+	files, _ := dict["files"].(map[string]interface{})
+	stats := make(map[[20]byte]Stats)
+	for hash, f := range files {
+		file, ok := f.(map[string]interface{})
+		if !ok || len(hash) != 20 {
+			continue
+		}
+		var h [20]byte
+		copy(h[:], hash)
+		complete, _ := file["complete"].(int64)
+		incomplete, _ := file["incomplete"].(int64)
+		downloaded, _ := file["downloaded"].(int64)
+		stats[h] = Stats{Seeders: int(complete), Leechers: int(incomplete), Completed: int(downloaded)}
+	}
+
+	return stats, nil
+}
+
+// scrapeUDP scrapes an UDP tracker (BEP 15)
+func scrapeUDP(host string, infoHashes [][20]byte, deadline time.Time) (map[[20]byte]Stats, error) {
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach tracker: %v", err)
+	}
+	defer conn.Close()
+
+	connID, err := udpConnect(conn, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	tid := rand.Uint32()
+	req := make([]byte, 16, 16+20*len(infoHashes))
+	binary.BigEndian.PutUint64(req[0:], connID)
+	binary.BigEndian.PutUint32(req[8:], actionScrape)
+	binary.BigEndian.PutUint32(req[12:], tid)
+	for _, h := range infoHashes {
+		req = append(req, h[:]...)
+	}
+	resp, err := udpRoundTrip(conn, req, actionScrape, tid, deadline)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 12*len(infoHashes) {
+		return nil, fmt.Errorf("invalid scrape response")
+	}
+	stats := make(map[[20]byte]Stats)
+	for i, h := range infoHashes {
+		b := resp[12*i:]
+		stats[h] = Stats{
+			Seeders:   int(binary.BigEndian.Uint32(b[0:])),
+			Completed: int(binary.BigEndian.Uint32(b[4:])),
+			Leechers:  int(binary.BigEndian.Uint32(b[8:])),
+		}
+	}
+
+	return stats, nil
+}
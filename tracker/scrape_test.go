@@ -0,0 +1,174 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/juliensalinas/torrengo/bencode"
+)
+
+var (
+	knownHash   = [20]byte{1, 2, 3}
+	unknownHash = [20]byte{4, 5, 6}
+)
+
+func TestScrapeURL(t *testing.T) {
+	tests := map[string]string{
+		"http://t.example/announce":             "http://t.example/scrape",
+		"http://t.example/x/announce.php?pk=42": "http://t.example/x/scrape.php?pk=42",
+		"http://t.example/announce?pk=a%2Fb":    "http://t.example/scrape?pk=a%2Fb",
+	}
+	for announce, want := range tests {
+		u, _ := url.Parse(announce)
+		got, err := ScrapeURL(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want {
+			t.Fatalf("Got %v for %v, want %v", got, announce, want)
+		}
+	}
+
+	u, _ := url.Parse("http://t.example/a")
+	if _, err := ScrapeURL(u); err != ErrScrapeNotSupported {
+		t.Fatalf("Got error %v, want ErrScrapeNotSupported", err)
+	}
+}
+
+func TestScrapeHTTP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/scrape" || r.URL.Query().Get("pk") != "42" {
+			http.NotFound(w, r)
+			return
+		}
+		files := make(map[string]interface{})
+		for _, h := range r.URL.Query()["info_hash"] {
+			if h == string(knownHash[:]) {
+				files[h] = map[string]interface{}{"complete": 12, "incomplete": 3, "downloaded": 100}
+			}
+		}
+		b, _ := bencode.Encode(map[string]interface{}{"files": files})
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	stats, err := Scrape(ts.URL+"/announce?pk=42", [][20]byte{knownHash, unknownHash}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[knownHash] != (Stats{Seeders: 12, Leechers: 3, Completed: 100}) {
+		t.Fatalf("Got stats %+v", stats)
+	}
+}
+
+func TestScrapeHTTPFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "d14:failure reason12:unregisterede")
+	}))
+	defer ts.Close()
+
+	if _, err := Scrape(ts.URL+"/announce", [][20]byte{knownHash}, time.Second); err == nil {
+		t.Fatal("No error for a tracker failure")
+	}
+}
+
+// serveUDPTracker runs a stand-in UDP tracker which knows knownHash and its
+// peer knownPeer. The first packet is dropped to check retransmissions.
+func serveUDPTracker(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		const connID = 0xCAFE
+		buf := make([]byte, 2048)
+		isFirst := true
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if isFirst {
+				isFirst = false
+				continue
+			}
+			if n < 16 {
+				continue
+			}
+			action := binary.BigEndian.Uint32(buf[8:])
+			tid := buf[12:16]
+			switch {
+			case action == actionConnect && binary.BigEndian.Uint64(buf) == udpProtocolID:
+				resp := make([]byte, 16)
+				copy(resp[4:], tid)
+				binary.BigEndian.PutUint64(resp[8:], connID)
+				conn.WriteTo(resp, addr)
+			case action == actionScrape && binary.BigEndian.Uint64(buf) == connID:
+				resp := make([]byte, 8)
+				binary.BigEndian.PutUint32(resp, actionScrape)
+				copy(resp[4:], tid)
+				for i := 16; i+20 <= n; i += 20 {
+					stats := make([]byte, 12)
+					if string(buf[i:i+20]) == string(knownHash[:]) {
+						binary.BigEndian.PutUint32(stats[0:], 7)
+						binary.BigEndian.PutUint32(stats[4:], 50)
+						binary.BigEndian.PutUint32(stats[8:], 2)
+					}
+					resp = append(resp, stats...)
+				}
+				conn.WriteTo(resp, addr)
+			case action == actionAnnounce && binary.BigEndian.Uint64(buf) == connID && n >= 98:
+				resp := make([]byte, 20)
+				binary.BigEndian.PutUint32(resp, actionAnnounce)
+				copy(resp[4:], tid)
+				if string(buf[16:36]) == string(knownHash[:]) {
+					resp = append(resp, knownPeer...)
+				}
+				conn.WriteTo(resp, addr)
+			default:
+				resp := make([]byte, 8)
+				binary.BigEndian.PutUint32(resp, actionError)
+				copy(resp[4:], tid)
+				conn.WriteTo(append(resp, "bad request"...), addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestScrapeUDP(t *testing.T) {
+	addr := serveUDPTracker(t)
+
+	stats, err := Scrape("udp://"+addr+"/announce", [][20]byte{knownHash, unknownHash}, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats[knownHash] != (Stats{Seeders: 7, Leechers: 2, Completed: 50}) || stats[unknownHash] != (Stats{}) {
+		t.Fatalf("Got stats %+v", stats)
+	}
+}
+
+func TestScrapeUDPTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	if _, err := Scrape("udp://"+conn.LocalAddr().String(), [][20]byte{knownHash}, 300*time.Millisecond); err == nil {
+		t.Fatal("No error for a silent tracker")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("Timeout was not respected")
+	}
+}
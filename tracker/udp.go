@@ -0,0 +1,91 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// udpProtocolID is the magic constant of UDP connect requests
+const udpProtocolID = 0x41727101980
+
+// UDP tracker actions
+const (
+	actionConnect  = 0
+	actionAnnounce = 1
+	actionScrape   = 2
+	actionError    = 3
+)
+
+// udpMaxAttempts is the maximum number of times an UDP request is sent
+// without answer, the wait doubling each time
+const udpMaxAttempts = 4
+
+// udpFirstWait is how long the answer to the first UDP request is waited for
+const udpFirstWait = 2 * time.Second
+
+// udpConnect asks an UDP tracker a connection ID, required by the other
+// requests
+func udpConnect(conn net.Conn, deadline time.Time) (uint64, error) {
+	tid := rand.Uint32()
+	req := make([]byte, 16)
+	binary.BigEndian.PutUint64(req[0:], udpProtocolID)
+	binary.BigEndian.PutUint32(req[8:], actionConnect)
+	binary.BigEndian.PutUint32(req[12:], tid)
+	resp, err := udpRoundTrip(conn, req, actionConnect, tid, deadline)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) < 8 {
+		return 0, fmt.Errorf("invalid connect response")
+	}
+
+	return binary.BigEndian.Uint64(resp), nil
+}
+
+// udpRoundTrip sends an UDP request until its answer is received, and
+// returns the payload of the answer, following its action and transaction ID
+func udpRoundTrip(conn net.Conn, req []byte, action, tid uint32, deadline time.Time) ([]byte, error) {
+	buf := make([]byte, 4096)
+	wait := udpFirstWait
+	for attempt := 0; attempt < udpMaxAttempts; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, fmt.Errorf("could not send request to tracker: %v", err)
+		}
+		readDeadline := time.Now().Add(wait)
+		if !deadline.IsZero() && deadline.Before(readDeadline) {
+			readDeadline = deadline
+		}
+		conn.SetReadDeadline(readDeadline)
+		wait *= 2
+
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return nil, fmt.Errorf("could not read tracker response: %v", err)
+			}
+			if n < 8 || binary.BigEndian.Uint32(buf[4:]) != tid {
+				// Not the answer to this request
+				continue
+			}
+			switch binary.BigEndian.Uint32(buf) {
+			case action:
+				return append([]byte(nil), buf[8:n]...), nil
+			case actionError:
+				return nil, fmt.Errorf("tracker error: %s", buf[8:n])
+			default:
+				return nil, fmt.Errorf("unexpected tracker action %d", binary.BigEndian.Uint32(buf))
+			}
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("tracker did not answer")
+}
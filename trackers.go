@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/juliensalinas/torrengo/magnet"
+	"github.com/juliensalinas/torrengo/tracker"
+)
+
+// trackerCheckTimeout is the time given to each tracker of the list to
+// answer when trackers are checked
+const trackerCheckTimeout = 10 * time.Second
+
+// trackersConfig are the settings of the trackers added to magnets, read
+// from the config file
+type trackersConfig struct {
+	// File lists announce URLs, one per line
+	File string `json:"file"`
+	// Sources are the sources whose magnets get the trackers, all of them if
+	// empty
+	Sources []string `json:"sources"`
+	// Check drops the trackers of the list which do not answer
+	Check bool `json:"check"`
+}
+
+// trackerList are the trackers added to magnets
+type trackerList struct {
+	trackers []string
+	// sources are the sources whose magnets get the trackers, all of them if
+	// nil
+	sources map[string]bool
+	isCheck bool
+	// checkOnce checks the trackers the first time they are used, so that
+	// nothing is waited for if no magnet is needed
+	checkOnce sync.Once
+}
+
+// extraTrackers are the trackers added to magnets, nil if none
+var extraTrackers *trackerList
+
+// initExtraTrackers sets extraTrackers from cfg
+func initExtraTrackers(cfg trackersConfig) error {
+	extraTrackers = nil
+	if cfg.File == "" {
+		return nil
+	}
+
+	l := &trackerList{isCheck: cfg.Check}
+	var err error
+	l.trackers, err = readTrackerFile(cfg.File)
+	if err != nil {
+		return err
+	}
+	for _, source := range cfg.Sources {
+		if _, ok := sources[source]; !ok {
+			return fmt.Errorf("unknown source %v", source)
+		}
+		if l.sources == nil {
+			l.sources = make(map[string]bool)
+		}
+		l.sources[source] = true
+	}
+	extraTrackers = l
+
+	return nil
+}
+
+// loadExtraTrackers sets extraTrackers from the config file
+func loadExtraTrackers() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	return initExtraTrackers(cfg.Trackers)
+}
+
+// readTrackerFile reads a list of announce URLs, one per line. Blank lines
+// and lines starting with # are ignored, and duplicates are removed.
+func readTrackerFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read tracker list: %v", err)
+	}
+	defer f.Close()
+
+	var trackers []string
+	encountered := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for lineNb := 1; scanner.Scan(); lineNb++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("line %d of %v is not a tracker URL", lineNb, path)
+		}
+		if !encountered[line] {
+			encountered[line] = true
+			trackers = append(trackers, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read tracker list: %v", err)
+	}
+
+	return trackers, nil
+}
+
+// check drops the trackers which do not answer
+func (l *trackerList) check() {
+	isAlive := make([]bool, len(l.trackers))
+	var wg sync.WaitGroup
+	for i, tr := range l.trackers {
+		wg.Add(1)
+		go func(i int, tr string) {
+			defer wg.Done()
+			err := tracker.Check(tr, trackerCheckTimeout)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"tracker": tr,
+					"error":   err,
+				}).Debug("Drop tracker which does not answer")
+			}
+			isAlive[i] = err == nil
+		}(i, tr)
+	}
+	wg.Wait()
+
+	var alive []string
+	for i, tr := range l.trackers {
+		if isAlive[i] {
+			alive = append(alive, tr)
+		}
+	}
+	l.trackers = alive
+}
+
+// addTo returns magnetURI with the trackers of l it does not have yet, if
+// the magnets of source get them. Trackers are added at the end of the magnet
+// so that it is otherwise unchanged.
+func (l *trackerList) addTo(source, magnetURI string) string {
+	if l == nil || magnetURI == "" || (l.sources != nil && !l.sources[source]) {
+		return magnetURI
+	}
+	if l.isCheck {
+		l.checkOnce.Do(l.check)
+	}
+	m, err := magnet.Parse(magnetURI)
+	if err != nil {
+		return magnetURI
+	}
+
+	has := make(map[string]bool, len(m.Trackers))
+	for _, tr := range m.Trackers {
+		has[tr] = true
+	}
+	var b strings.Builder
+	b.WriteString(magnetURI)
+	for _, tr := range l.trackers {
+		if !has[tr] {
+			b.WriteString("&tr=" + url.QueryEscape(tr))
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juliensalinas/torrengo/magnet"
+)
+
+// writeTrackerFile writes a tracker list and returns its path
+func writeTrackerFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "trackers.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadTrackerFile(t *testing.T) {
+	path := writeTrackerFile(t, "# Public trackers\n"+
+		"udp://tracker.example:1337/announce\n"+
+		"\n"+
+		"  http://tracker.example/announce  \n"+
+		"udp://tracker.example:1337/announce\n")
+	trackers, err := readTrackerFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"udp://tracker.example:1337/announce", "http://tracker.example/announce"}
+	if len(trackers) != len(want) || trackers[0] != want[0] || trackers[1] != want[1] {
+		t.Fatalf("Got trackers %v, want %v", trackers, want)
+	}
+
+	path = writeTrackerFile(t, "http://tracker.example/announce\ntracker.example\n")
+	if _, err := readTrackerFile(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("Got error %v for an invalid line", err)
+	}
+}
+
+func TestAddTrackers(t *testing.T) {
+	l := &trackerList{
+		trackers: []string{"udp://tracker.example:1337/announce", "http://tracker.example/announce"},
+		sources:  map[string]bool{"tpb": true},
+	}
+	uri := "magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK&dn=x&tr=http%3A%2F%2Ftracker.example%2Fannounce"
+
+	got := l.addTo("tpb", uri)
+	if !strings.HasPrefix(got, uri) {
+		t.Fatalf("Magnet changed to %v", got)
+	}
+	m, err := magnet.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Trackers) != 2 {
+		t.Fatalf("Got trackers %v", m.Trackers)
+	}
+
+	if got := l.addTo("arc", uri); got != uri {
+		t.Fatalf("Trackers added to the magnet of another source: %v", got)
+	}
+	if got := l.addTo("tpb", "not a magnet"); got != "not a magnet" {
+		t.Fatalf("Got %v for an invalid magnet", got)
+	}
+	var none *trackerList
+	if got := none.addTo("tpb", uri); got != uri {
+		t.Fatalf("Got %v without trackers", got)
+	}
+}
+
+func TestCheckTrackers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/announce" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("d8:intervali1800e5:peers0:e"))
+	}))
+	defer ts.Close()
+
+	l := &trackerList{
+		trackers: []string{ts.URL + "/announce", ts.URL + "/dead"},
+		isCheck:  true,
+	}
+	m, err := magnet.Parse(l.addTo("otts", "magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Trackers) != 1 || m.Trackers[0] != ts.URL+"/announce" {
+		t.Fatalf("Got trackers %v", m.Trackers)
+	}
+}
+
+func TestInitExtraTrackers(t *testing.T) {
+	defer func() { extraTrackers = nil }()
+
+	path := writeTrackerFile(t, "http://tracker.example/announce\n")
+	if err := initExtraTrackers(trackersConfig{File: path, Sources: []string{"tpb", "otts"}}); err != nil {
+		t.Fatal(err)
+	}
+	if extraTrackers == nil || !extraTrackers.sources["otts"] || extraTrackers.sources["arc"] {
+		t.Fatalf("Got trackers %+v", extraTrackers)
+	}
+	if err := initExtraTrackers(trackersConfig{File: path, Sources: []string{"nope"}}); err == nil {
+		t.Fatal("No error for an unknown source")
+	}
+	if err := initExtraTrackers(trackersConfig{}); err != nil || extraTrackers != nil {
+		t.Fatalf("Got trackers %+v without file", extraTrackers)
+	}
+}
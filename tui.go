@@ -0,0 +1,653 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// tuiSortKeys are the keys results can be sorted by in the TUI, in the order
+// they are cycled through
+var tuiSortKeys = []string{"seeders", "leechers", "size", "date", "name", "source", "relevance"}
+
+// tuiHelp is displayed at the bottom of the TUI
+const tuiHelp = "↑↓ move  space select  a select all  / filter  s sort  r reverse  " +
+	"enter details  c copy magnet  d download  o open in client  q quit"
+
+// tui is a full-screen terminal interface to browse results and act on them
+type tui struct {
+	s             *search
+	timeout       time.Duration
+	torrentClient string
+	yggUserID     string
+	yggUserPass   string
+
+	in  io.Reader
+	out *bufio.Writer
+
+	// view contains the indexes in s.out of the displayed torrents, once
+	// filtered and sorted
+	view []int
+	// cursor is the position of the highlighted torrent in view and offset
+	// the position of the first displayed torrent
+	cursor int
+	offset int
+	// selected contains the indexes in s.out of the selected torrents
+	selected    map[int]bool
+	filter      string
+	isFiltering bool
+	// sortKeys are the keys given with -sort, which sort torrents until the
+	// user cycles through tuiSortKeys. sortKey is the index in tuiSortKeys
+	// of the current key.
+	sortKeys   string
+	sortKey    int
+	isReversed bool
+	showDetail bool
+	status     string
+	width      int
+	height     int
+
+	// done contains messages about the retrieved magnets and torrent files,
+	// printed once the TUI is closed
+	done []string
+}
+
+// runTUI displays results in a full-screen terminal interface until the user
+// quits. Results are first sorted by sortKeys (see newSorter).
+// Torrents are opened in torrentClient, or in a client chosen by the user if
+// empty.
+func runTUI(s *search, sortKeys string, timeout time.Duration, torrentClient string) error {
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("could not switch terminal to raw mode: %v", err)
+	}
+
+	t := &tui{
+		s:             s,
+		timeout:       timeout,
+		torrentClient: torrentClient,
+		yggUserID:     os.Getenv("TORRENGO_YGG_ID"),
+		yggUserPass:   os.Getenv("TORRENGO_YGG_PASS"),
+		in:            os.Stdin,
+		out:           bufio.NewWriter(os.Stdout),
+		selected:      make(map[int]bool),
+		sortKeys:      sortKeys,
+	}
+	// Cycling through sort keys starts after the first -sort key
+	first := strings.TrimPrefix(strings.TrimSpace(strings.Split(sortKeys, ",")[0]), "-")
+	for i, key := range tuiSortKeys {
+		if key == first {
+			t.sortKey = i
+		}
+	}
+	t.updateView()
+
+	// Use the alternate screen so the terminal is left untouched afterwards
+	t.out.WriteString("\x1b[?1049h\x1b[?25l")
+	err = t.loop()
+	t.out.WriteString("\x1b[?25h\x1b[?1049l")
+	t.out.Flush()
+	term.Restore(fd, oldState)
+
+	for _, msg := range t.done {
+		fmt.Println(msg)
+	}
+
+	return err
+}
+
+// loop reads and handles keys until the user quits
+func (t *tui) loop() error {
+	for {
+		t.render()
+		keys, err := readKeys(t.in)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if quit := t.handleKey(key); quit {
+				return nil
+			}
+		}
+	}
+}
+
+// handleKey handles a key pressed by the user and returns true if the user
+// wants to quit
+func (t *tui) handleKey(key string) bool {
+	if t.isFiltering {
+		switch key {
+		case "enter", "esc":
+			t.isFiltering = false
+		case "backspace":
+			if t.filter != "" {
+				_, size := utf8.DecodeLastRuneInString(t.filter)
+				t.filter = t.filter[:len(t.filter)-size]
+				t.updateView()
+			}
+		case "ctrl-c":
+			return true
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				t.filter += key
+				t.updateView()
+			}
+		}
+		return false
+	}
+
+	t.status = ""
+	switch key {
+	case "q", "ctrl-c":
+		return true
+	case "up", "k":
+		t.move(-1)
+	case "down", "j":
+		t.move(1)
+	case "pgup":
+		t.move(-t.listHeight())
+	case "pgdown":
+		t.move(t.listHeight())
+	case "home", "g":
+		t.move(-len(t.view))
+	case "end", "G":
+		t.move(len(t.view))
+	case " ":
+		if len(t.view) > 0 {
+			i := t.view[t.cursor]
+			t.selected[i] = !t.selected[i]
+			if !t.selected[i] {
+				delete(t.selected, i)
+			}
+			t.move(1)
+		}
+	case "a":
+		// Select all displayed torrents, or unselect all if they already are
+		allSelected := true
+		for _, i := range t.view {
+			allSelected = allSelected && t.selected[i]
+		}
+		for _, i := range t.view {
+			if allSelected {
+				delete(t.selected, i)
+			} else {
+				t.selected[i] = true
+			}
+		}
+	case "/":
+		t.isFiltering = true
+	case "esc":
+		t.filter = ""
+		t.updateView()
+	case "s":
+		t.sortKeys = ""
+		t.sortKey = (t.sortKey + 1) % len(tuiSortKeys)
+		t.updateView()
+	case "r":
+		t.isReversed = !t.isReversed
+		t.updateView()
+	case "enter":
+		t.showDetail = !t.showDetail
+	case "c":
+		t.copyMagnets()
+	case "d":
+		t.download()
+	case "o":
+		t.openInClient()
+	}
+
+	return false
+}
+
+// move moves the cursor by delta torrents
+func (t *tui) move(delta int) {
+	t.cursor += delta
+	if t.cursor >= len(t.view) {
+		t.cursor = len(t.view) - 1
+	}
+	if t.cursor < 0 {
+		t.cursor = 0
+	}
+}
+
+// updateView filters and sorts torrents based on the user choices
+func (t *tui) updateView() {
+	words := strings.Fields(strings.ToLower(t.filter))
+	t.view = t.view[:0]
+	for i, tor := range t.s.out {
+		name := strings.ToLower(tor.name)
+		keep := true
+		for _, word := range words {
+			keep = keep && strings.Contains(name, word)
+		}
+		if keep {
+			t.view = append(t.view, i)
+		}
+	}
+
+	so, _ := newSorter(t.currentSortKeys(), t.s.in)
+	so.keys[0].isReversed = so.keys[0].isReversed != t.isReversed
+	sort.SliceStable(t.view, func(i, j int) bool {
+		return so.less(t.s.out[t.view[i]], t.s.out[t.view[j]])
+	})
+	t.move(0)
+}
+
+// currentSortKeys returns the keys torrents are sorted by
+func (t *tui) currentSortKeys() string {
+	if t.sortKeys != "" {
+		return t.sortKeys
+	}
+	return tuiSortKeys[t.sortKey]
+}
+
+// targets returns the indexes in s.out of the torrents an action applies to:
+// the selected torrents if any, otherwise the highlighted one
+func (t *tui) targets() []int {
+	var targets []int
+	for _, i := range t.view {
+		if t.selected[i] {
+			targets = append(targets, i)
+		}
+	}
+	if len(targets) == 0 && len(t.view) > 0 {
+		targets = append(targets, t.view[t.cursor])
+	}
+	return targets
+}
+
+// resolve retrieves the magnet or the torrent file of the torrent at index i
+// and returns it.
+// Ygg Torrent credentials are asked if needed.
+func (t *tui) resolve(i int) (string, error) {
+	tor := &t.s.out[i]
+	t.status = "Retrieving " + tor.name + "..."
+	t.render()
+
+	switch tor.source {
+	case "arc", "ygg":
+		if tor.filePath != "" {
+			return tor.filePath, nil
+		}
+		if tor.source == "ygg" && t.yggUserID == "" {
+			var ok bool
+			if t.yggUserID, ok = t.prompt("Ygg Torrent user ID: ", false); !ok {
+				return "", fmt.Errorf("no Ygg Torrent credentials")
+			}
+			if t.yggUserPass, ok = t.prompt("Ygg Torrent user pass: ", true); !ok {
+				t.yggUserID = ""
+				return "", fmt.Errorf("no Ygg Torrent credentials")
+			}
+		}
+		err := getTorrentFile(tor, t.yggUserID, t.s.in, t.yggUserPass, t.timeout, t.s.httpClient)
+		if err != nil {
+			return "", err
+		}
+		t.done = append(t.done, "Here is your torrent file: "+tor.filePath)
+		return tor.filePath, nil
+	default:
+		if tor.magnet != "" {
+			tor.magnet = extraTrackers.addTo(tor.source, tor.magnet)
+			return tor.magnet, nil
+		}
+		if err := getMagnet(tor, t.timeout); err != nil {
+			return "", err
+		}
+		return tor.magnet, nil
+	}
+}
+
+// copyMagnets copies the magnets of the targeted torrents to the clipboard
+// thanks to the OSC 52 terminal escape sequence
+func (t *tui) copyMagnets() {
+	var magnets []string
+	var errs []string
+	for _, i := range t.targets() {
+		tor := t.s.out[i]
+		if tor.source == "arc" || tor.source == "ygg" {
+			errs = append(errs, sources[tor.source]+" only provides torrent files")
+			continue
+		}
+		magnet, err := t.resolve(i)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		magnets = append(magnets, magnet)
+		t.done = append(t.done, "Here is your magnet link: "+magnet)
+	}
+
+	if len(magnets) > 0 {
+		clip := base64.StdEncoding.EncodeToString([]byte(strings.Join(magnets, "\n")))
+		t.out.WriteString("\x1b]52;c;" + clip + "\x07")
+	}
+	t.setResultStatus(fmt.Sprintf("Copied %d magnet(s) to clipboard.", len(magnets)), errs)
+}
+
+// download downloads the torrent files of the targeted torrents, or
+// retrieves their magnet if the source has no torrent files
+func (t *tui) download() {
+	var nbDone int
+	var errs []string
+	for _, i := range t.targets() {
+		resource, err := t.resolve(i)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if strings.HasPrefix(resource, "magnet:") {
+			t.done = append(t.done, "Here is your magnet link: "+resource)
+		}
+		nbDone++
+	}
+	t.setResultStatus(fmt.Sprintf("Retrieved %d torrent(s), see them once you quit.", nbDone), errs)
+}
+
+// openInClient opens the targeted torrents in the torrent client
+func (t *tui) openInClient() {
+	if t.torrentClient == "" {
+		switch key, _ := t.prompt("Open in Deluge (d), QBittorrent (q), or Transmission (t)? ", false); key {
+		case "d":
+			t.torrentClient = "deluge"
+		case "q":
+			t.torrentClient = "qbittorrent"
+		case "t":
+			t.torrentClient = "transmission"
+		default:
+			t.status = "Please enter a valid torrent client. It should be 'd', 'q' or 't'."
+			return
+		}
+	}
+
+	var nbDone int
+	var errs []string
+	for _, i := range t.targets() {
+		resource, err := t.resolve(i)
+		if err == nil {
+			err = openInClient(resource, t.torrentClient)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		nbDone++
+	}
+	t.setResultStatus(fmt.Sprintf("Opened %d torrent(s) in client.", nbDone), errs)
+}
+
+// setResultStatus sets the status line after an action
+func (t *tui) setResultStatus(msg string, errs []string) {
+	t.status = msg
+	if len(errs) > 0 {
+		t.status += " Errors: " + strings.Join(errs, "; ")
+	}
+}
+
+// prompt asks the user for an input in the status line and returns false if
+// the user cancelled with Esc
+func (t *tui) prompt(label string, isMasked bool) (string, bool) {
+	var input string
+	for {
+		shown := input
+		if isMasked {
+			shown = strings.Repeat("*", utf8.RuneCountInString(input))
+		}
+		t.status = label + shown
+		t.render()
+
+		keys, err := readKeys(t.in)
+		if err != nil {
+			return "", false
+		}
+		for _, key := range keys {
+			switch key {
+			case "enter":
+				t.status = ""
+				return input, true
+			case "esc", "ctrl-c":
+				t.status = ""
+				return "", false
+			case "backspace":
+				if input != "" {
+					_, size := utf8.DecodeLastRuneInString(input)
+					input = input[:len(input)-size]
+				}
+			default:
+				if utf8.RuneCountInString(key) == 1 {
+					input += key
+				}
+			}
+		}
+	}
+}
+
+// listHeight returns the number of torrents that fit on screen
+func (t *tui) listHeight() int {
+	height := t.height - 4
+	if t.showDetail {
+		height -= 9
+	}
+	if height < 1 {
+		height = 1
+	}
+	return height
+}
+
+// render draws the whole screen
+func (t *tui) render() {
+	var err error
+	t.width, t.height, err = term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		t.width, t.height = 80, 24
+	}
+
+	// Keep the cursor on screen
+	listHeight := t.listHeight()
+	if t.cursor < t.offset {
+		t.offset = t.cursor
+	}
+	if t.cursor >= t.offset+listHeight {
+		t.offset = t.cursor - listHeight + 1
+	}
+
+	order := "↓"
+	if t.isReversed {
+		order = "↑"
+	}
+	t.out.WriteString("\x1b[H\x1b[2J")
+	t.line(fmt.Sprintf("\x1b[1mTorrengo\x1b[0m: %s | %d/%d results | %d selected | sorted by %s %s",
+		t.s.in, len(t.view), len(t.s.out), len(t.selected), t.currentSortKeys(), order))
+
+	// Fixed width columns, the name takes the remaining space
+	nameWidth := t.width - 64
+	if nameWidth < 10 {
+		nameWidth = 10
+	}
+	t.line("\x1b[4m" + runewidth.FillRight("    # "+runewidth.FillRight("Name", nameWidth)+
+		" Size       Seeders Leechers Date of upload   Source", t.width) + "\x1b[0m")
+
+	for row := 0; row < listHeight; row++ {
+		pos := t.offset + row
+		if pos >= len(t.view) {
+			t.line("")
+			continue
+		}
+		i := t.view[pos]
+		tor := t.s.out[i]
+		mark := " "
+		if t.selected[i] {
+			mark = "*"
+		}
+		style := ""
+		if pos == t.cursor {
+			style = "\x1b[7m"
+		}
+		t.line(style + mark + fmt.Sprintf("%4d ", i) +
+			runewidth.FillRight(runewidth.Truncate(tor.name, nameWidth, "…"), nameWidth) + " " +
+			runewidth.FillRight(runewidth.Truncate(displaySize(tor), 10, "…"), 10) + " " +
+			fmt.Sprintf("%7s %8s ", unknownIfNegative(tor.seeders), unknownIfNegative(tor.leechers)) +
+			runewidth.FillRight(runewidth.Truncate(displayUplDate(tor), 16, "…"), 16) + " " +
+			runewidth.Truncate(displaySources(tor), 11, "…") + "\x1b[0m")
+	}
+
+	if t.showDetail {
+		t.renderDetail()
+	}
+
+	if t.isFiltering {
+		t.line("Filter: " + t.filter + "█")
+	} else if t.status != "" {
+		t.line(t.status)
+	} else if t.filter != "" {
+		t.line("Filter: " + t.filter + " (esc to clear)")
+	} else {
+		t.line("")
+	}
+	t.out.WriteString(runewidth.Truncate(tuiHelp, t.width, "…"))
+	t.out.Flush()
+}
+
+// renderDetail draws the detail pane of the highlighted torrent
+func (t *tui) renderDetail() {
+	t.line(strings.Repeat("─", t.width))
+	if len(t.view) == 0 {
+		for i := 0; i < 8; i++ {
+			t.line("")
+		}
+		return
+	}
+	tor := t.s.out[t.view[t.cursor]]
+	magnet := tor.magnet
+	if magnet == "" && (tor.source == "tpb" || tor.source == "otts") {
+		magnet = "(retrieved on demand)"
+	}
+	for _, field := range [][2]string{
+		{"Name", tor.name},
+		{"Size", displaySize(tor)},
+		{"Seeders", unknownIfNegative(tor.seeders)},
+		{"Leechers", unknownIfNegative(tor.leechers)},
+		{"Upload date", displayUplDate(tor)},
+		{"Source", displaySources(tor)},
+		{"Description", tor.descURL},
+		{"Magnet", magnet},
+	} {
+		t.line("\x1b[1m" + runewidth.FillRight(field[0], 12) + "\x1b[0m " + field[1])
+	}
+}
+
+// line writes a line truncated to the screen width.
+// Raw mode needs explicit carriage returns.
+func (t *tui) line(s string) {
+	t.out.WriteString(truncateANSI(s, t.width))
+	t.out.WriteString("\x1b[K\r\n")
+}
+
+// truncateANSI truncates s to width columns, ignoring ANSI escape sequences
+func truncateANSI(s string, width int) string {
+	var sb strings.Builder
+	var w int
+	isEscape := false
+	for _, r := range s {
+		if r == '\x1b' {
+			isEscape = true
+		}
+		if isEscape {
+			sb.WriteRune(r)
+			if r == 'm' {
+				isEscape = false
+			}
+			continue
+		}
+		rw := runewidth.RuneWidth(r)
+		if w+rw > width {
+			break
+		}
+		w += rw
+		sb.WriteRune(r)
+	}
+	return sb.String() + "\x1b[0m"
+}
+
+// unknownIfNegative replaces -1 by unknown because more user-friendly
+func unknownIfNegative(n int) string {
+	if n < 0 {
+		return "Unknown"
+	}
+	return strconv.Itoa(n)
+}
+
+// readKeys reads the keys pressed by the user.
+// Several keys can be returned at once when the user types fast or pastes text.
+func readKeys(r io.Reader) ([]string, error) {
+	buf := make([]byte, 256)
+	n, err := r.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseKeys(buf[:n]), nil
+}
+
+// escapeKeys maps escape sequences sent by terminals to key names
+var escapeKeys = map[string]string{
+	"[A": "up", "[B": "down", "[C": "right", "[D": "left",
+	"[H": "home", "[F": "end", "OH": "home", "OF": "end",
+	"[1~": "home", "[7~": "home", "[4~": "end", "[8~": "end",
+	"[5~": "pgup", "[6~": "pgdown", "OA": "up", "OB": "down",
+}
+
+// parseKeys converts raw terminal input into key names
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		switch {
+		case b[0] == 0x1b:
+			// A lone escape is the Esc key, otherwise look for a known
+			// escape sequence
+			if len(b) == 1 {
+				keys = append(keys, "esc")
+				return keys
+			}
+			found := false
+			for seq, key := range escapeKeys {
+				if strings.HasPrefix(string(b[1:]), seq) {
+					keys = append(keys, key)
+					b = b[1+len(seq):]
+					found = true
+					break
+				}
+			}
+			if !found {
+				// Skip unknown sequences
+				return keys
+			}
+			continue
+		case b[0] == '\r' || b[0] == '\n':
+			keys = append(keys, "enter")
+		case b[0] == 127 || b[0] == 8:
+			keys = append(keys, "backspace")
+		case b[0] == 3:
+			keys = append(keys, "ctrl-c")
+		case b[0] < 32:
+			// Ignore other control characters
+		default:
+			r, size := utf8.DecodeRune(b)
+			keys = append(keys, string(r))
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("\x1b[Ab\x1b[6~é\r\x7f\x1b"))
+	want := []string{"up", "b", "pgdown", "é", "enter", "backspace", "esc"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("Got %q, want %q", keys, want)
+	}
+}
+
+func TestTUIFilterSortSelect(t *testing.T) {
+	s := &search{in: "dumas", out: []torrent{
+		{name: "Le Comte de Monte-Cristo", sizeBytes: 1e9, seeders: 3},
+		{name: "Les Trois Mousquetaires", sizeBytes: 2e9, seeders: 5},
+		{name: "Monte Cristo (2002)", sizeBytes: 700e6, seeders: 1},
+	}}
+	tu := &tui{s: s, out: bufio.NewWriter(io.Discard), selected: make(map[int]bool), width: 100, height: 30}
+	tu.updateView()
+	if !reflect.DeepEqual(tu.view, []int{1, 0, 2}) {
+		t.Fatalf("Got view %v sorted by seeders, want [1 0 2]", tu.view)
+	}
+
+	for _, key := range []string{"/", "m", "o", "n", "t", "e", "enter"} {
+		tu.handleKey(key)
+	}
+	if !reflect.DeepEqual(tu.view, []int{0, 2}) {
+		t.Fatalf("Got view %v once filtered, want [0 2]", tu.view)
+	}
+
+	// Sort by size then select the highlighted torrent
+	tu.handleKey("esc")
+	tu.handleKey("s")
+	tu.handleKey("s")
+	if !reflect.DeepEqual(tu.view, []int{1, 0, 2}) {
+		t.Fatalf("Got view %v sorted by size, want [1 0 2]", tu.view)
+	}
+	tu.handleKey("down")
+	tu.handleKey(" ")
+	if !reflect.DeepEqual(tu.targets(), []int{0}) {
+		t.Fatalf("Got targets %v, want [0]", tu.targets())
+	}
+
+	// Rendering should not break with or without the detail pane
+	tu.render()
+	tu.handleKey("enter")
+	tu.render()
+
+	if !tu.handleKey("q") {
+		t.Fatal("q should quit")
+	}
+}
+
+func TestTUISortKeys(t *testing.T) {
+	s := &search{in: "dumas", out: []torrent{
+		{name: "Le Comte de Monte-Cristo", sizeBytes: 1e9, seeders: 3},
+		{name: "Les Trois Mousquetaires", sizeBytes: 2e9, seeders: 5},
+		{name: "Monte Cristo (2002)", sizeBytes: 700e6, seeders: 1},
+	}}
+	// The -sort keys are kept until the user cycles through sort keys
+	tu := &tui{s: s, out: bufio.NewWriter(io.Discard), selected: make(map[int]bool), sortKeys: "-size", sortKey: 2}
+	tu.updateView()
+	if !reflect.DeepEqual(tu.view, []int{2, 0, 1}) {
+		t.Fatalf("Got view %v sorted by -size, want [2 0 1]", tu.view)
+	}
+	tu.handleKey("r")
+	if !reflect.DeepEqual(tu.view, []int{1, 0, 2}) {
+		t.Fatalf("Got view %v sorted by size, want [1 0 2]", tu.view)
+	}
+	tu.handleKey("r")
+	tu.handleKey("s")
+	if tu.currentSortKeys() != "date" {
+		t.Fatalf("Got sort keys %v after cycling, want date", tu.currentSortKeys())
+	}
+}
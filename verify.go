@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/term"
+
+	"github.com/juliensalinas/torrengo/core"
+	"github.com/juliensalinas/torrengo/metainfo"
+	"github.com/juliensalinas/torrengo/storage"
+)
+
+// Statuses of verified files
+const (
+	fileOK        = "ok"
+	fileMissing   = "missing"
+	fileWrongSize = "wrong size"
+	fileCorrupt   = "corrupt"
+)
+
+// verifyReport is the result of the verification of local data against a
+// torrent file
+type verifyReport struct {
+	Name        string `json:"name"`
+	Dir         string `json:"dir"`
+	Pieces      int    `json:"pieces"`
+	ValidPieces int    `json:"validPieces"`
+	// TotalSize and CompletedSize are the sizes in bytes of the files and of
+	// their valid pieces, without padding files
+	TotalSize     int64          `json:"totalSize"`
+	CompletedSize int64          `json:"completedSize"`
+	Percent       float64        `json:"percent"`
+	Files         []verifiedFile `json:"files"`
+}
+
+// verifiedFile is a file of a verified torrent. Path elements are separated
+// by "/", like for the info subcommand.
+type verifiedFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Status string `json:"status"`
+	// BadPieces is the number of pieces holding data of the file which are
+	// missing or do not match their hash
+	BadPieces int `json:"badPieces"`
+}
+
+// isComplete reports whether all files are valid
+func (r verifyReport) isComplete() bool {
+	for _, f := range r.Files {
+		if f.Status != fileOK {
+			return false
+		}
+	}
+	return r.ValidPieces == r.Pieces
+}
+
+// dataDir returns the directory containing the content of mi, given the path
+// of the content or of its parent directory
+func dataDir(mi *metainfo.MetaInfo, path string) string {
+	if _, err := os.Stat(filepath.Join(path, mi.Name)); err == nil {
+		return path
+	}
+	if filepath.Base(filepath.Clean(path)) == mi.Name {
+		return filepath.Dir(filepath.Clean(path))
+	}
+	return path
+}
+
+// verifyData hashes the content of mi stored in dir piece by piece and
+// reports which files are missing or corrupt.
+// progress, if set, is called after each piece with the number of pieces
+// checked.
+func verifyData(mi *metainfo.MetaInfo, dir string, progress func(done, total int)) (verifyReport, error) {
+	if !mi.HasV1() {
+		return verifyReport{}, fmt.Errorf("only torrents with v1 pieces can be verified")
+	}
+	s := storage.New(mi, dir, nil)
+	defer s.Close()
+
+	report := verifyReport{
+		Name:   mi.Name,
+		Dir:    dir,
+		Pieces: s.NumPieces(),
+		Files:  make([]verifiedFile, len(mi.Files)),
+	}
+	for i, path := range s.Files() {
+		f := mi.Files[i]
+		report.Files[i] = verifiedFile{Path: strings.Join(f.Path, "/"), Size: f.Length, Status: fileOK}
+		if mi.IsDir {
+			report.Files[i].Path = mi.Name + "/" + report.Files[i].Path
+		}
+		if f.IsPadding {
+			continue
+		}
+		report.TotalSize += f.Length
+		stat, err := os.Stat(path)
+		switch {
+		case err != nil || stat.IsDir():
+			report.Files[i].Status = fileMissing
+		case stat.Size() != f.Length:
+			report.Files[i].Status = fileWrongSize
+		}
+	}
+
+	for i := 0; i < report.Pieces; i++ {
+		ok, err := s.CheckPiece(i, mi.Pieces[i])
+		if ok {
+			report.ValidPieces++
+			report.CompletedSize += s.SelectedLength(i)
+		}
+		for _, j := range s.PieceFiles(i) {
+			if ok {
+				continue
+			}
+			report.Files[j].BadPieces++
+			// Pieces which cannot be read are explained by missing or
+			// short files, while wrong data may be in any file of the piece
+			if err == nil && report.Files[j].Status == fileOK {
+				report.Files[j].Status = fileCorrupt
+			}
+		}
+		if progress != nil {
+			progress(i+1, report.Pieces)
+		}
+	}
+	if report.TotalSize > 0 {
+		report.Percent = float64(report.CompletedSize) * 100 / float64(report.TotalSize)
+	} else if report.ValidPieces == report.Pieces {
+		report.Percent = 100
+	}
+
+	// Padding files are not reported
+	files := report.Files[:0]
+	for i, f := range report.Files {
+		if !mi.Files[i].IsPadding {
+			files = append(files, f)
+		}
+	}
+	report.Files = files
+
+	return report, nil
+}
+
+// writeVerifyTable writes the files which are not valid, if any, and a
+// summary of report
+func writeVerifyTable(w io.Writer, report verifyReport) {
+	var rows [][]string
+	for _, f := range report.Files {
+		if f.Status != fileOK {
+			rows = append(rows, []string{f.Path, core.FormatSize(f.Size), f.Status, fmt.Sprint(f.BadPieces)})
+		}
+	}
+	if len(rows) > 0 {
+		table := tablewriter.NewWriter(w)
+		table.SetAutoWrapText(false)
+		table.SetHeader([]string{"File", "Size", "Status", "Bad pieces"})
+		table.AppendBulk(rows)
+		table.Render()
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "%s: %d/%d pieces valid, %.1f%% complete (%s of %s)%s",
+		report.Name, report.ValidPieces, report.Pieces, report.Percent,
+		core.FormatSize(report.CompletedSize), core.FormatSize(report.TotalSize), lineBreak)
+}
+
+// verifyCmd runs the verify subcommand, which checks downloaded data against
+// the piece hashes of their torrent file
+func verifyCmd(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(
+			flags.Output(),
+			"Usage of %[1]s verify:%[2]s%[2]s\t%[1]s verify [-format table|json] [-v] file.torrent path%[2]s%[2]s"+
+				"Hashes the downloaded data of a torrent piece by piece and reports the missing and corrupt files "+
+				"and the percentage complete. path is the downloaded file or directory, or the directory containing it. "+
+				"Exits with status 1 if the data are not complete.%[2]s%[2]s"+
+				"Options:%[2]s%[2]s",
+			os.Args[0], lineBreak,
+		)
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "table", "Output format: table or json.")
+	isVerbosePtr := flags.Bool("v", false, "Verbose mode. Use it to see more logs.")
+	flags.Parse(args)
+
+	isVerbose = *isVerbosePtr
+	setLogger(isVerbose)
+
+	if *format != "table" && *format != "json" {
+		fmt.Fprintln(os.Stderr, "-format should be either table or json (-h for help).")
+		os.Exit(1)
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	mi, err := metainfo.Load(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read %v: %v%v", flags.Arg(0), err, lineBreak)
+		os.Exit(1)
+	}
+	dir := dataDir(mi, flags.Arg(1))
+	log.WithFields(log.Fields{
+		"name": mi.Name,
+		"dir":  dir,
+	}).Debug("Verify torrent data")
+
+	// Hashing big torrents takes a while so progress is displayed in
+	// terminals
+	var progress func(done, total int)
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		progress = func(done, total int) {
+			if done%16 == 0 || done == total {
+				fmt.Fprintf(os.Stderr, "\r\033[KHashing pieces: %d/%d", done, total)
+			}
+		}
+	}
+	report, err := verifyData(mi, dir, progress)
+	if progress != nil {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not verify %v: %v%v", mi.Name, err, lineBreak)
+		os.Exit(1)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Fatal("Could not write verification report")
+		}
+	} else {
+		writeVerifyTable(os.Stdout, report)
+	}
+
+	if !report.isComplete() {
+		os.Exit(1)
+	}
+}
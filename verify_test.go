@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha1"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juliensalinas/torrengo/metainfo"
+)
+
+// writeVerifyData writes the content of a torrent of 3 files in dir/Dumas
+// and returns its metainfo
+func writeVerifyData(t *testing.T, dir string) *metainfo.MetaInfo {
+	content := map[string]string{
+		"tome1.txt": "Le Comte de Monte-Cristo, tome 1",
+		"tome2.txt": "Le Comte de Monte-Cristo, tome 2",
+		"cover.jpg": "jpg",
+	}
+	mi := &metainfo.MetaInfo{
+		Name:        "Dumas",
+		IsDir:       true,
+		PieceLength: 16,
+		InfoHash:    [20]byte{1},
+	}
+	var data []byte
+	for _, name := range []string{"tome1.txt", "tome2.txt", "cover.jpg"} {
+		mi.Files = append(mi.Files, metainfo.File{Path: []string{name}, Length: int64(len(content[name]))})
+		data = append(data, content[name]...)
+		if err := os.MkdirAll(filepath.Join(dir, "Dumas"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "Dumas", name), []byte(content[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mi.TotalLength = int64(len(data))
+	for off := 0; off < len(data); off += 16 {
+		end := off + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		mi.Pieces = append(mi.Pieces, sha1.Sum(data[off:end]))
+	}
+	return mi
+}
+
+func TestVerifyData(t *testing.T) {
+	dir := t.TempDir()
+	mi := writeVerifyData(t, dir)
+
+	if got := dataDir(mi, filepath.Join(dir, "Dumas")); got != dir {
+		t.Fatalf("Got data dir %v", got)
+	}
+	if got := dataDir(mi, dir); got != dir {
+		t.Fatalf("Got data dir %v", got)
+	}
+
+	report, err := verifyData(mi, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.isComplete() || report.Percent != 100 || report.ValidPieces != 5 {
+		t.Fatalf("Got report %+v", report)
+	}
+
+	// Corrupt the second tome and remove the cover, which shares its piece
+	// with the end of the second tome
+	if err := os.WriteFile(filepath.Join(dir, "Dumas", "tome2.txt"), []byte("Le Comte de Monte-Cristo, tome 3"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "Dumas", "cover.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	report, err = verifyData(mi, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.isComplete() || report.ValidPieces != 3 || report.CompletedSize != 48 {
+		t.Fatalf("Got report %+v", report)
+	}
+	want := []string{fileOK, fileCorrupt, fileMissing}
+	for i, f := range report.Files {
+		if f.Status != want[i] {
+			t.Fatalf("Got status %v for %v, want %v", f.Status, f.Path, want[i])
+		}
+	}
+	if report.Files[0].Path != "Dumas/tome1.txt" {
+		t.Fatalf("Got path %v", report.Files[0].Path)
+	}
+}
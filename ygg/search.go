@@ -16,8 +16,13 @@
 //
 // - Size: the size of the file to be downloaded
 //
+// - SizeBytes: the size converted to bytes (set to -1 if cannot be converted)
+//
 // - UplDate: the date of upload
 //
+// - UplTime and UplDatePrecision: the date of upload converted to a time, and
+// its precision (core.PrecisionUnknown if cannot be converted)
+//
 // - Leechers: the number of leechers (set to -1 if cannot be converted to integer)
 //
 // - Seechers: the number of seechers (set to -1 if cannot be converted to integer)
@@ -73,7 +78,12 @@ type Torrent struct {
 	DescURL string
 	Name    string
 	Size    string
-	UplDate string
+	// SizeBytes is set to -1 if Size cannot be converted to bytes
+	SizeBytes int64
+	UplDate   string
+	// UplTime is the zero time if UplDate cannot be converted
+	UplTime          time.Time
+	UplDatePrecision core.DatePrecision
 	// Seeders and Leechers are converted to -1 if cannot be converted to integers
 	Seeders  int
 	Leechers int
@@ -110,11 +120,14 @@ func parseSearchPage(html string) ([]Torrent, error) {
 		if err != nil {
 			t.UplDate = ""
 		} else {
-			t.UplDate = time.Unix(timestamp, 0).Format("2006/01/02 15:04")
+			t.UplTime = time.Unix(timestamp, 0)
+			t.UplDatePrecision = core.PrecisionSecond
+			t.UplDate = t.UplTime.Format("2006/01/02 15:04")
 		}
 
 		// File size is the text of the 4th <td> tag
 		t.Size = s.Find("td").Eq(5).First().Text()
+		t.SizeBytes = core.ParseSize(t.Size)
 
 		// Seeders is the text of the 6th <td> tag
 		seedersStr := s.Find("td").Eq(7).First().Text()
@@ -141,13 +154,18 @@ func parseSearchPage(html string) ([]Torrent, error) {
 // Lookup takes a user search as a parameter, launches the http request
 // with a custom timeout, and returns clean torrent information fetched from Ygg Torrent.
 func Lookup(in string, timeout time.Duration) ([]Torrent, *http.Client, error) {
-	searchParams.Add("name", in)
-	searchURL.RawQuery = searchParams.Encode()
+	// Work on copies so that concurrent searches do not share parameters
+	params := url.Values{"name": {in}}
+	for k, v := range searchParams {
+		params[k] = v
+	}
+	URL := searchURL
+	URL.RawQuery = params.Encode()
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	html, cookies, err := core.Fetch(ctx, searchURL.String(), nil)
+	html, cookies, err := core.Fetch(ctx, URL.String(), nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error while fetching url: %v", err)
 	}
@@ -164,7 +182,7 @@ func Lookup(in string, timeout time.Duration) ([]Torrent, *http.Client, error) {
 		Timeout: timeout,
 		Jar:     cookieJar,
 	}
-	client.Jar.SetCookies(&searchURL, cookies)
+	client.Jar.SetCookies(&URL, cookies)
 
 	return torrents, client, nil
 }